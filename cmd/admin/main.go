@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"tritontube/internal/proto"
+	"tritontube/internal/storage"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -17,6 +20,17 @@ func main() {
 	}
 
 	cmd := os.Args[1]
+
+	// verify works on a local snapshot file and needs no connection
+	if cmd == "verify" {
+		if len(os.Args) != 3 {
+			fmt.Println("Usage: verify <snapshot_file>")
+			os.Exit(1)
+		}
+		verifySnapshot(os.Args[2])
+		return
+	}
+
 	serverAddr := os.Args[2]
 
 	conn, err := grpc.NewClient(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -29,6 +43,18 @@ func main() {
 	client := proto.NewVideoContentAdminServiceClient(conn)
 
 	switch cmd {
+	case "backup":
+		if len(os.Args) != 4 {
+			fmt.Println("Usage: backup <node_address> <snapshot_file>")
+			os.Exit(1)
+		}
+		backupNode(proto.NewVideoContentClient(conn), serverAddr, os.Args[3])
+	case "restore":
+		if len(os.Args) != 4 {
+			fmt.Println("Usage: restore <node_address> <snapshot_file>")
+			os.Exit(1)
+		}
+		restoreNode(proto.NewVideoContentClient(conn), serverAddr, os.Args[3])
 	case "add":
 		if len(os.Args) != 4 {
 			fmt.Println("Usage: add <server_address> <node_address>")
@@ -41,6 +67,12 @@ func main() {
 			os.Exit(1)
 		}
 		removeNode(client, os.Args[3])
+	case "approve":
+		if len(os.Args) != 4 {
+			fmt.Println("Usage: approve <server_address> <node_address>")
+			os.Exit(1)
+		}
+		approveNode(client, os.Args[3])
 	case "list":
 		if len(os.Args) != 3 {
 			fmt.Println("Usage: list <server_address>")
@@ -58,6 +90,10 @@ func printUsageAndExit() {
 	fmt.Println("  add <server_address> <node_address>     - Add a node to the cluster")
 	fmt.Println("  remove <server_address> <node_address>  - Remove a node from the cluster")
 	fmt.Println("  list <server_address>                   - List all nodes in the cluster")
+	fmt.Println("  approve <server_address> <node_address> - Admit a self-registered node awaiting approval")
+	fmt.Println("  backup <node_address> <snapshot_file>   - Save a snapshot of one storage node")
+	fmt.Println("  restore <node_address> <snapshot_file>  - Restore a snapshot into an empty storage node")
+	fmt.Println("  verify <snapshot_file>                  - Check a snapshot against its manifest")
 	os.Exit(1)
 }
 
@@ -100,12 +136,166 @@ func listNodes(client proto.VideoContentAdminServiceClient) {
 		os.Exit(1)
 	}
 
+	stale := make(map[string]bool)
+	for _, node := range response.StaleNodes {
+		stale[node] = true
+	}
+
 	fmt.Println("Storage cluster nodes:")
 	if len(response.Nodes) == 0 {
 		fmt.Println("  No nodes in cluster")
 	} else {
 		for _, node := range response.Nodes {
+			if stale[node] {
+				fmt.Printf("  - %s (stale: heartbeat lapsed)\n", node)
+			} else {
+				fmt.Printf("  - %s\n", node)
+			}
+		}
+	}
+
+	if len(response.PendingNodes) > 0 {
+		fmt.Println("Nodes pending approval:")
+		for _, node := range response.PendingNodes {
 			fmt.Printf("  - %s\n", node)
 		}
 	}
 }
+
+func approveNode(client proto.VideoContentAdminServiceClient, nodeAddr string) {
+	ctx := context.Background()
+
+	response, err := client.ApproveNode(ctx, &proto.ApproveNodeRequest{
+		NodeAddress: nodeAddr,
+	})
+	if err != nil {
+		slog.Error("ApproveNode RPC failed", "node", nodeAddr, "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Successfully approved node: %s\n", nodeAddr)
+	fmt.Printf("Number of files migrated: %d\n", response.MigratedFileCount)
+}
+
+func backupNode(client proto.VideoContentClient, nodeAddr, path string) {
+	ctx := context.Background()
+
+	stream, err := client.Snapshot(ctx, &proto.SnapshotRequest{})
+	if err != nil {
+		slog.Error("Snapshot RPC failed", "node", nodeAddr, "error", err)
+		os.Exit(1)
+	}
+
+	// Write to a temporary file first so a failed backup never leaves a
+	// truncated snapshot under the final name.
+	tmpPath := path + ".partial"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		slog.Error("failed to create snapshot file", "path", tmpPath, "error", err)
+		os.Exit(1)
+	}
+
+	var written int64
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(tmpPath)
+			slog.Error("snapshot stream failed", "node", nodeAddr, "error", err)
+			os.Exit(1)
+		}
+		n, err := out.Write(chunk.Data)
+		if err != nil {
+			out.Close()
+			os.Remove(tmpPath)
+			slog.Error("failed to write snapshot file", "path", tmpPath, "error", err)
+			os.Exit(1)
+		}
+		written += int64(n)
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		slog.Error("failed to write snapshot file", "path", tmpPath, "error", err)
+		os.Exit(1)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		slog.Error("failed to finalize snapshot file", "path", path, "error", err)
+		os.Exit(1)
+	}
+
+	manifest := verifySnapshotFile(path)
+	fmt.Printf("Successfully backed up node: %s\n", nodeAddr)
+	fmt.Printf("Files: %d, archive size: %d bytes\n", len(manifest.Files), written)
+}
+
+func restoreNode(client proto.VideoContentClient, nodeAddr, path string) {
+	// Refuse to send an archive that is already known to be bad.
+	verifySnapshotFile(path)
+
+	in, err := os.Open(path)
+	if err != nil {
+		slog.Error("failed to open snapshot file", "path", path, "error", err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	stream, err := client.Restore(context.Background())
+	if err != nil {
+		slog.Error("Restore RPC failed", "node", nodeAddr, "error", err)
+		os.Exit(1)
+	}
+
+	buf := make([]byte, 1<<20)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if sendErr := stream.Send(&proto.RestoreChunk{Data: buf[:n]}); sendErr != nil {
+				// The server closed the stream early; the real error comes from CloseAndRecv.
+				break
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			slog.Error("failed to read snapshot file", "path", path, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	response, err := stream.CloseAndRecv()
+	if err != nil {
+		slog.Error("Restore RPC failed", "node", nodeAddr, "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Successfully restored node: %s\n", nodeAddr)
+	fmt.Printf("Files restored and verified: %d (%d bytes)\n", response.RestoredFileCount, response.RestoredBytes)
+}
+
+func verifySnapshot(path string) {
+	manifest := verifySnapshotFile(path)
+	fmt.Printf("Snapshot %s is valid\n", path)
+	fmt.Printf("Created at: %s\n", manifest.CreatedAt)
+	fmt.Printf("Files: %d\n", len(manifest.Files))
+}
+
+func verifySnapshotFile(path string) *storage.SnapshotManifest {
+	in, err := os.Open(path)
+	if err != nil {
+		slog.Error("failed to open snapshot file", "path", path, "error", err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	manifest, err := storage.VerifySnapshot(in)
+	if err != nil {
+		slog.Error("snapshot verification failed", "path", path, "error", err)
+		os.Exit(1)
+	}
+	return manifest
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tritontube/internal/storage"
+	"tritontube/internal/web"
+	"tritontube/internal/web/webtest"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func printUsage() {
+	fmt.Println("Usage: conformance [OPTIONS]")
+	fmt.Println()
+	fmt.Println("Runs the shared conformance checks against every metadata and content")
+	fmt.Println("backend. The memory, sqlite, etcd, fs and nw backends always run, etcd")
+	fmt.Println("and the nw storage nodes in process unless -etcd names a cluster.")
+	fmt.Println("DynamoDB and S3 run when their local stand-ins are given.")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+	fmt.Println()
+	fmt.Println("Example: conformance -dynamodb-endpoint http://localhost:8000 -s3-endpoint http://localhost:9000 -etcd localhost:2379")
+}
+
+func main() {
+	// The backends log every write; only the results are of interest here.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	dynamoEndpoint := flag.String("dynamodb-endpoint", "", "DynamoDB Local endpoint, e.g. http://localhost:8000 (a fresh table is created per check)")
+	s3Endpoint := flag.String("s3-endpoint", "", "S3-compatible endpoint such as MinIO, e.g. http://localhost:9000")
+	s3Bucket := flag.String("s3-bucket", "tritontube-conformance", "Bucket to use on the S3 endpoint; created if missing")
+	etcdEndpoints := flag.String("etcd", "", "Comma-separated etcd endpoints to check instead of an in-process server (each check uses its own key prefix)")
+	storageNodes := flag.Int("storage-nodes", 3, "Number of in-process storage nodes backing the nw content service")
+	timeout := flag.Duration("timeout", 5*time.Minute, "Give up if all checks together take longer than this")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	if flag.NArg() != 0 || *storageNodes < 1 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	tmp, err := os.MkdirTemp("", "conformance-*")
+	if err != nil {
+		fmt.Println("Error creating temp dir:", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tmp)
+
+	failed := 0
+	report := func(kind, backend string, results []webtest.Result) {
+		for _, r := range results {
+			if r.Err != nil {
+				fmt.Printf("FAIL %s/%s: %s: %v\n", kind, backend, r.Name, r.Err)
+				continue
+			}
+			fmt.Printf("ok   %s/%s: %s\n", kind, backend, r.Name)
+		}
+		failed += len(webtest.Failed(results))
+	}
+
+	// Metadata backends. Those that also store user accounts and grants get
+	// the user and ACL checks too.
+	checkMetadata := func(backend string, newService webtest.MetadataFactory, stores bool) {
+		report("metadata", backend, webtest.CheckMetadataService(ctx, newService))
+		if stores {
+			report("users", backend, webtest.CheckUserStore(ctx, userStores(newService)))
+			report("acl", backend, webtest.CheckACLStore(ctx, aclStores(newService)))
+		}
+	}
+	checkMetadata("memory", func(context.Context) (web.VideoMetadataService, error) {
+		return web.NewMemoryVideoMetadataService(), nil
+	}, true)
+	checkMetadata("sqlite", func(context.Context) (web.VideoMetadataService, error) {
+		return web.NewSQLiteVideoMetadataService(filepath.Join(tmp, "metadata-"+rand.Text()+".db"))
+	}, true)
+	checkMetadata("sqlite+cache", func(context.Context) (web.VideoMetadataService, error) {
+		svc, err := web.NewSQLiteVideoMetadataService(filepath.Join(tmp, "metadata-"+rand.Text()+".db"))
+		if err != nil {
+			return nil, err
+		}
+		return web.NewCachingVideoMetadataService(svc, web.MetadataCacheOptions{Size: 64, TTL: time.Minute}), nil
+	}, false)
+	if *dynamoEndpoint != "" {
+		os.Setenv("DYNAMODB_ENDPOINT", *dynamoEndpoint)
+		setLocalCredentials()
+		checkMetadata("dynamodb", func(ctx context.Context) (web.VideoMetadataService, error) {
+			svc, err := web.NewDynamoDBVideoMetadataService("conformance-" + rand.Text())
+			if err != nil {
+				return nil, err
+			}
+			return svc, svc.CreateTable(ctx)
+		}, true)
+	}
+	endpoints := strings.Split(*etcdEndpoints, ",")
+	if *etcdEndpoints == "" {
+		endpoint, stop, err := startEtcd(filepath.Join(tmp, "etcd"))
+		if err != nil {
+			fmt.Println("Error starting etcd:", err)
+			os.Exit(1)
+		}
+		defer stop()
+		endpoints = []string{endpoint}
+	}
+	checkMetadata("etcd", func(context.Context) (web.VideoMetadataService, error) {
+		client, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: 5 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		return web.NewEtcdVideoMetadataServiceFromClient(client, "/tritontube-conformance/"+rand.Text()+"/"), nil
+	}, true)
+
+	// Content backends
+	report("content", "memory", webtest.CheckContentService(ctx, func(context.Context) (web.VideoContentService, error) {
+		return web.NewMemoryVideoContentService(), nil
+	}))
+	report("content", "fs", webtest.CheckContentService(ctx, func(context.Context) (web.VideoContentService, error) {
+		return web.NewFSVideoContentService(filepath.Join(tmp, "content")), nil
+	}))
+	nodes, err := startStorageNodes(filepath.Join(tmp, "nodes"), *storageNodes)
+	if err != nil {
+		fmt.Println("Error starting storage nodes:", err)
+		os.Exit(1)
+	}
+	report("content", "nw", webtest.CheckContentService(ctx, func(context.Context) (web.VideoContentService, error) {
+		return web.NewNetworkVideoContentService(nodes)
+	}))
+	if *s3Endpoint != "" {
+		os.Setenv("S3_ENDPOINT", *s3Endpoint)
+		setLocalCredentials()
+		if err := ensureBucket(ctx, *s3Endpoint, *s3Bucket); err != nil {
+			fmt.Println("Error creating S3 bucket:", err)
+			os.Exit(1)
+		}
+		report("content", "s3", webtest.CheckContentService(ctx, func(context.Context) (web.VideoContentService, error) {
+			return web.NewS3VideoContentService(*s3Bucket)
+		}))
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d checks failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("all checks passed")
+}
+
+// userStores adapts a metadata factory whose services store user accounts.
+func userStores(newService webtest.MetadataFactory) webtest.UserStoreFactory {
+	return func(ctx context.Context) (web.UserStore, error) {
+		svc, err := newService(ctx)
+		if err != nil {
+			return nil, err
+		}
+		store, ok := svc.(web.UserStore)
+		if !ok {
+			return nil, fmt.Errorf("%T does not store user accounts", svc)
+		}
+		return store, nil
+	}
+}
+
+// aclStores adapts a metadata factory whose services store grants.
+func aclStores(newService webtest.MetadataFactory) webtest.ACLStoreFactory {
+	return func(ctx context.Context) (web.ACLStore, error) {
+		svc, err := newService(ctx)
+		if err != nil {
+			return nil, err
+		}
+		store, ok := svc.(web.ACLStore)
+		if !ok {
+			return nil, fmt.Errorf("%T does not store grants", svc)
+		}
+		return store, nil
+	}
+}
+
+// setLocalCredentials fills in dummy AWS credentials and a region, which
+// local stand-ins accept but the SDK insists on, unless some are set already.
+func setLocalCredentials() {
+	defaults := map[string]string{
+		"AWS_ACCESS_KEY_ID":     "conformance",
+		"AWS_SECRET_ACCESS_KEY": "conformance",
+		"AWS_REGION":            "us-west-1",
+	}
+	for name, value := range defaults {
+		if os.Getenv(name) == "" {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+// startEtcd runs a single-member etcd server on a loopback port with its
+// data in dir and returns its client endpoint and a function that stops it.
+func startEtcd(dir string) (string, func(), error) {
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	// Start-up failures are returned by StartEtcd; at any lower level the
+	// server logs errors for its own listeners being closed on shutdown.
+	cfg.LogLevel = "fatal"
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg.ListenClientUrls = []url.URL{*local}
+	cfg.AdvertiseClientUrls = []url.URL{*local}
+	cfg.ListenPeerUrls = []url.URL{*local}
+	cfg.AdvertisePeerUrls = []url.URL{*local}
+	cfg.InitialCluster = cfg.Name + "=" + local.String()
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		e.Close()
+		return "", nil, errors.New("etcd did not become ready")
+	}
+	return e.Clients[0].Addr().String(), e.Close, nil
+}
+
+// startStorageNodes serves n storage nodes on loopback ports, each with its
+// own data directory under dir, and returns their addresses.
+func startStorageNodes(dir string, n int) ([]string, error) {
+	addrs := make([]string, 0, n)
+	for i := range n {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		node := &storage.Server{Dirs: []string{filepath.Join(dir, fmt.Sprint(i))}}
+		go func() {
+			if err := storage.Serve(lis, node); err != nil {
+				slog.Error("storage node stopped", "addr", lis.Addr(), "error", err)
+			}
+		}()
+		addrs = append(addrs, lis.Addr().String())
+	}
+	return addrs, nil
+}
+
+// ensureBucket creates bucket on the S3 endpoint unless it exists.
+func ensureBucket(ctx context.Context, endpoint, bucket string) error {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = true
+	})
+	_, err = client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	var owned *s3types.BucketAlreadyOwnedByYou
+	var exists *s3types.BucketAlreadyExists
+	if errors.As(err, &owned) || errors.As(err, &exists) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"tritontube/internal/web"
+)
+
+func printUsage() {
+	types := strings.Join(web.MetadataServiceTypes, ", ")
+	fmt.Println("Usage:")
+	fmt.Println("  metadata export [-o FILE] TYPE OPTIONS")
+	fmt.Println("  metadata import [-dry-run] [-on-conflict=skip|overwrite|fail] [-verify] TYPE OPTIONS [FILE]")
+	fmt.Println("  metadata migrate [-dry-run] [-on-conflict=skip|overwrite|fail] [-verify] SRC_TYPE SRC_OPTIONS DST_TYPE DST_OPTIONS")
+	fmt.Println("  metadata verify TYPE OPTIONS FILE")
+	fmt.Println()
+	fmt.Println("Copies video metadata and grants between backends through a versioned JSON Lines")
+	fmt.Println("export. TYPE is one of", types+"; OPTIONS are the same as for the web server.")
+	fmt.Println("export writes to stdout and import reads from stdin unless a file is given.")
+	fmt.Println()
+	fmt.Println("Example: metadata export -o videos.jsonl sqlite metadata.db")
+	fmt.Println("Example: metadata import -on-conflict=skip -verify dynamodb my-table videos.jsonl")
+	fmt.Println("Example: metadata migrate -dry-run sqlite metadata.db etcd localhost:2379")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "export":
+		err = runExport(ctx, args)
+	case "import":
+		err = runImport(ctx, args)
+	case "migrate":
+		err = runMigrate(ctx, args)
+	case "verify":
+		err = runVerify(ctx, args)
+	case "help", "-h", "-help", "--help":
+		printUsage()
+		return
+	default:
+		fmt.Println("Unknown command:", cmd)
+		printUsage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "", "Write the export to this file instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("export needs TYPE and OPTIONS")
+	}
+
+	svc, err := web.OpenVideoMetadataService(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer closeService(svc)
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := web.ExportMetadata(ctx, svc, w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d videos\n", n)
+	return nil
+}
+
+// importFlags are shared by import and migrate.
+type importFlags struct {
+	dryRun     *bool
+	onConflict *string
+	verify     *bool
+}
+
+func addImportFlags(fs *flag.FlagSet) importFlags {
+	return importFlags{
+		dryRun:     fs.Bool("dry-run", false, "Report what would be imported without writing anything"),
+		onConflict: fs.String("on-conflict", "fail", "What to do with videos that already exist with different metadata: skip, overwrite or fail"),
+		verify:     fs.Bool("verify", false, "After importing, check that every exported video matches the destination"),
+	}
+}
+
+func (f importFlags) options() (web.ImportOptions, error) {
+	policy, err := web.ParseConflictPolicy(*f.onConflict)
+	if err != nil {
+		return web.ImportOptions{}, err
+	}
+	if *f.dryRun && *f.verify {
+		return web.ImportOptions{}, fmt.Errorf("-verify cannot be combined with -dry-run")
+	}
+	return web.ImportOptions{OnConflict: policy, DryRun: *f.dryRun}, nil
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	flags := addImportFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 && fs.NArg() != 3 {
+		return fmt.Errorf("import needs TYPE, OPTIONS and optionally FILE")
+	}
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+	path := fs.Arg(2)
+	if *flags.verify && path == "" {
+		return fmt.Errorf("-verify re-reads the export, so it needs a FILE rather than stdin")
+	}
+
+	svc, err := web.OpenVideoMetadataService(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer closeService(svc)
+
+	open := func() (io.ReadCloser, error) {
+		if path == "" {
+			return os.Stdin, nil
+		}
+		return os.Open(path)
+	}
+
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	stats, err := web.ImportMetadata(ctx, svc, r, opts)
+	r.Close()
+	printStats(stats, opts.DryRun)
+	if err != nil || !*flags.verify {
+		return err
+	}
+
+	return verify(ctx, svc, open)
+}
+
+func runMigrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags := addImportFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 4 {
+		return fmt.Errorf("migrate needs SRC_TYPE, SRC_OPTIONS, DST_TYPE and DST_OPTIONS")
+	}
+	opts, err := flags.options()
+	if err != nil {
+		return err
+	}
+
+	src, err := web.OpenVideoMetadataService(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer closeService(src)
+	dst, err := web.OpenVideoMetadataService(fs.Arg(2), fs.Arg(3))
+	if err != nil {
+		return err
+	}
+	defer closeService(dst)
+
+	// Stream the source straight into the destination without an
+	// intermediate file.
+	open := func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := web.ExportMetadata(ctx, src, pw)
+			pw.CloseWithError(err)
+		}()
+		return pr, nil
+	}
+
+	r, _ := open()
+	stats, err := web.ImportMetadata(ctx, dst, r, opts)
+	r.Close()
+	printStats(stats, opts.DryRun)
+	if err != nil || !*flags.verify {
+		return err
+	}
+
+	return verify(ctx, dst, open)
+}
+
+func runVerify(ctx context.Context, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("verify needs TYPE, OPTIONS and FILE")
+	}
+	svc, err := web.OpenVideoMetadataService(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	defer closeService(svc)
+
+	return verify(ctx, svc, func() (io.ReadCloser, error) { return os.Open(args[2]) })
+}
+
+// verify compares the export opened by open against svc and fails if any
+// video is missing or differs.
+func verify(ctx context.Context, svc web.VideoMetadataService, open func() (io.ReadCloser, error)) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	n, mismatches, err := web.VerifyMetadata(ctx, svc, r)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	for _, m := range mismatches {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", m.Id, m.Reason)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d of %d videos do not match the export", len(mismatches), n)
+	}
+	fmt.Fprintf(os.Stderr, "Verified %d videos\n", n)
+	return nil
+}
+
+func printStats(stats web.ImportStats, dryRun bool) {
+	prefix := "Imported"
+	if dryRun {
+		prefix = "Dry run, would import"
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d created, %d overwritten, %d skipped, %d unchanged\n",
+		prefix, stats.Created, stats.Overwritten, stats.Skipped, stats.Unchanged)
+}
+
+func closeService(svc web.VideoMetadataService) {
+	if closer, ok := svc.(io.Closer); ok {
+		closer.Close()
+	}
+}
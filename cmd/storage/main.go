@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
+	"tritontube/internal/encryption"
 	"tritontube/internal/storage"
 )
 
@@ -14,6 +19,12 @@ func main() {
 
 	host := flag.String("host", "localhost", "Host address for the server")
 	port := flag.Int("port", 8090, "Port number for the server")
+	minFreeMB := flag.Uint64("min-free-mb", 1024, "Switch to read-only when free disk space drops below this many MiB (0 disables the threshold)")
+	keyfile := flag.String("keyfile", "", "Path to a keyfile enabling AES-GCM encryption at rest (optional)")
+	requireEncrypted := flag.Bool("require-encrypted", false, "Refuse to serve unencrypted files, once all of them have been encrypted (needs -keyfile)")
+	adminAddr := flag.String("admin-addr", "", "Admin gRPC address of the web server to self-register with (optional)")
+	advertise := flag.String("advertise", "", "Address the web server should use to reach this node (default host:port)")
+	heartbeatInterval := flag.Duration("heartbeat-interval", 10*time.Second, "Interval between heartbeats sent to the admin server")
 	flag.Parse()
 
 	// Validate arguments
@@ -22,18 +33,52 @@ func main() {
 	}
 
 	if flag.NArg() < 1 {
-		fmt.Println("Usage: storage [OPTIONS] <baseDir>")
-		fmt.Println("Error: Base directory argument is required")
+		fmt.Println("Usage: storage [OPTIONS] <dataDir> [<dataDir>...]")
+		fmt.Println("Error: At least one data directory argument is required")
 		return
 	}
-	baseDir := flag.Arg(0)
+	dataDirs := flag.Args()
 
 	fmt.Println("Starting storage server...")
 	fmt.Printf("Host: %s\n", *host)
 	fmt.Printf("Port: %d\n", *port)
-	fmt.Printf("Base Directory: %s\n", baseDir)
+	fmt.Printf("Data Directories: %s\n", strings.Join(dataDirs, ", "))
+	fmt.Printf("Read-only below: %d MiB free\n", *minFreeMB)
 
-	if err := storage.StartServer(*host, *port, baseDir); err != nil {
+	server := &storage.Server{Dirs: dataDirs, MinFreeBytes: *minFreeMB << 20}
+	if *keyfile == "" && *requireEncrypted {
+		slog.Error("-require-encrypted needs -keyfile")
+		os.Exit(1)
+	}
+	if *keyfile != "" {
+		keyring, err := encryption.LoadKeyring(*keyfile)
+		if err != nil {
+			slog.Error("failed to load keyfile", "path", *keyfile, "error", err)
+			os.Exit(1)
+		}
+		keyring.RequireSealed(*requireEncrypted)
+		server.Keyring = keyring
+		fmt.Printf("Encryption at rest: enabled (active key version %d)\n", keyring.ActiveVersion())
+	}
+
+	if *adminAddr != "" {
+		advertiseAddr := *advertise
+		if advertiseAddr == "" {
+			advertiseAddr = fmt.Sprintf("%s:%d", *host, *port)
+		}
+		fmt.Printf("Self-registering with %s as %s\n", *adminAddr, advertiseAddr)
+
+		go func() {
+			err := server.RunHeartbeats(context.Background(), *adminAddr, advertiseAddr, *heartbeatInterval)
+			if errors.Is(err, storage.ErrRegistrationRejected) {
+				slog.Error("the admin server rejected this node, add it to the allowlist and restart it to register again", "admin", *adminAddr, "node", advertiseAddr)
+			} else if err != nil {
+				slog.Error("heartbeat agent stopped", "error", err)
+			}
+		}()
+	}
+
+	if err := storage.StartServer(*host, *port, server); err != nil {
 		slog.Error("failed to start storage server", "error", err)
 		os.Exit(1)
 	}
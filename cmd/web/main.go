@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
 	"net"
 	"os"
 	"strings"
+	"time"
+	"tritontube/internal/encryption"
 	"tritontube/internal/proto"
 	"tritontube/internal/web"
 
@@ -18,16 +21,24 @@ func printUsage() {
 	fmt.Println("Usage: ./program [OPTIONS] METADATA_TYPE METADATA_OPTIONS CONTENT_TYPE CONTENT_OPTIONS")
 	fmt.Println()
 	fmt.Println("Arguments:")
-	fmt.Println("  METADATA_TYPE         Metadata service type (sqlite, dynamodb)")
-	fmt.Println("  METADATA_OPTIONS      Options for metadata service (e.g., db path or DynamoDB table name)")
+	fmt.Println("  METADATA_TYPE         Metadata service type (sqlite, dynamodb, etcd, memory)")
+	fmt.Println("  METADATA_OPTIONS      Options for metadata service (e.g., db path, DynamoDB table name, or etcd endpoints)")
 	fmt.Println("  CONTENT_TYPE          Content service type (fs, nw, s3)")
 	fmt.Println("  CONTENT_OPTIONS       Options for content service (e.g., base dir, network addresses, or S3 bucket)")
 	fmt.Println()
 	fmt.Println("Options:")
 	flag.PrintDefaults()
 	fmt.Println()
+	fmt.Println("Environment:")
+	fmt.Println("  JWT_HMAC_SECRET       Accept HS256 bearer tokens signed with this secret (optional, at least 32 bytes)")
+	fmt.Println("  CORS_ALLOWED_ORIGINS  Origins allowed to make cross-origin requests, if -cors-origins is not given")
+	fmt.Println("  TRUST_FORWARDED_FOR   Set to true behind a load balancer to rate limit by X-Forwarded-For")
+	fmt.Println("  CONTENT_SIGNING_KEY   Key for private videos' content URLs, the same on every instance (at least 32 bytes)")
+	fmt.Println()
 	fmt.Println("Example: ./program sqlite db.db s3 my-bucket")
 	fmt.Println("Example: ./program dynamodb my-table s3 my-bucket")
+	fmt.Println("Example: ./program etcd localhost:2379,localhost:22379 nw localhost:8090,localhost:8091")
+	fmt.Println("Example: ./program -migrate-only sqlite db.db")
 }
 
 func main() {
@@ -37,6 +48,42 @@ func main() {
 	port := flag.Int("port", 8080, "Port number for the web server")
 	host := flag.String("host", "localhost", "Host address for the web server")
 	adminPort := flag.Int("admin-port", 8081, "Port number for the admin gRPC server (for managing storage nodes)")
+	nodeApproval := flag.String("node-approval", "manual", "How self-registering storage nodes are admitted: auto, manual or allowlist")
+	nodeAllowlist := flag.String("node-allowlist", "", "Comma-separated storage node addresses admitted in allowlist mode")
+	contentReplicas := flag.Int("content-replicas", 2, "Storage nodes each file is written to with the nw content service; with 2 or more, files on a failed disk are copied back from the others")
+	heartbeatTimeout := flag.Duration("heartbeat-timeout", 30*time.Second, "Flag storage nodes as stale when no heartbeat arrives within this duration")
+	contentKeyfile := flag.String("content-keyfile", "", "Path to a keyfile enabling encryption at rest for the fs content service (optional)")
+	contentRequireEncrypted := flag.Bool("content-require-encrypted", false, "Refuse to serve unencrypted files from the fs content service, once all of them have been encrypted (needs -content-keyfile)")
+	dynamoCreateTable := flag.Bool("dynamodb-create-table", false, "Create the DynamoDB metadata table and its indexes if missing (for DynamoDB Local)")
+	trashRetention := flag.Duration("trash-retention", 7*24*time.Hour, "How long deleted videos stay restorable before their content and metadata are purged (0 keeps them forever)")
+	purgeInterval := flag.Duration("purge-interval", time.Hour, "How often to look for trashed videos past the retention window")
+	metadataTimeout := flag.Duration("metadata-timeout", 5*time.Second, "Deadline for each metadata service call (0 disables)")
+	contentTimeout := flag.Duration("content-timeout", 30*time.Second, "Deadline for each content service call (0 disables)")
+	storageRPCTimeout := flag.Duration("storage-rpc-timeout", 5*time.Second, "Deadline for each gRPC call to a storage node (nw content service only)")
+	metadataCacheSize := flag.Int("metadata-cache-size", 1024, "Number of metadata lookups to cache in memory (0 disables the cache)")
+	metadataCacheTTL := flag.Duration("metadata-cache-ttl", 5*time.Second, "How long a cached metadata lookup is served before it is read again")
+	accounts := flag.Bool("accounts", true, "Enable user accounts and require sign-in to upload, edit and delete videos")
+	sessionTTL := flag.Duration("session-ttl", 24*time.Hour, "How long a sign-in lasts")
+	adminUsers := flag.String("admin-users", "", "Comma-separated usernames whose sign-ins get the admin scope")
+	apiKeysFile := flag.String("api-keys", "", "Path to a file of API keys, one \"NAME USER_ID SHA256 SCOPES\" per line (optional)")
+	generateAPIKey := flag.Bool("generate-api-key", false, "Print a new API key and its hash for the -api-keys file, and exit")
+	jwtPublicKey := flag.String("jwt-public-key", "", "Path to a PEM RSA public key; accepts RS256 bearer tokens signed with it (optional)")
+	jwtIssuer := flag.String("jwt-issuer", "", "Reject bearer tokens whose iss claim differs (optional)")
+	jwtAudience := flag.String("jwt-audience", "", "Reject bearer tokens whose aud claim does not include this (optional)")
+	groupsFile := flag.String("groups", "", "Path to a file of groups videos can be shared with, one \"GROUP USERNAME,USERNAME,...\" per line (optional)")
+	authPolicy := flag.String("auth-policy", "", "Path to a JSON list of per-route access rules that take precedence over the defaults (optional)")
+	corsOrigins := flag.String("cors-origins", "", "Comma-separated origins allowed to make cross-origin requests, e.g. https://*.example.com (default $CORS_ALLOWED_ORIGINS, or "+strings.Join(web.DefaultCORSOrigins, ",")+")")
+	corsRules := flag.String("cors-rules", "", "Path to a JSON list of per-route CORS methods and headers replacing the defaults (optional)")
+	rateRead := flag.String("rate-read", "600/1m", "Requests each client may make that are not uploads or deletes, as N/DURATION (0 disables)")
+	rateUpload := flag.String("rate-upload", "20/1h", "Uploads each client may start, as N/DURATION (0 disables)")
+	rateDelete := flag.String("rate-delete", "60/1h", "Deletes each client may make, as N/DURATION (0 disables)")
+	rateAuth := flag.String("rate-auth", "20/1m", "Sign-ins, registrations and rejected credentials each IP address may make, as N/DURATION (0 disables)")
+	trustForwardedFor := flag.Bool("trust-forwarded-for", os.Getenv("TRUST_FORWARDED_FOR") == "true", "Rate limit anonymous clients by the address a load balancer adds to X-Forwarded-For (default $TRUST_FORWARDED_FOR)")
+	transcodeConcurrency := flag.Int("transcode-concurrency", 2, "Videos this server transcodes at once; uploads beyond that get 503 (0 is unlimited)")
+	transcodeRetryAfter := flag.Duration("transcode-retry-after", time.Minute, "Retry-After sent with 503 when all transcode slots are busy")
+	signedURLTTL := flag.Duration("signed-url-ttl", web.DefaultSignedURLTTL, "How long the signed content URLs of private videos stay valid")
+	corsMaxAge := flag.Duration("cors-max-age", web.DefaultCORSMaxAge, "How long browsers may cache a CORS preflight response")
+	migrateOnly := flag.Bool("migrate-only", false, "Apply pending SQLite metadata schema migrations and exit (content arguments may be omitted)")
 
 	// Set custom usage message
 	flag.Usage = printUsage
@@ -44,10 +91,18 @@ func main() {
 	// Parse flags
 	flag.Parse()
 
+	if *generateAPIKey {
+		key, hash := web.GenerateAPIKey()
+		fmt.Println("API key (give this to the client, it is not stored):", key)
+		fmt.Println("Line for the -api-keys file (fill in NAME, USER_ID and scopes):")
+		fmt.Println("NAME USER_ID", hash, "-")
+		return
+	}
+
 	// Get configuration from command-line arguments or environment variables
 	var metadataServiceType, metadataServiceOptions, contentServiceType, contentServiceOptions string
 
-	if len(flag.Args()) == 4 {
+	if len(flag.Args()) == 4 || (*migrateOnly && len(flag.Args()) == 2) {
 		// Use command-line arguments
 		metadataServiceType = flag.Arg(0)
 		metadataServiceOptions = flag.Arg(1)
@@ -61,7 +116,7 @@ func main() {
 		contentServiceOptions = os.Getenv("CONTENT_OPTIONS")
 
 		// Validate that environment variables are set
-		if metadataServiceType == "" || contentServiceType == "" {
+		if metadataServiceType == "" || (contentServiceType == "" && !*migrateOnly) {
 			fmt.Println("Error: Configuration must be provided via command-line arguments or environment variables")
 			fmt.Println("Required environment variables: METADATA_TYPE, METADATA_OPTIONS, CONTENT_TYPE, CONTENT_OPTIONS")
 			printUsage()
@@ -76,28 +131,70 @@ func main() {
 		return
 	}
 
+	if *purgeInterval <= 0 {
+		fmt.Println("Error: -purge-interval must be positive")
+		return
+	}
+
+	if *metadataTimeout < 0 || *contentTimeout < 0 {
+		fmt.Println("Error: -metadata-timeout and -content-timeout must not be negative")
+		return
+	}
+	if *metadataCacheSize < 0 || *metadataCacheTTL < 0 {
+		fmt.Println("Error: -metadata-cache-size and -metadata-cache-ttl must not be negative")
+		return
+	}
+	if *sessionTTL <= 0 {
+		fmt.Println("Error: -session-ttl must be positive")
+		return
+	}
+	if *storageRPCTimeout <= 0 {
+		fmt.Println("Error: -storage-rpc-timeout must be positive")
+		return
+	}
+
+	if *migrateOnly && metadataServiceType != "sqlite" {
+		fmt.Printf("Error: -migrate-only only applies to the sqlite metadata service, not %s\n", metadataServiceType)
+		return
+	}
+
 	// Construct metadata service
-	var metadataService web.VideoMetadataService
 	fmt.Println("Creating metadata service of type", metadataServiceType, "with options", metadataServiceOptions)
 
-	switch metadataServiceType {
-	case "sqlite":
-		var err error
-		metadataService, err = web.NewSQLiteVideoMetadataService(metadataServiceOptions)
-		if err != nil {
-			fmt.Printf("Error creating SQLite metadata service: %v\n", err)
+	metadataService, err := web.OpenVideoMetadataService(metadataServiceType, metadataServiceOptions)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	switch svc := metadataService.(type) {
+	case *web.SQLiteVideoMetadataService:
+		if *migrateOnly {
+			version, err := svc.SchemaVersion()
+			if err != nil {
+				fmt.Printf("Error reading schema version: %v\n", err)
+				return
+			}
+			fmt.Println("Metadata schema is at version", version)
 			return
 		}
-	case "dynamodb":
-		var err error
-		metadataService, err = web.NewDynamoDBVideoMetadataService(metadataServiceOptions)
-		if err != nil {
-			fmt.Printf("Error creating DynamoDB metadata service: %v\n", err)
-			return
+	case *web.DynamoDBVideoMetadataService:
+		if *dynamoCreateTable {
+			if err := svc.CreateTable(context.Background()); err != nil {
+				fmt.Printf("Error creating DynamoDB table: %v\n", err)
+				return
+			}
 		}
-	default:
-		fmt.Printf("Error: Unsupported metadata service type: %s\n", metadataServiceType)
-		return
+		// Items written before the list index existed need its key to be
+		// listed; this is a no-op once every item has it.
+		go func() {
+			n, err := svc.BackfillListKey(context.Background())
+			if err != nil {
+				slog.Warn("failed to backfill DynamoDB list index key", "error", err)
+			} else if n > 0 {
+				slog.Info("backfilled DynamoDB list index key", "items", n)
+			}
+		}()
 	}
 
 	// Construct content service
@@ -106,7 +203,22 @@ func main() {
 
 	switch contentServiceType {
 	case "fs":
-		contentService = web.NewFSVideoContentService(contentServiceOptions)
+		if *contentKeyfile == "" && *contentRequireEncrypted {
+			fmt.Println("Error: -content-require-encrypted needs -content-keyfile")
+			return
+		}
+		if *contentKeyfile == "" {
+			contentService = web.NewFSVideoContentService(contentServiceOptions)
+			break
+		}
+
+		keyring, err := encryption.LoadKeyring(*contentKeyfile)
+		if err != nil {
+			fmt.Printf("Error loading content keyfile: %v\n", err)
+			return
+		}
+		keyring.RequireSealed(*contentRequireEncrypted)
+		contentService = web.NewEncryptedFSVideoContentService(contentServiceOptions, keyring)
 	case "s3":
 		// contentServiceOptions should be the S3 bucket name
 		var err error
@@ -130,8 +242,22 @@ func main() {
 			return
 		}
 
+		svc.SetRPCTimeout(*storageRPCTimeout)
+		svc.SetReplicas(*contentReplicas)
 		contentService = svc
 
+		approvalMode, err := web.ParseApprovalMode(*nodeApproval)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		policy := web.NodeApprovalPolicy{Mode: approvalMode}
+		if *nodeAllowlist != "" {
+			policy.Allowlist = strings.Split(*nodeAllowlist, ",")
+		}
+		svc.SetNodeApprovalPolicy(policy)
+		svc.StartHeartbeatMonitor(context.Background(), *heartbeatTimeout)
+
 		// Start admin gRPC server for managing storage nodes (add/remove/list)
 		adminAddr := fmt.Sprintf("%s:%d", *host, *adminPort)
 		go func() {
@@ -156,8 +282,174 @@ func main() {
 		return
 	}
 
+	// Watching, user accounts and sharing are optional and hidden by the
+	// decorators below, so look for them on the service itself.
+	var users web.UserStore
+	if *accounts {
+		var ok bool
+		if users, ok = metadataService.(web.UserStore); !ok {
+			fmt.Printf("Error: the %s metadata service cannot store user accounts, run with -accounts=false\n", metadataServiceType)
+			return
+		}
+	}
+
+	acl, _ := metadataService.(web.ACLStore)
+
+	var changes *web.ChangeHub
+	if watcher, ok := metadataService.(web.VideoMetadataWatcher); ok {
+		changes = web.NewChangeHub(watcher)
+		go changes.Run(context.Background())
+	} else {
+		slog.Warn("metadata service cannot be watched, /api/events is disabled", "type", metadataServiceType)
+	}
+
+	// Private videos stored in S3 are played from presigned URLs. The
+	// timeout wrapper hides the method, so look for it first.
+	presigner, _ := contentService.(web.ContentURLPresigner)
+
+	metadataService = web.WithMetadataTimeout(metadataService, *metadataTimeout)
+	metadataService = web.WithMetadataCache(metadataService, web.MetadataCacheOptions{Size: *metadataCacheSize, TTL: *metadataCacheTTL, Changes: changes})
+	contentService = web.WithContentTimeout(contentService, *contentTimeout)
+
+	if *trashRetention > 0 {
+		purger := web.NewPurger(metadataService, contentService, *trashRetention)
+		go purger.Run(context.Background(), *purgeInterval)
+	}
+
+	// Authentication: sessions of signed-in users, API keys and bearer
+	// tokens, any of which may be enabled.
+	authOpts := web.AuthOptions{}
+	if *adminUsers != "" {
+		authOpts.AdminUsers = strings.Split(*adminUsers, ",")
+	}
+	if users != nil {
+		authOpts.Sessions = web.NewSessionStore(*sessionTTL)
+	}
+	if *groupsFile != "" {
+		groups, err := web.LoadGroups(*groupsFile)
+		if err != nil {
+			fmt.Printf("Error loading groups: %v\n", err)
+			return
+		}
+		authOpts.Groups = groups
+	}
+	if *apiKeysFile != "" {
+		keys, err := web.LoadAPIKeys(*apiKeysFile)
+		if err != nil {
+			fmt.Printf("Error loading API keys: %v\n", err)
+			return
+		}
+		authOpts.APIKeys = keys
+	}
+	// The HS256 secret comes from the environment so it stays out of
+	// process listings.
+	jwtConfig := web.JWTConfig{Issuer: *jwtIssuer, Audience: *jwtAudience, Leeway: time.Minute}
+	if secret := os.Getenv("JWT_HMAC_SECRET"); secret != "" {
+		jwtConfig.HMACSecret = []byte(secret)
+	}
+	if *jwtPublicKey != "" {
+		key, err := web.LoadRSAPublicKey(*jwtPublicKey)
+		if err != nil {
+			fmt.Printf("Error loading JWT public key: %v\n", err)
+			return
+		}
+		jwtConfig.RSAPublicKey = key
+	}
+	if jwtConfig.HMACSecret != nil || jwtConfig.RSAPublicKey != nil {
+		verifier, err := web.NewJWTVerifier(jwtConfig)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		authOpts.JWT = verifier
+	}
+	var routes *web.RoutePolicy
+	if *authPolicy != "" {
+		if routes, err = web.LoadRoutePolicy(*authPolicy); err != nil {
+			fmt.Printf("Error loading auth policy: %v\n", err)
+			return
+		}
+	}
+
+	corsOpts := web.CORSOptions{AllowedOrigins: web.DefaultCORSOrigins, MaxAge: *corsMaxAge}
+	if *corsOrigins == "" {
+		*corsOrigins = os.Getenv("CORS_ALLOWED_ORIGINS")
+	}
+	if *corsOrigins != "" {
+		corsOpts.AllowedOrigins = strings.Split(*corsOrigins, ",")
+	}
+	if *corsRules != "" {
+		if corsOpts.Rules, err = web.LoadCORSRules(*corsRules); err != nil {
+			fmt.Printf("Error loading CORS rules: %v\n", err)
+			return
+		}
+	}
+	cors, err := web.NewCORSPolicy(corsOpts)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	rateOpts := web.RateLimitOptions{TrustForwardedFor: *trustForwardedFor}
+	for _, limit := range []struct {
+		flag  string
+		value string
+		dst   *web.RateLimit
+	}{
+		{"-rate-read", *rateRead, &rateOpts.Read},
+		{"-rate-upload", *rateUpload, &rateOpts.Upload},
+		{"-rate-delete", *rateDelete, &rateOpts.Delete},
+		{"-rate-auth", *rateAuth, &rateOpts.Auth},
+	} {
+		if *limit.dst, err = web.ParseRateLimit(limit.value); err != nil {
+			fmt.Printf("Error: %s: %v\n", limit.flag, err)
+			return
+		}
+	}
+	if *transcodeConcurrency < 0 || *transcodeRetryAfter <= 0 {
+		fmt.Println("Error: -transcode-concurrency must not be negative and -transcode-retry-after must be positive")
+		return
+	}
+
+	// The signing key comes from the environment, like the JWT secret.
+	var signingKey []byte
+	if key := os.Getenv("CONTENT_SIGNING_KEY"); key != "" {
+		signingKey = []byte(key)
+	} else {
+		slog.Warn("CONTENT_SIGNING_KEY is not set, private video links will break on restart and across instances")
+	}
+	signer, err := web.NewContentSigner(signingKey, *signedURLTTL)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
 	// Start the server
 	server := web.NewServer(metadataService, contentService)
+	server.SetContentSigner(signer)
+	if presigner != nil {
+		server.SetContentPresigner(presigner)
+	}
+	server.SetCORSPolicy(cors)
+	server.SetRateLimits(web.NewRateLimits(rateOpts))
+	if *transcodeConcurrency > 0 {
+		server.SetTranscodeLimiter(web.NewTranscodeLimiter(*transcodeConcurrency, *transcodeRetryAfter))
+	}
+	if changes != nil {
+		server.SetChangeHub(changes)
+	}
+	if users != nil {
+		server.SetUsers(users, authOpts.Sessions)
+	}
+	if acl != nil {
+		server.SetACLStore(acl)
+	}
+	if authOpts.Sessions != nil || authOpts.APIKeys != nil || authOpts.JWT != nil {
+		server.SetAuthenticator(web.NewAuthenticator(authOpts), routes)
+	} else if routes != nil {
+		fmt.Println("Error: -auth-policy needs accounts, API keys or JWTs to authenticate with")
+		return
+	}
 	listenAddr := fmt.Sprintf("%s:%d", *host, *port)
 	lis, err := net.Listen("tcp", listenAddr)
 
@@ -4,32 +4,55 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"tritontube/internal/web"
 )
 
 func main() {
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 
+	// Stop taking jobs on SIGINT or SIGTERM; a job cut short keeps its
+	// message, so it is retried once the visibility timeout expires.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	metadataTimeout, err := durationFromEnv("METADATA_TIMEOUT", 5*time.Second)
+	if err != nil {
+		slog.Error("invalid METADATA_TIMEOUT", "error", err)
+		os.Exit(1)
+	}
+	storageTimeout, err := durationFromEnv("S3_TIMEOUT", 5*time.Minute)
+	if err == nil && storageTimeout == 0 {
+		err = errors.New("S3_TIMEOUT must be positive")
+	}
+	if err != nil {
+		slog.Error("invalid S3_TIMEOUT", "error", err)
+		os.Exit(1)
+	}
+
 	queueURL := os.Getenv("SQS_QUEUE_URL")
 	if queueURL == "" {
 		slog.Error("SQS_QUEUE_URL not set")
 		os.Exit(1)
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		slog.Error("failed to load aws config", "error", err)
 		os.Exit(1)
@@ -37,21 +60,29 @@ func main() {
 
 	sqsClient := sqs.NewFromConfig(cfg)
 	s3Client := s3.NewFromConfig(cfg)
-	dynamoClient := dynamodb.NewFromConfig(cfg)
 
 	tableName := os.Getenv("METADATA_OPTIONS")
 	if tableName == "" {
 		tableName = "tritontube-video-metadata"
 	}
+	dynamoService, err := web.NewDynamoDBVideoMetadataService(tableName)
+	if err != nil {
+		slog.Error("failed to create metadata service", "error", err)
+		os.Exit(1)
+	}
+	metadataService := web.WithMetadataTimeout(dynamoService, metadataTimeout)
 
-	for {
+	for ctx.Err() == nil {
 		// Receive messages
-		out, err := sqsClient.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
+		out, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
 			QueueUrl:            &queueURL,
 			MaxNumberOfMessages: 1,
 			WaitTimeSeconds:     20,
 		})
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			slog.Error("receive message error", "error", err)
 			time.Sleep(5 * time.Second)
 			continue
@@ -65,7 +96,7 @@ func main() {
 			if err := json.Unmarshal([]byte(*m.Body), &payload); err != nil {
 				slog.Error("invalid message body", "error", err)
 				// delete message to avoid poison
-				sqsClient.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
+				sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
 					QueueUrl:      &queueURL,
 					ReceiptHandle: m.ReceiptHandle,
 				})
@@ -78,10 +109,41 @@ func main() {
 
 			// process each message inside a closure so that defers (cleanup) run per-iteration
 			func() {
+				deleteMessage := func() {
+					// deleting must not be cut short once the job is done
+					_, _ = sqsClient.DeleteMessage(context.WithoutCancel(ctx), &sqs.DeleteMessageInput{
+						QueueUrl:      &queueURL,
+						ReceiptHandle: m.ReceiptHandle,
+					})
+				}
+				// fail marks the video failed with reason; the message is kept
+				// so the job is retried, which moves the video back to transcoding
+				fail := func(reason string, err error, args ...any) {
+					jobLog.Error(reason, append([]any{"error", err}, args...)...)
+					if ctx.Err() != nil {
+						// shutting down; the retry will pick the job up again
+						return
+					}
+					if err := web.TransitionStatus(ctx, metadataService, payload.VideoId, web.StatusFailed, reason); err != nil {
+						jobLog.Error("failed to mark video failed", "error", err)
+					}
+				}
+
+				if err := web.TransitionStatus(ctx, metadataService, payload.VideoId, web.StatusTranscoding, ""); err != nil {
+					if errors.Is(err, web.ErrNotFound) || errors.Is(err, web.ErrInvalidTransition) {
+						// deleted, or already processed by an earlier delivery
+						jobLog.Warn("skipping job", "error", err)
+						deleteMessage()
+						return
+					}
+					jobLog.Error("failed to mark video transcoding", "error", err)
+					return
+				}
+
 				// create tmp dir
 				tmp, err := os.MkdirTemp("", "proc-*")
 				if err != nil {
-					jobLog.Error("mkdir temp failed", "error", err)
+					fail("mkdir temp failed", err)
 					return
 				}
 				defer os.RemoveAll(tmp)
@@ -92,33 +154,44 @@ func main() {
 				if uploadsBucket == "" {
 					uploadsBucket = "tritontube-uploads"
 				}
-				getResp, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+				downloadCtx, cancelDownload := context.WithTimeout(ctx, storageTimeout)
+				defer cancelDownload()
+				getResp, err := s3Client.GetObject(downloadCtx, &s3.GetObjectInput{
 					Bucket: aws.String(uploadsBucket),
 					Key:    &srcKey,
 				})
 				if err != nil {
-					jobLog.Error("s3 get object failed", "key", srcKey, "error", err)
 					// do not delete the message so it can be retried
+					fail("s3 get object failed", err, "key", srcKey)
 					return
 				}
 				localPath := filepath.Join(tmp, payload.Filename)
 				outf, err := os.Create(localPath)
 				if err != nil {
-					jobLog.Error("create local file failed", "path", localPath, "error", err)
+					fail("create local file failed", err, "path", localPath)
 					getResp.Body.Close()
 					return
 				}
 				_, err = io.Copy(outf, getResp.Body)
 				outf.Close()
 				getResp.Body.Close()
+				cancelDownload()
 				if err != nil {
-					jobLog.Error("copy local failed", "error", err)
+					fail("copy local failed", err)
 					return
 				}
 
+				// record duration, resolution and codecs of the source file
+				info, err := web.ProbeMediaInfo(ctx, localPath)
+				if err != nil {
+					jobLog.Warn("ffprobe failed", "error", err)
+				} else if err := metadataService.UpdateMediaInfo(ctx, payload.VideoId, info); err != nil {
+					jobLog.Error("failed to update media info", "error", err)
+				}
+
 				// run ffmpeg with optimizations for faster processing
 				manifestPath := filepath.Join(tmp, "manifest.mpd")
-				cmd := exec.Command("ffmpeg",
+				cmd := exec.CommandContext(ctx, "ffmpeg",
 					"-i", localPath,
 					"-c:v", "libx264",
 					"-preset", "veryfast", // Much faster encoding (was default/medium)
@@ -142,15 +215,19 @@ func main() {
 					manifestPath,
 				)
 				cmd.Dir = tmp
-				outb, err := cmd.CombinedOutput()
+				outb, err := web.RunFFmpegWithProgress(cmd, info.Duration, func(percent int) {
+					if err := web.SetProgress(ctx, metadataService, payload.VideoId, percent); err != nil {
+						jobLog.Warn("failed to save progress", "percent", percent, "error", err)
+					}
+				})
 				if err != nil {
-					jobLog.Error("ffmpeg failed", "error", err, "output", string(outb))
+					fail("ffmpeg failed", err, "output", string(outb))
 					return
 				}
 
 				// Generate thumbnail from first frame
 				thumbnailPath := filepath.Join(tmp, "thumbnail.jpg")
-				thumbnailCmd := exec.Command("ffmpeg",
+				thumbnailCmd := exec.CommandContext(ctx, "ffmpeg",
 					"-i", localPath,
 					"-vframes", "1", // Extract only 1 frame
 					"-ss", "00:00:02", // At 2 seconds (skip black intro frames)
@@ -172,6 +249,14 @@ func main() {
 					}
 				}
 
+				if err := web.TransitionStatus(ctx, metadataService, payload.VideoId, web.StatusPublishing, ""); err != nil {
+					jobLog.Error("cannot publish video", "error", err)
+					if errors.Is(err, web.ErrNotFound) || errors.Is(err, web.ErrInvalidTransition) {
+						deleteMessage()
+					}
+					return
+				}
+
 				// Upload produced files in tmp directory to final content bucket under <videoId>/
 				uploadBucket := os.Getenv("S3_BUCKET_NAME")
 				if uploadBucket == "" {
@@ -180,10 +265,12 @@ func main() {
 
 				files, err := os.ReadDir(tmp)
 				if err != nil {
-					jobLog.Error("failed to list produced files", "error", err)
+					fail("failed to list produced files", err)
 					return
 				}
 
+				var uploadErrs []error
+
 				for _, ff := range files {
 					if ff.IsDir() {
 						continue
@@ -192,6 +279,7 @@ func main() {
 					data, err := os.ReadFile(filepath.Join(tmp, name))
 					if err != nil {
 						jobLog.Error("failed to read produced file", "file", name, "error", err)
+						uploadErrs = append(uploadErrs, err)
 						continue
 					}
 
@@ -205,48 +293,58 @@ func main() {
 						contentType = "image/jpeg"
 					}
 
-					_, err = s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+					putCtx, cancelPut := context.WithTimeout(ctx, storageTimeout)
+					_, err = s3Client.PutObject(putCtx, &s3.PutObjectInput{
 						Bucket:      aws.String(uploadBucket),
 						Key:         aws.String(key),
 						Body:        bytes.NewReader(data),
 						ContentType: aws.String(contentType),
 					})
+					cancelPut()
 					if err != nil {
 						jobLog.Error("failed to upload produced file", "file", name, "error", err)
+						uploadErrs = append(uploadErrs, err)
 						continue
 					}
 					jobLog.Info("uploaded produced file", "bucket", uploadBucket, "key", key)
 				}
 
+				if len(uploadErrs) > 0 {
+					fail(fmt.Sprintf("failed to upload %d produced files", len(uploadErrs)), errors.Join(uploadErrs...))
+					return
+				}
+
 				jobLog.Info("job completed")
 
 				// Update DynamoDB metadata status to ready
-				_, err = dynamoClient.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
-					TableName: aws.String(tableName),
-					Key: map[string]types.AttributeValue{
-						"id": &types.AttributeValueMemberS{Value: payload.VideoId},
-					},
-					UpdateExpression: aws.String("SET #status = :status"),
-					ExpressionAttributeNames: map[string]string{
-						"#status": "status",
-					},
-					ExpressionAttributeValues: map[string]types.AttributeValue{
-						":status": &types.AttributeValueMemberS{Value: "ready"},
-					},
-				})
+				err = web.TransitionStatus(ctx, metadataService, payload.VideoId, web.StatusReady, "")
 				if err != nil {
 					jobLog.Error("failed to update metadata status", "error", err)
 					// Still delete the message since processing succeeded
 				} else {
-					jobLog.Info("metadata status updated", "status", "ready")
+					jobLog.Info("metadata status updated", "status", web.StatusReady)
 				}
 
 				// delete message after success
-				_, _ = sqsClient.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
-					QueueUrl:      &queueURL,
-					ReceiptHandle: m.ReceiptHandle,
-				})
+				deleteMessage()
 			}()
 		}
 	}
 }
+
+// durationFromEnv parses the environment variable name as a time.Duration,
+// returning def if it is unset. Negative durations are rejected.
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+	return d, nil
+}
@@ -0,0 +1,257 @@
+// Package encryption implements AES-GCM envelope encryption for video files at rest.
+//
+// Every sealed file gets a fresh random data key. The data key encrypts the file
+// contents and is itself wrapped with a versioned master key from a Keyring, so
+// rotating the master key only requires adding a new version to the keyfile.
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	keySize   = 32 // AES-256
+	nonceSize = 12
+	tagSize   = 16
+
+	// magic marks a sealed file. Files without it are treated as legacy plaintext.
+	magic = "TTE1"
+
+	wrappedKeySize = nonceSize + keySize + tagSize
+	headerSize     = len(magic) + 4 + wrappedKeySize + nonceSize
+)
+
+// ErrUnknownKeyVersion is returned when a file names a key that is not in the
+// keyring and the keyring requires sealed data. Otherwise such a file is
+// taken to be plaintext that happens to start with the magic.
+var ErrUnknownKeyVersion = errors.New("unknown key version")
+
+// ErrUnsealed is returned by Open for data without the sealed-file header
+// when the keyring requires sealed data.
+var ErrUnsealed = errors.New("data is not encrypted")
+
+// Keyring holds the master keys loaded from a keyfile. The key with the
+// highest version is used for new writes; older versions are kept for reads.
+type Keyring struct {
+	keys          map[uint32][]byte
+	active        uint32
+	requireSealed bool
+	plaintextSeen sync.Once // warns about the first plaintext file only
+}
+
+// LoadKeyring reads a keyfile. Each non-empty line that is not a comment has
+// the form "<version> <base64 32-byte key>". To rotate, append a line with a
+// higher version and restart; files sealed with older keys stay readable.
+func LoadKeyring(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keyfile: %w", err)
+	}
+	defer f.Close()
+
+	kr := &Keyring{keys: make(map[uint32][]byte)}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("keyfile line %d: expected \"<version> <key>\"", lineNo)
+		}
+
+		version, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("keyfile line %d: invalid key version %q", lineNo, fields[0])
+		}
+
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("keyfile line %d: invalid base64 key: %w", lineNo, err)
+		}
+
+		if err := kr.Add(uint32(version), key); err != nil {
+			return nil, fmt.Errorf("keyfile line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+
+	if len(kr.keys) == 0 {
+		return nil, fmt.Errorf("keyfile %s contains no keys", path)
+	}
+
+	return kr, nil
+}
+
+// Add registers a master key under the given version.
+func (kr *Keyring) Add(version uint32, key []byte) error {
+	if len(key) != keySize {
+		return fmt.Errorf("key version %d must be %d bytes, got %d", version, keySize, len(key))
+	}
+	if _, exists := kr.keys[version]; exists {
+		return fmt.Errorf("duplicate key version %d", version)
+	}
+
+	kr.keys[version] = key
+	if version > kr.active {
+		kr.active = version
+	}
+	return nil
+}
+
+// RequireSealed makes Open reject data without the sealed-file header. Turn
+// it on once every file written before encryption was enabled has been
+// rewritten, so that plaintext dropped into storage is not served as if it
+// were authentic.
+func (kr *Keyring) RequireSealed(require bool) {
+	kr.requireSealed = require
+}
+
+// ActiveVersion returns the key version used for new writes.
+func (kr *Keyring) ActiveVersion() uint32 {
+	return kr.active
+}
+
+// Seal encrypts plaintext with a fresh data key wrapped by the active master key.
+// aad binds the ciphertext to its location (e.g. "videoId/filename") so files
+// cannot be swapped around on disk without detection.
+func (kr *Keyring) Seal(plaintext, aad []byte) ([]byte, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	out := make([]byte, 0, headerSize+len(plaintext)+tagSize)
+	out = append(out, magic...)
+	out = binary.BigEndian.AppendUint32(out, kr.active)
+
+	wrapped, err := seal(kr.keys[kr.active], dataKey, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	out = append(out, wrapped...)
+
+	body, err := seal(dataKey, plaintext, append(out[:len(out):len(out)], aad...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	return append(out, body...), nil
+}
+
+// Open decrypts data produced by Seal. Data without the sealed-file header is
+// unauthenticated; unless RequireSealed is set it is returned unchanged so
+// that files written before encryption was enabled remain readable. Such a
+// file may happen to start with the magic, so data whose header is too short
+// or names a key version the keyring never had is treated the same way.
+func (kr *Keyring) Open(data, aad []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return kr.openPlaintext(data, aad, fmt.Errorf("%w: %s", ErrUnsealed, aad))
+	}
+	if len(data) < headerSize+tagSize {
+		return kr.openPlaintext(data, aad, errors.New("sealed data is truncated"))
+	}
+
+	version, _ := KeyVersion(data)
+	masterKey, ok := kr.keys[version]
+	if !ok {
+		return kr.openPlaintext(data, aad, fmt.Errorf("%w: %d", ErrUnknownKeyVersion, version))
+	}
+
+	prefix := len(magic) + 4
+	header := data[:prefix]
+	dataKey, err := open(masterKey, data[prefix:prefix+wrappedKeySize], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	envelope := data[:prefix+wrappedKeySize]
+	plaintext, err := open(dataKey, data[prefix+wrappedKeySize:], append(envelope[:len(envelope):len(envelope)], aad...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// openPlaintext returns data that does not parse as sealed unchanged, or err
+// if the keyring requires sealed data. Plaintext reads are logged at debug
+// level, since hot segments are read constantly, with one warning per
+// keyring so the passthrough is noticed.
+func (kr *Keyring) openPlaintext(data, aad []byte, err error) ([]byte, error) {
+	if kr.requireSealed {
+		return nil, err
+	}
+	kr.plaintextSeen.Do(func() {
+		slog.Warn("serving unencrypted files, set the require-encrypted option once all are rewritten", "first", string(aad))
+	})
+	slog.Debug("serving unencrypted file", "file", string(aad), "reason", err)
+	return data, nil
+}
+
+// IsSealed reports whether data starts with the sealed-file header.
+func IsSealed(data []byte) bool {
+	return len(data) >= len(magic)+4 && string(data[:len(magic)]) == magic
+}
+
+// KeyVersion returns the master key version recorded in sealed data.
+func KeyVersion(data []byte) (uint32, bool) {
+	if !IsSealed(data) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(data[len(magic):]), true
+}
+
+// seal encrypts plaintext with key and returns nonce || ciphertext.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, nonceSize, nonceSize+len(plaintext)+tagSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open decrypts nonce || ciphertext produced by seal.
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < nonceSize+tagSize {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
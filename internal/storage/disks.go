@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"tritontube/internal/proto"
+)
+
+// disk is one data directory managed by a storage node, usually a whole
+// physical disk mounted on its own.
+type disk struct {
+	path   string
+	failed bool
+	reason string
+}
+
+// diskSet spreads files over several data directories (JBOD). A disk that
+// starts failing I/O is marked failed and skipped from then on, so the
+// process keeps serving from the remaining disks. Failed disks are counted
+// in heartbeats; the web tier then copies the files the node should hold
+// back onto its remaining disks from the other replicas.
+type diskSet struct {
+	mu    sync.RWMutex
+	disks []*disk
+}
+
+func newDiskSet(dirs []string) *diskSet {
+	ds := &diskSet{}
+	for _, dir := range dirs {
+		d := &disk{path: dir}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			d.failed = true
+			d.reason = err.Error()
+			slog.Error("data directory unavailable, marking failed", "dir", dir, "error", err)
+		}
+		ds.disks = append(ds.disks, d)
+	}
+	return ds
+}
+
+// healthy returns the disks that have not been marked failed.
+func (ds *diskSet) healthy() []*disk {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	disks := make([]*disk, 0, len(ds.disks))
+	for _, d := range ds.disks {
+		if !d.failed {
+			disks = append(disks, d)
+		}
+	}
+	return disks
+}
+
+// place picks the disk for a new file using rendezvous hashing weighted by
+// free space, so files spread evenly and fuller disks receive fewer of them.
+// Disks that cannot take size bytes without dropping below minFree are
+// skipped. It returns nil if no disk has room.
+func (ds *diskSet) place(key string, size, minFree uint64) *disk {
+	var best *disk
+	bestScore := math.Inf(-1)
+	for _, d := range ds.healthy() {
+		_, free, err := diskUsage(d.path)
+		if err != nil {
+			ds.checkAfterError(d, err)
+			continue
+		}
+		if free == 0 || free < minFree+size {
+			continue
+		}
+
+		score := float64(free) / -math.Log(rendezvousHash(key, d.path))
+		if score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+	return best
+}
+
+// locate returns the healthy disk holding videoId/filename, or nil.
+func (ds *diskSet) locate(videoId, filename string) *disk {
+	for _, d := range ds.healthy() {
+		_, err := os.Stat(filepath.Join(d.path, videoId, filename))
+		if err == nil {
+			return d
+		}
+		ds.checkAfterError(d, err)
+	}
+	return nil
+}
+
+// checkAfterError decides whether an I/O error means the disk itself is bad.
+// Missing files and full disks are expected; anything else triggers a probe
+// write, and the disk is marked failed if that fails too.
+func (ds *diskSet) checkAfterError(d *disk, err error) {
+	if err == nil || errors.Is(err, fs.ErrNotExist) || isNoSpace(err) {
+		return
+	}
+
+	probe := filepath.Join(d.path, ".probe")
+	probeErr := os.WriteFile(probe, []byte("ok"), 0644)
+	if probeErr == nil {
+		probeErr = os.Remove(probe)
+	}
+	if probeErr == nil || isNoSpace(probeErr) {
+		return
+	}
+
+	ds.markFailed(d, probeErr)
+}
+
+func (ds *diskSet) markFailed(d *disk, err error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if d.failed {
+		return
+	}
+	d.failed = true
+	d.reason = err.Error()
+	slog.Error("data directory failed, its files will be re-replicated from other nodes", "dir", d.path, "error", err)
+}
+
+func (ds *diskSet) isFailed(d *disk) bool {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return d.failed
+}
+
+// status reports every disk, including failed ones.
+func (ds *diskSet) status() []*proto.DiskStatus {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	statuses := make([]*proto.DiskStatus, 0, len(ds.disks))
+	for _, d := range ds.disks {
+		st := &proto.DiskStatus{Path: d.path, Failed: d.failed, Reason: d.reason}
+		if !d.failed {
+			if total, free, err := diskUsage(d.path); err == nil {
+				st.TotalBytes = total
+				st.FreeBytes = free
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// usage returns the total and free bytes of the healthy disks, counting
+// directories on the same filesystem once, and the number of failed disks.
+func (ds *diskSet) usage() (total, free uint64, failed int32) {
+	seen := make(map[string]bool)
+	for _, st := range ds.status() {
+		if st.Failed {
+			failed++
+			continue
+		}
+		id, err := deviceID(st.Path)
+		if err != nil {
+			slog.Warn("failed to identify filesystem of data directory", "dir", st.Path, "error", err)
+			id = "dir:" + st.Path
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		total += st.TotalBytes
+		free += st.FreeBytes
+	}
+	return total, free, failed
+}
+
+// rendezvousHash maps key and disk to a stable value in (0, 1).
+func rendezvousHash(key, diskPath string) float64 {
+	sum := sha256.Sum256([]byte(diskPath + "\x00" + key))
+	return (float64(binary.BigEndian.Uint64(sum[:8])>>11) + 0.5) / (1 << 53)
+}
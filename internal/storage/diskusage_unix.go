@@ -0,0 +1,33 @@
+//go:build !windows
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// diskUsage returns the total and available bytes of the filesystem holding path.
+func diskUsage(path string) (total uint64, free uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return stat.Blocks * uint64(stat.Bsize), stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// deviceID identifies the filesystem holding path, so directories on the
+// same filesystem are only counted once.
+func deviceID(path string) (string, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return "", err
+	}
+	return fmt.Sprint(stat.Dev), nil
+}
+
+// isNoSpace reports whether err was caused by a full disk.
+func isNoSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
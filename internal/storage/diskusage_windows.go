@@ -0,0 +1,41 @@
+//go:build windows
+
+package storage
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// diskUsage returns the total and available bytes of the volume holding path.
+func diskUsage(path string) (total uint64, free uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var freeToCaller, totalBytes, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &freeToCaller, &totalBytes, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return totalBytes, freeToCaller, nil
+}
+
+// deviceID identifies the volume holding path, so directories on the same
+// volume are only counted once.
+func deviceID(path string) (string, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumePathName(p, &buf[0], uint32(len(buf))); err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(buf), nil
+}
+
+// isNoSpace reports whether err was caused by a full disk.
+func isNoSpace(err error) bool {
+	return errors.Is(err, windows.ERROR_DISK_FULL) || errors.Is(err, windows.ERROR_HANDLE_DISK_FULL)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"tritontube/internal/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ErrRegistrationRejected is returned by RunHeartbeats when the admin
+// server's approval policy rejects this node.
+var ErrRegistrationRejected = errors.New("registration rejected by admin server")
+
+// RunHeartbeats registers this node with the web server's admin service at
+// adminAddr and then reports capacity and health every interval until ctx is
+// cancelled. advertiseAddr is the address other services use to reach this
+// node. Failures are logged and retried, so a node can start before the web
+// server does. A rejection is final: retrying would only be rejected again,
+// so RunHeartbeats returns ErrRegistrationRejected instead.
+func (s *Server) RunHeartbeats(ctx context.Context, adminAddr, advertiseAddr string, interval time.Duration) error {
+	conn, err := grpc.NewClient(adminAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := proto.NewVideoContentAdminServiceClient(conn)
+	log := slog.With("admin", adminAddr, "node", advertiseAddr)
+
+	registered := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		callCtx, cancel := context.WithTimeout(ctx, interval)
+		if !registered {
+			resp, err := client.RegisterNode(callCtx, &proto.RegisterNodeRequest{
+				NodeAddress: advertiseAddr,
+				Report:      s.report(),
+			})
+			switch {
+			case err != nil:
+				log.Warn("failed to register with admin server", "error", err)
+			case resp.State == proto.NodeState_NODE_STATE_ACTIVE:
+				log.Info("registered with admin server", "migrated_files", resp.MigratedFileCount)
+				registered = true
+			case resp.State == proto.NodeState_NODE_STATE_PENDING:
+				log.Info("registration pending approval")
+				registered = true
+			case resp.State == proto.NodeState_NODE_STATE_REJECTED:
+				cancel()
+				return ErrRegistrationRejected
+			}
+		} else {
+			resp, err := client.Heartbeat(callCtx, &proto.HeartbeatRequest{
+				NodeAddress: advertiseAddr,
+				Report:      s.report(),
+			})
+			if err != nil {
+				log.Warn("heartbeat failed", "error", err)
+			} else if resp.State == proto.NodeState_NODE_STATE_UNKNOWN {
+				log.Info("admin server no longer knows this node, registering again")
+				registered = false
+			}
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// report summarises capacity and health for heartbeats.
+func (s *Server) report() *proto.NodeReport {
+	readOnly, reason := s.checkCapacity(0)
+	r := &proto.NodeReport{ReadOnly: readOnly, Reason: reason}
+	r.TotalBytes, r.FreeBytes, r.FailedDisks = s.diskSet().usage()
+	return r
+}
@@ -0,0 +1,372 @@
+package storage
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"tritontube/internal/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ManifestName is the last entry of every snapshot archive.
+const ManifestName = "MANIFEST.json"
+
+const snapshotChunkSize = 1 << 20
+
+// SnapshotManifest lists every file in a snapshot with its checksum.
+// Files are stored exactly as they are on disk, so encrypted files stay
+// encrypted and need the same keyfile after a restore.
+type SnapshotManifest struct {
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Files     []SnapshotFileEntry `json:"files"`
+}
+
+type SnapshotFileEntry struct {
+	Path   string `json:"path"` // "<videoId>/<filename>"
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Snapshot streams a tar archive of every file on the node followed by a
+// manifest. The file list is taken when the snapshot starts and each file is
+// read while writes are held back, so no file is archived half-written. Writes
+// only wait for one file at a time, not for the whole stream; files deleted
+// meanwhile are left out, and files added meanwhile are not included.
+func (s *Server) Snapshot(req *proto.SnapshotRequest, stream grpc.ServerStreamingServer[proto.SnapshotChunk]) error {
+	s.snapshotMu.Lock()
+	files, err := s.listFiles()
+	s.snapshotMu.Unlock()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list files: %v", err)
+	}
+
+	w := &chunkWriter{send: func(data []byte) error {
+		return stream.Send(&proto.SnapshotChunk{Data: data})
+	}}
+	tw := tar.NewWriter(w)
+	manifest := SnapshotManifest{Version: 1, CreatedAt: time.Now().UTC()}
+
+	for _, rel := range files.paths {
+		data, modTime, err := s.readForSnapshot(rel)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // deleted since the list was taken
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read %s: %v", rel, err)
+		}
+		entry, err := addToTar(tw, rel, data, modTime)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to archive %s: %v", rel, err)
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode manifest: %v", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Restore unpacks a snapshot into this node, which must not hold any files
+// yet. Every file is checked against the manifest; on any mismatch the
+// restored files are removed again and DataLoss is returned.
+func (s *Server) Restore(stream grpc.ClientStreamingServer[proto.RestoreChunk, proto.RestoreResponse]) error {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	existing, err := s.listFiles()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list files: %v", err)
+	}
+	if len(existing.paths) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "node already holds %d files; restore needs an empty node", len(existing.paths))
+	}
+
+	r := &chunkReader{recv: func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.Data, nil
+	}}
+
+	var restored []string
+	cleanup := func() {
+		for _, d := range s.diskSet().healthy() {
+			for _, rel := range restored {
+				os.Remove(filepath.Join(d.path, filepath.FromSlash(rel)))
+				os.Remove(filepath.Join(d.path, path.Dir(rel))) // only succeeds once empty
+			}
+		}
+	}
+
+	var totalBytes uint64
+	manifest, err := readSnapshot(r, func(rel string, data []byte) error {
+		videoId, filename := path.Split(rel)
+		videoId = strings.TrimSuffix(videoId, "/")
+		d := s.diskSet().place(rel, uint64(len(data)), s.MinFreeBytes)
+		if d == nil {
+			return status.Errorf(codes.ResourceExhausted, "no data directory has room for %s", rel)
+		}
+		if err := writeFileTo(d.path, videoId, filename, data); err != nil {
+			return err
+		}
+		restored = append(restored, rel)
+		totalBytes += uint64(len(data))
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.DataLoss, "restore failed: %v", err)
+	}
+
+	return stream.SendAndClose(&proto.RestoreResponse{
+		RestoredFileCount: int32(len(manifest.Files)),
+		RestoredBytes:     totalBytes,
+	})
+}
+
+// VerifySnapshot reads a snapshot archive and checks every file against its
+// manifest without writing anything.
+func VerifySnapshot(r io.Reader) (*SnapshotManifest, error) {
+	return readSnapshot(r, nil)
+}
+
+// readSnapshot walks a snapshot archive, hands each file to store (if set)
+// and verifies the whole archive against the trailing manifest.
+func readSnapshot(r io.Reader, store func(rel string, data []byte) error) (*SnapshotManifest, error) {
+	tr := tar.NewReader(r)
+	sums := make(map[string]string)
+	var manifest *SnapshotManifest
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if manifest != nil {
+			return nil, fmt.Errorf("unexpected entry %s after manifest", hdr.Name)
+		}
+
+		// Every entry is held in memory, so refuse sizes no node could have
+		// stored rather than trusting the header.
+		if hdr.Size < 0 || hdr.Size > maxMessageSize {
+			return nil, fmt.Errorf("%s is %d bytes, more than the %d a file may have", hdr.Name, hdr.Size, maxMessageSize)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, hdr.Size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", hdr.Name, err)
+		}
+		if int64(len(data)) != hdr.Size {
+			return nil, fmt.Errorf("%s is truncated", hdr.Name)
+		}
+
+		if hdr.Name == ManifestName {
+			manifest = &SnapshotManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+
+		if !validSnapshotPath(hdr.Name) {
+			return nil, fmt.Errorf("invalid path in archive: %q", hdr.Name)
+		}
+		sum := sha256.Sum256(data)
+		sums[hdr.Name] = hex.EncodeToString(sum[:])
+
+		if store != nil {
+			if err := store(hdr.Name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if manifest == nil {
+		return nil, errors.New("archive has no manifest")
+	}
+	if len(manifest.Files) != len(sums) {
+		return nil, fmt.Errorf("manifest lists %d files but archive contains %d", len(manifest.Files), len(sums))
+	}
+	for _, f := range manifest.Files {
+		got, ok := sums[f.Path]
+		if !ok {
+			return nil, fmt.Errorf("%s is listed in the manifest but missing from the archive", f.Path)
+		}
+		if got != f.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", f.Path)
+		}
+	}
+
+	return manifest, nil
+}
+
+// validSnapshotPath accepts only "<videoId>/<filename>" with no traversal.
+func validSnapshotPath(p string) bool {
+	parts := strings.Split(p, "/")
+	if len(parts) != 2 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `\`) {
+			return false
+		}
+	}
+	return true
+}
+
+type nodeFiles struct {
+	paths []string          // sorted "<videoId>/<filename>"
+	dirs  map[string]string // path -> data directory holding it
+}
+
+// listFiles collects every stored file across the healthy data directories.
+func (s *Server) listFiles() (*nodeFiles, error) {
+	files := &nodeFiles{dirs: make(map[string]string)}
+	for _, d := range s.diskSet().healthy() {
+		videos, err := os.ReadDir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, video := range videos {
+			if !video.IsDir() {
+				continue
+			}
+			entries, err := os.ReadDir(filepath.Join(d.path, video.Name()))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			for _, e := range entries {
+				if !e.Type().IsRegular() {
+					continue
+				}
+				rel := video.Name() + "/" + e.Name()
+				if _, seen := files.dirs[rel]; seen {
+					continue
+				}
+				files.dirs[rel] = d.path
+				files.paths = append(files.paths, rel)
+			}
+		}
+	}
+	sort.Strings(files.paths)
+	return files, nil
+}
+
+// readForSnapshot reads one file for Snapshot while holding writes back. The
+// file is looked up again since a rewrite may have moved it to another data
+// directory after the list was taken.
+func (s *Server) readForSnapshot(rel string) ([]byte, time.Time, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	videoId, filename, _ := strings.Cut(rel, "/")
+	d := s.diskSet().locate(videoId, filename)
+	if d == nil {
+		return nil, time.Time{}, fs.ErrNotExist
+	}
+	fullPath := filepath.Join(d.path, videoId, filename)
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, info.ModTime(), nil
+}
+
+func addToTar(tw *tar.Writer, rel string, data []byte, modTime time.Time) (SnapshotFileEntry, error) {
+	hdr := &tar.Header{Name: rel, Mode: 0644, Size: int64(len(data)), ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return SnapshotFileEntry{}, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return SnapshotFileEntry{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	return SnapshotFileEntry{Path: rel, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// chunkWriter buffers writes into fixed-size gRPC messages.
+type chunkWriter struct {
+	send func([]byte) error
+	buf  []byte
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		take := min(snapshotChunkSize-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:take]...)
+		p = p[take:]
+		if len(w.buf) == snapshotChunkSize {
+			if err := w.Flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *chunkWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.send(w.buf)
+	w.buf = nil
+	return err
+}
+
+// chunkReader turns a stream of gRPC messages back into an io.Reader.
+type chunkReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -7,60 +7,278 @@ package storage
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
 
+	"tritontube/internal/encryption"
 	"tritontube/internal/proto"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// maxMessageSize bounds gRPC messages to and from a storage node, and so the
+// size of a single stored file.
+const maxMessageSize = 256 * 1024 * 1024
+
 type Server struct {
 	proto.UnimplementedVideoContentServer
-	BaseDir string
+
+	// Dirs are the data directories managed by this node, typically one per
+	// physical disk. Files are spread across them by hash and free space.
+	Dirs []string
+
+	// Keyring enables encryption at rest when set. Files written before it
+	// was configured are still served as plaintext.
+	Keyring *encryption.Keyring
+
+	// MinFreeBytes is the free-space threshold below which a data directory
+	// stops accepting writes. The node is read-only once every directory is
+	// below it. Zero disables the check.
+	MinFreeBytes uint64
+
+	initOnce sync.Once
+	disks    *diskSet
+
+	// snapshotMu is held exclusively by Restore and by Snapshot while it
+	// lists and reads files; writes take it shared so they never interleave
+	// with either.
+	snapshotMu sync.RWMutex
+
+	mu       sync.Mutex
+	readOnly bool
+	roReason string
+}
+
+// diskSet lazily sets up the data directories on first use.
+func (s *Server) diskSet() *diskSet {
+	s.initOnce.Do(func() {
+		s.disks = newDiskSet(s.Dirs)
+	})
+	return s.disks
 }
 
 func (s *Server) WriteFile(ctx context.Context, req *proto.WriteFileRequest) (*proto.WriteFileResponse, error) {
+	disks := s.diskSet()
+	s.snapshotMu.RLock()
+	defer s.snapshotMu.RUnlock()
+
 	// Special command to delete entire video directory
 	if req.Filename == ".DELETE_ALL" {
-		dir := filepath.Join(s.BaseDir, req.VideoId)
-		if err := os.RemoveAll(dir); err != nil {
-			return &proto.WriteFileResponse{Success: false}, fmt.Errorf("failed to delete directory: %v", err)
+		var lastErr error
+		for _, d := range disks.healthy() {
+			if err := os.RemoveAll(filepath.Join(d.path, req.VideoId)); err != nil {
+				disks.checkAfterError(d, err)
+				lastErr = err
+			}
+		}
+		if lastErr != nil {
+			return &proto.WriteFileResponse{Success: false}, fmt.Errorf("failed to delete directory: %v", lastErr)
 		}
 		return &proto.WriteFileResponse{Success: true}, nil
 	}
 
-	dir := filepath.Join(s.BaseDir, req.VideoId)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return &proto.WriteFileResponse{Success: false}, fmt.Errorf("failed to create directory: %v", err)
+	if readOnly, reason := s.checkCapacity(uint64(len(req.Data))); readOnly {
+		return &proto.WriteFileResponse{Success: false}, status.Errorf(codes.ResourceExhausted, "storage node is read-only: %s", reason)
+	}
+
+	data := req.Data
+	if s.Keyring != nil {
+		sealed, err := s.Keyring.Seal(data, fileAAD(req.VideoId, req.Filename))
+		if err != nil {
+			return &proto.WriteFileResponse{Success: false}, fmt.Errorf("failed to encrypt file: %v", err)
+		}
+		data = sealed
+	}
+
+	key := req.VideoId + "/" + req.Filename
+	for {
+		d := disks.place(key, uint64(len(data)), s.MinFreeBytes)
+		if d == nil {
+			return &proto.WriteFileResponse{Success: false}, status.Errorf(codes.ResourceExhausted, "no data directory has room for %d bytes", len(data))
+		}
+
+		err := writeFileTo(d.path, req.VideoId, req.Filename, data)
+		if err == nil {
+			s.removeStaleCopies(d, req.VideoId, req.Filename)
+			return &proto.WriteFileResponse{Success: true}, nil
+		}
+
+		if isNoSpace(err) {
+			s.checkCapacity(0)
+			return &proto.WriteFileResponse{Success: false}, status.Errorf(codes.ResourceExhausted, "failed to write file: %v", err)
+		}
+
+		disks.checkAfterError(d, err)
+		if !disks.isFailed(d) {
+			return &proto.WriteFileResponse{Success: false}, fmt.Errorf("failed to write file: %v", err)
+		}
+		// The disk was just marked failed; place the file on another one.
+	}
+}
+
+// writeFileTo stores data under dir/videoId/filename.
+func writeFileTo(dir, videoId, filename string, data []byte) error {
+	videoDir := filepath.Join(dir, videoId)
+	if err := os.MkdirAll(videoDir, 0755); err != nil {
+		return err
 	}
-	filePath := filepath.Join(dir, req.Filename)
-	if err := os.WriteFile(filePath, req.Data, 0644); err != nil {
-		return &proto.WriteFileResponse{Success: false}, fmt.Errorf("failed to write file: %v", err)
+
+	filePath := filepath.Join(videoDir, filename)
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		os.Remove(filePath) // don't leave a truncated segment behind
+		return err
+	}
+	return nil
+}
+
+// removeStaleCopies deletes older versions of a file that was rewritten onto
+// a different data directory, so reads never pick up outdated contents.
+func (s *Server) removeStaleCopies(current *disk, videoId, filename string) {
+	for _, d := range s.diskSet().healthy() {
+		if d == current {
+			continue
+		}
+		if err := os.Remove(filepath.Join(d.path, videoId, filename)); err != nil {
+			s.disks.checkAfterError(d, err)
+		}
 	}
-	return &proto.WriteFileResponse{Success: true}, nil
 }
 
 func (s *Server) ReadFile(ctx context.Context, req *proto.ReadFileRequest) (*proto.ReadFileResponse, error) {
-	filePath := filepath.Join(s.BaseDir, req.VideoId, req.Filename)
+	disks := s.diskSet()
+	d := disks.locate(req.VideoId, req.Filename)
+	if d == nil {
+		return &proto.ReadFileResponse{}, status.Errorf(codes.NotFound, "file %s/%s not found", req.VideoId, req.Filename)
+	}
+
+	filePath := filepath.Join(d.path, req.VideoId, req.Filename)
 	data, err := os.ReadFile(filePath)
 	if err != nil {
+		disks.checkAfterError(d, err)
 		return &proto.ReadFileResponse{}, fmt.Errorf("failed to read file: %v", err)
 	}
+
+	if s.Keyring != nil {
+		data, err = s.Keyring.Open(data, fileAAD(req.VideoId, req.Filename))
+		if err != nil {
+			return &proto.ReadFileResponse{}, fmt.Errorf("failed to decrypt file: %v", err)
+		}
+	} else if encryption.IsSealed(data) {
+		return &proto.ReadFileResponse{}, fmt.Errorf("file %s is encrypted but no keyfile is configured", filePath)
+	}
 	return &proto.ReadFileResponse{Data: data}, nil
 }
 
-func StartServer(host string, port int, baseDir string) error {
+func (s *Server) GetHealth(ctx context.Context, req *proto.GetHealthRequest) (*proto.GetHealthResponse, error) {
+	readOnly, reason := s.checkCapacity(0)
+	return &proto.GetHealthResponse{
+		ReadOnly: readOnly,
+		Reason:   reason,
+		Disks:    s.diskSet().status(),
+	}, nil
+}
+
+func (s *Server) GetCapacity(ctx context.Context, req *proto.GetCapacityRequest) (*proto.GetCapacityResponse, error) {
+	readOnly, _ := s.checkCapacity(0)
+	resp := &proto.GetCapacityResponse{
+		MinFreeBytes: s.MinFreeBytes,
+		ReadOnly:     readOnly,
+		Disks:        s.diskSet().status(),
+	}
+	resp.TotalBytes, resp.FreeBytes, _ = s.diskSet().usage()
+
+	return resp, nil
+}
+
+// ListFiles returns every file on the node's healthy data directories, so
+// the web tier can re-replicate files lost with a failed disk.
+func (s *Server) ListFiles(ctx context.Context, req *proto.ListFilesRequest) (*proto.ListFilesResponse, error) {
+	files, err := s.listFiles()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list files: %v", err)
+	}
+	return &proto.ListFilesResponse{Paths: files.paths}, nil
+}
+
+// checkCapacity re-evaluates free space and reports whether a write of
+// incoming bytes must be rejected. The node flips to read-only when no healthy
+// data directory has more than MinFreeBytes free (or every disk is completely
+// full) and switches back on its own once space is freed.
+func (s *Server) checkCapacity(incoming uint64) (bool, string) {
+	healthy := s.diskSet().healthy()
+	writable, fits := false, false
+	for _, d := range healthy {
+		_, free, err := diskUsage(d.path)
+		if err != nil {
+			slog.Warn("failed to check free disk space", "dir", d.path, "error", err)
+			s.disks.checkAfterError(d, err)
+			continue
+		}
+		if free > 0 && free >= s.MinFreeBytes {
+			writable = true
+			if free >= s.MinFreeBytes+incoming {
+				fits = true
+			}
+		}
+	}
+
+	switch {
+	case len(healthy) == 0:
+		s.setReadOnly(true, "all data directories have failed")
+	case !writable:
+		s.setReadOnly(true, fmt.Sprintf("no data directory has at least %d bytes free", s.MinFreeBytes))
+	default:
+		s.setReadOnly(false, "")
+		if !fits {
+			return true, fmt.Sprintf("writing %d bytes would leave less than %d bytes free on every data directory", incoming, s.MinFreeBytes)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readOnly, s.roReason
+}
+
+func (s *Server) setReadOnly(readOnly bool, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readOnly != readOnly {
+		if readOnly {
+			slog.Warn("storage node switched to read-only", "dirs", s.Dirs, "reason", reason)
+		} else {
+			slog.Info("storage node is writable again", "dirs", s.Dirs)
+		}
+	}
+	s.readOnly = readOnly
+	s.roReason = reason
+}
+
+// fileAAD binds encrypted contents to the file's logical location.
+func fileAAD(videoId, filename string) []byte {
+	return []byte(videoId + "/" + filename)
+}
+
+func StartServer(host string, port int, server *Server) error {
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
+	fmt.Printf("Starting server on %s:%d\n", host, port)
+	return Serve(lis, server)
+}
+
+// Serve runs server on an existing listener until it fails.
+func Serve(lis net.Listener, server *Server) error {
 	s := grpc.NewServer(
-		grpc.MaxRecvMsgSize(256*1024*1024),
-		grpc.MaxSendMsgSize(256*1024*1024),
+		grpc.MaxRecvMsgSize(maxMessageSize),
+		grpc.MaxSendMsgSize(maxMessageSize),
 	)
-	proto.RegisterVideoContentServer(s, &Server{BaseDir: baseDir})
-	fmt.Printf("Starting server on %s:%d\n", host, port)
+	proto.RegisterVideoContentServer(s, server)
 	return s.Serve(lis)
 }
@@ -0,0 +1,186 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Role is the access a grant gives to a video.
+type Role string
+
+const (
+	// RoleViewer may find and watch the video, even if it is private.
+	RoleViewer Role = "viewer"
+	// RoleEditor may also change its title and description. Deleting it,
+	// changing its visibility and sharing it stay with the owner.
+	RoleEditor Role = "editor"
+)
+
+// ErrInvalidRole is returned for an unknown role.
+var ErrInvalidRole = errors.New("role must be viewer or editor")
+
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleViewer, RoleEditor:
+		return r, nil
+	default:
+		return "", ErrInvalidRole
+	}
+}
+
+// Grantee is who a grant is to, "user:<user ID>" or "group:<group name>".
+type Grantee string
+
+const (
+	granteeUserPrefix  = "user:"
+	granteeGroupPrefix = "group:"
+)
+
+// ErrInvalidGrantee is returned for a malformed grantee.
+var ErrInvalidGrantee = errors.New(`grantee must be "user:<id>" or "group:<name>"`)
+
+// UserGrantee returns the grantee for the user with userId.
+func UserGrantee(userId string) Grantee {
+	return Grantee(granteeUserPrefix + userId)
+}
+
+// GroupGrantee returns the grantee for the group named group, which should
+// be normalized with NormalizeGroup.
+func GroupGrantee(group string) Grantee {
+	return Grantee(granteeGroupPrefix + group)
+}
+
+// ParseGrantee checks s, normalizing group names.
+func ParseGrantee(s string) (Grantee, error) {
+	if userId, ok := strings.CutPrefix(s, granteeUserPrefix); ok {
+		if userId == "" || strings.ContainsAny(userId, "/ \t\r\n") {
+			return "", ErrInvalidGrantee
+		}
+		return UserGrantee(userId), nil
+	}
+	if group, ok := strings.CutPrefix(s, granteeGroupPrefix); ok {
+		group, err := NormalizeGroup(group)
+		if err != nil {
+			return "", err
+		}
+		return GroupGrantee(group), nil
+	}
+	return "", ErrInvalidGrantee
+}
+
+// Grant gives a user or the members of a group a role on a video.
+type Grant struct {
+	Grantee Grantee
+	Role    Role
+}
+
+// ACLStore stores who videos are shared with, alongside video metadata. A
+// video's grants are removed when the video is deleted, but not when it is
+// moved to the trash. It is optional; metadata services that keep grants
+// implement it, and callers check for it with a type assertion on the
+// service before wrapping it in decorators.
+type ACLStore interface {
+	// ReadACL returns the grants on a video, in no particular order. A video
+	// that is not shared, or does not exist, has none.
+	ReadACL(ctx context.Context, videoId string) ([]Grant, error)
+	// PutGrant adds grant to the video, replacing any earlier grant to the
+	// same grantee.
+	PutGrant(ctx context.Context, videoId string, grant Grant) error
+	// RevokeGrant removes the video's grant to grantee, returning
+	// ErrNotFound if there is none.
+	RevokeGrant(ctx context.Context, videoId string, grantee Grantee) error
+	// SharedWith returns the IDs of the videos with a grant to any of
+	// grantees, in no particular order and each once.
+	SharedWith(ctx context.Context, grantees []Grantee) ([]string, error)
+}
+
+// ErrInvalidGroup is returned for a malformed group name.
+var ErrInvalidGroup = errors.New("group names are 3 to 32 letters, digits, '.', '-' or '_'")
+
+// NormalizeGroup lower-cases name so group names are case-insensitive, and
+// checks that it only uses the characters allowed in usernames.
+func NormalizeGroup(name string) (string, error) {
+	name, err := NormalizeUsername(name)
+	if err != nil {
+		return "", ErrInvalidGroup
+	}
+	return name, nil
+}
+
+// LoadGroups reads a groups file. Each line holds a group name and the
+// comma-separated usernames of its members, separated by whitespace. Blank
+// lines and lines starting with # are ignored. It returns the groups of each
+// member by normalized username.
+func LoadGroups(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	groups := make(map[string][]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want GROUP USERNAME,USERNAME,...", path, line)
+		}
+		group, err := NormalizeGroup(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		for member := range strings.SplitSeq(fields[1], ",") {
+			username, err := NormalizeUsername(member)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: member %q: %w", path, line, member, err)
+			}
+			if !slices.Contains(groups[username], group) {
+				groups[username] = append(groups[username], group)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// grantees returns the grantees that match p: the user and their groups.
+func (p *Principal) grantees() []Grantee {
+	if p == nil {
+		return nil
+	}
+	grantees := make([]Grantee, 0, 1+len(p.Groups))
+	if p.UserId != "" {
+		grantees = append(grantees, UserGrantee(p.UserId))
+	}
+	for _, group := range p.Groups {
+		grantees = append(grantees, GroupGrantee(group))
+	}
+	return grantees
+}
+
+// grantedRole returns the highest role grants give p, or "" if none.
+func grantedRole(grants []Grant, p *Principal) Role {
+	var role Role
+	mine := p.grantees()
+	for _, grant := range grants {
+		if !slices.Contains(mine, grant.Grantee) {
+			continue
+		}
+		if grant.Role == RoleEditor {
+			return RoleEditor
+		}
+		role = grant.Role
+	}
+	return role
+}
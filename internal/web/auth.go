@@ -0,0 +1,345 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ScopeAdmin lets a principal manage any video, purge videos and read the
+// runtime counters.
+const ScopeAdmin = "admin"
+
+// How a principal authenticated.
+const (
+	AuthMethodSession = "session"
+	AuthMethodAPIKey  = "api-key"
+	AuthMethodJWT     = "jwt"
+)
+
+// Principal is whoever made a request: a signed-in user, the holder of an
+// API key or the subject of a JWT.
+type Principal struct {
+	UserId   string // owner ID recorded on the videos they upload; "jwt:<iss>:<sub>" for tokens
+	Username string // the key name for API keys; may be empty for tokens
+	Scopes   []string
+	Groups   []string // normalized group names, for grants to groups
+	Method   string   // one of the AuthMethod constants
+
+	user *User // set for sessions
+}
+
+// HasScope reports whether p was granted scope. A nil p has no scopes.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && slices.Contains(p.Scopes, scope)
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.HasScope(ScopeAdmin)
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the principal the auth middleware attached to ctx,
+// or nil for anonymous requests.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// APIKey is a key for scripts and services. Only a hash of the key is kept.
+type APIKey struct {
+	Name   string // for logs
+	UserId string // owner of what is uploaded with the key
+	Scopes []string
+	Hash   [sha256.Size]byte
+}
+
+// apiKeyPrefix marks generated keys so they are easy to tell apart from
+// JWTs and to find in leaked text.
+const apiKeyPrefix = "tt_"
+
+// GenerateAPIKey returns a new random key and its hash in hex, as written in
+// an API key file.
+func GenerateAPIKey() (key, hash string) {
+	key = apiKeyPrefix + rand.Text()
+	sum := sha256.Sum256([]byte(key))
+	return key, hex.EncodeToString(sum[:])
+}
+
+// LoadAPIKeys reads an API key file. Each line holds a key's name, user ID,
+// SHA-256 hash in hex and comma-separated scopes ("-" for none), separated
+// by whitespace. Blank lines and lines starting with # are ignored.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []APIKey
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s:%d: want NAME USER_ID SHA256 SCOPES", path, line)
+		}
+		key := APIKey{Name: fields[0], UserId: fields[1]}
+		hash, err := hex.DecodeString(fields[2])
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: hash must be 64 hex digits", path, line)
+		}
+		copy(key.Hash[:], hash)
+		if fields[3] != "-" {
+			key.Scopes = strings.Split(fields[3], ",")
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("%s:%d: duplicate key name %q", path, line, key.Name)
+		}
+		names[key.Name] = true
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// AuthOptions configures an Authenticator. Every field is optional.
+type AuthOptions struct {
+	Sessions   *SessionStore // accepts the session cookie of signed-in users
+	APIKeys    []APIKey
+	JWT        *JWTVerifier
+	AdminUsers []string            // usernames whose sessions get ScopeAdmin
+	Groups     map[string][]string // groups of session users by username, see LoadGroups
+}
+
+// Authenticator works out the principal of a request from its session
+// cookie, API key or bearer token.
+type Authenticator struct {
+	sessions *SessionStore
+	keys     map[[sha256.Size]byte]APIKey
+	jwt      *JWTVerifier
+	admins   map[string]bool
+	groups   map[string][]string
+}
+
+func NewAuthenticator(opts AuthOptions) *Authenticator {
+	a := &Authenticator{
+		sessions: opts.Sessions,
+		keys:     make(map[[sha256.Size]byte]APIKey),
+		jwt:      opts.JWT,
+		admins:   make(map[string]bool),
+		groups:   opts.Groups,
+	}
+	for _, key := range opts.APIKeys {
+		a.keys[key.Hash] = key
+	}
+	for _, username := range opts.AdminUsers {
+		if normalized, err := NormalizeUsername(username); err == nil {
+			a.admins[normalized] = true
+		}
+	}
+	return a
+}
+
+// Authenticate returns the principal of r, or nil if it carries no
+// credentials. Credentials that are present but wrong are an error rather
+// than anonymous, so a client with an expired token finds out. An unknown or
+// expired session cookie is treated as no cookie.
+//
+// API keys are sent as "Authorization: Bearer KEY" or "X-API-Key: KEY", and
+// JWTs as "Authorization: Bearer TOKEN".
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.apiKey(key)
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, credentials, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") || credentials == "" {
+			return nil, fmt.Errorf("unsupported authorization scheme %q", scheme)
+		}
+		credentials = strings.TrimSpace(credentials)
+		if strings.Count(credentials, ".") == 2 {
+			if a.jwt == nil {
+				return nil, fmt.Errorf("%w: tokens are not accepted by this server", ErrInvalidToken)
+			}
+			return a.jwt.Verify(credentials, time.Now())
+		}
+		return a.apiKey(credentials)
+	}
+
+	if a.sessions == nil {
+		return nil, nil
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	user := a.sessions.Lookup(cookie.Value)
+	if user == nil {
+		return nil, nil
+	}
+	p := &Principal{UserId: user.Id, Username: user.Username, Groups: a.groups[user.Username], Method: AuthMethodSession, user: user}
+	if a.admins[user.Username] {
+		p.Scopes = []string{ScopeAdmin}
+	}
+	return p, nil
+}
+
+func (a *Authenticator) apiKey(key string) (*Principal, error) {
+	// Looking up the hash rather than the key keeps the comparison from
+	// leaking how much of a guess was right.
+	found, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, fmt.Errorf("unknown API key")
+	}
+	return &Principal{UserId: found.UserId, Username: found.Name, Scopes: found.Scopes, Method: AuthMethodAPIKey}, nil
+}
+
+// Access is what a route requires of the principal.
+type Access int
+
+const (
+	AccessPublic        Access = iota // anyone, signed in or not
+	AccessAuthenticated               // any principal
+	AccessAdmin                       // a principal with ScopeAdmin
+)
+
+var accessNames = map[Access]string{
+	AccessPublic:        "public",
+	AccessAuthenticated: "authenticated",
+	AccessAdmin:         "admin",
+}
+
+func (a Access) String() string {
+	if name, ok := accessNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Access(%d)", int(a))
+}
+
+func (a Access) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Access) UnmarshalText(text []byte) error {
+	for access, name := range accessNames {
+		if string(text) == name {
+			*a = access
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown access %q, want public, authenticated or admin", text)
+}
+
+// RouteRule sets the access required for requests to a path.
+type RouteRule struct {
+	// Path is matched like a ServeMux pattern: exactly, or as a prefix if
+	// it ends in a slash.
+	Path string `json:"path"`
+	// Methods limits the rule to these methods; empty means all of them.
+	Methods []string `json:"methods,omitempty"`
+	Access  Access   `json:"access"`
+}
+
+func (rule RouteRule) matches(method, path string) (int, bool) {
+	if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, method) {
+		return 0, false
+	}
+	if !matchPathPattern(rule.Path, path) {
+		return 0, false
+	}
+	// Longer paths are more specific, and a rule naming the method is more
+	// specific than one for every method on the same path.
+	specificity := 2 * len(rule.Path)
+	if len(rule.Methods) > 0 {
+		specificity++
+	}
+	return specificity, true
+}
+
+// matchPathPattern matches path against pattern the way ServeMux does:
+// exactly, or as a prefix if pattern ends in a slash.
+func matchPathPattern(pattern, path string) bool {
+	return path == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern))
+}
+
+// RoutePolicy decides what each request requires. The most specific
+// matching rule applies; requests no rule matches are public.
+type RoutePolicy struct {
+	rules []RouteRule
+}
+
+// DefaultRouteRules keep reading public, require a principal for uploading
+// and changing videos, and keep purging and the runtime counters to admins.
+// Whether a principal may change a particular video is checked by the
+// handlers.
+var DefaultRouteRules = []RouteRule{
+	{Path: "/upload", Methods: []string{http.MethodPost}, Access: AccessAuthenticated},
+	{Path: "/api/upload", Methods: []string{http.MethodPost}, Access: AccessAuthenticated},
+	{Path: "/api/presign-upload", Methods: []string{http.MethodPost}, Access: AccessAuthenticated},
+	{Path: "/api/process", Methods: []string{http.MethodPost}, Access: AccessAuthenticated},
+	{Path: "/api/delete/", Access: AccessAuthenticated},
+	{Path: "/api/videos/", Methods: []string{http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete}, Access: AccessAuthenticated},
+	{Path: "/api/admin/", Access: AccessAdmin},
+	{Path: "/debug/", Access: AccessAdmin},
+}
+
+// NewRoutePolicy returns a policy of rules. Where two rules are equally
+// specific, the earlier one wins.
+func NewRoutePolicy(rules []RouteRule) *RoutePolicy {
+	return &RoutePolicy{rules: rules}
+}
+
+// LoadRoutePolicy reads a JSON list of RouteRules, such as
+// [{"path": "/api/videos", "methods": ["GET"], "access": "authenticated"}],
+// and returns a policy where they take precedence over DefaultRouteRules.
+func LoadRoutePolicy(path string) (*RoutePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RouteRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, rule := range rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("%s: rule %d: path must start with /", path, i)
+		}
+		for j, method := range rule.Methods {
+			rules[i].Methods[j] = strings.ToUpper(method)
+		}
+	}
+	return NewRoutePolicy(append(rules, DefaultRouteRules...)), nil
+}
+
+// Access returns what a request for method and path requires.
+func (p *RoutePolicy) Access(method, path string) Access {
+	best, access := -1, AccessPublic
+	for _, rule := range p.rules {
+		if specificity, ok := rule.matches(method, path); ok && specificity > best {
+			best, access = specificity, rule.Access
+		}
+	}
+	return access
+}
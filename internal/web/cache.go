@@ -0,0 +1,323 @@
+package web
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache counters, published at /debug/vars. They are shared by every cache
+// in the process.
+var (
+	metadataCacheHits      = expvar.NewInt("metadata_cache_hits")
+	metadataCacheMisses    = expvar.NewInt("metadata_cache_misses")
+	metadataCacheEvictions = expvar.NewInt("metadata_cache_evictions")
+)
+
+// CacheInvalidator keeps the caches of several server instances coherent.
+// Publish is called after every write made through a cache; an
+// implementation forwards the video ID to the other instances, which pass it
+// to their own cache's Invalidate.
+type CacheInvalidator interface {
+	Publish(ctx context.Context, videoId string) error
+}
+
+// MetadataCacheOptions configures WithMetadataCache.
+type MetadataCacheOptions struct {
+	Size        int              // maximum number of cached lookups
+	TTL         time.Duration    // how long a cached lookup is served
+	Invalidator CacheInvalidator // optional
+	Changes     *ChangeHub       // optional; its changes invalidate the cache
+}
+
+// CachingVideoMetadataService is a read-through cache in front of a
+// VideoMetadataService. Read, List and Query results, including videos that
+// do not exist, are kept for up to the TTL in a bounded LRU. Writes through
+// the cache drop the video's entry and every cached listing; writes made
+// elsewhere are only seen once entries expire, unless they are reported
+// through Invalidate or a ChangeHub.
+type CachingVideoMetadataService struct {
+	svc         VideoMetadataService
+	ttl         time.Duration
+	invalidator CacheInvalidator
+	cache       *lruCache
+}
+
+// Uncomment the following line to ensure CachingVideoMetadataService implements VideoMetadataService
+var _ VideoMetadataService = (*CachingVideoMetadataService)(nil)
+
+// WithMetadataCache wraps svc in a CachingVideoMetadataService. A Size or
+// TTL of zero or less returns svc unchanged. The result is a VideoSearcher
+// if svc is one; search results are not cached.
+func WithMetadataCache(svc VideoMetadataService, opts MetadataCacheOptions) VideoMetadataService {
+	if opts.Size <= 0 || opts.TTL <= 0 {
+		return svc
+	}
+	c := NewCachingVideoMetadataService(svc, opts)
+	if searcher, ok := svc.(VideoSearcher); ok {
+		return &cachingSearchService{CachingVideoMetadataService: c, searcher: searcher}
+	}
+	return c
+}
+
+func NewCachingVideoMetadataService(svc VideoMetadataService, opts MetadataCacheOptions) *CachingVideoMetadataService {
+	c := &CachingVideoMetadataService{
+		svc:         svc,
+		ttl:         opts.TTL,
+		invalidator: opts.Invalidator,
+		cache:       newLRUCache(opts.Size),
+	}
+	if opts.Changes != nil {
+		go c.followChanges(opts.Changes)
+	}
+	return c
+}
+
+// followChanges invalidates every video the hub reports as changed, for the
+// life of the process. If the subscription is dropped for falling behind,
+// changes may have been missed, so everything is invalidated.
+func (c *CachingVideoMetadataService) followChanges(hub *ChangeHub) {
+	for {
+		for change := range hub.Subscribe(context.Background()) {
+			c.Invalidate(change.VideoId)
+		}
+		c.InvalidateAll()
+	}
+}
+
+// Cache keys. Listings share a prefix so a write can drop them all.
+const (
+	cacheKeyRead    = "read:"
+	cacheKeyListing = "list:"
+)
+
+func (c *CachingVideoMetadataService) Read(ctx context.Context, videoId string) (*VideoMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := cacheKeyRead + videoId
+	if value, ok := c.cache.get(key); ok {
+		metadataCacheHits.Add(1)
+		meta, _ := value.(*VideoMetadata)
+		if meta == nil {
+			return nil, nil
+		}
+		// Callers may modify what they get, e.g. Update bumps Version.
+		copied := *meta
+		return &copied, nil
+	}
+	metadataCacheMisses.Add(1)
+
+	generation := c.cache.generation()
+	meta, err := c.svc.Read(ctx, videoId)
+	if err != nil {
+		return nil, err
+	}
+	var cached *VideoMetadata
+	if meta != nil {
+		copied := *meta
+		cached = &copied
+	}
+	c.cache.add(key, cached, c.ttl, generation)
+	return meta, nil
+}
+
+func (c *CachingVideoMetadataService) List(ctx context.Context) ([]VideoMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := cacheKeyListing + "all"
+	if value, ok := c.cache.get(key); ok {
+		metadataCacheHits.Add(1)
+		return append([]VideoMetadata(nil), value.([]VideoMetadata)...), nil
+	}
+	metadataCacheMisses.Add(1)
+
+	generation := c.cache.generation()
+	videos, err := c.svc.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.add(key, append([]VideoMetadata(nil), videos...), c.ttl, generation)
+	return videos, nil
+}
+
+func (c *CachingVideoMetadataService) Query(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := cacheKeyListing + fmt.Sprintf("%d|%q|%q|%q|%q|%t|%q|%q|%t|%q|%q", opts.Limit, opts.Cursor, opts.SortBy, opts.SortOrder, opts.Status, opts.IncludeTrash, opts.Search, opts.Owner, opts.Listed, opts.Viewer, strings.Join(opts.Shared, ","))
+	if value, ok := c.cache.get(key); ok {
+		metadataCacheHits.Add(1)
+		result := *value.(*ListResult)
+		result.Videos = append([]VideoMetadata(nil), result.Videos...)
+		return &result, nil
+	}
+	metadataCacheMisses.Add(1)
+
+	generation := c.cache.generation()
+	result, err := c.svc.Query(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	cached := *result
+	cached.Videos = append([]VideoMetadata(nil), result.Videos...)
+	c.cache.add(key, &cached, c.ttl, generation)
+	return result, nil
+}
+
+func (c *CachingVideoMetadataService) Create(ctx context.Context, videoId string, uploadedAt time.Time, ownerId string, visibility Visibility) error {
+	defer c.written(ctx, videoId)
+	return c.svc.Create(ctx, videoId, uploadedAt, ownerId, visibility)
+}
+
+func (c *CachingVideoMetadataService) CreateWithStatus(ctx context.Context, videoId string, uploadedAt time.Time, status VideoStatus, ownerId string, visibility Visibility) error {
+	defer c.written(ctx, videoId)
+	return c.svc.CreateWithStatus(ctx, videoId, uploadedAt, status, ownerId, visibility)
+}
+
+func (c *CachingVideoMetadataService) UpdateStatus(ctx context.Context, videoId string, status VideoStatus) error {
+	defer c.written(ctx, videoId)
+	return c.svc.UpdateStatus(ctx, videoId, status)
+}
+
+func (c *CachingVideoMetadataService) UpdateDetails(ctx context.Context, videoId string, title string, description string) error {
+	defer c.written(ctx, videoId)
+	return c.svc.UpdateDetails(ctx, videoId, title, description)
+}
+
+func (c *CachingVideoMetadataService) UpdateMediaInfo(ctx context.Context, videoId string, info MediaInfo) error {
+	defer c.written(ctx, videoId)
+	return c.svc.UpdateMediaInfo(ctx, videoId, info)
+}
+
+func (c *CachingVideoMetadataService) Update(ctx context.Context, meta *VideoMetadata) error {
+	defer c.written(ctx, meta.Id)
+	return c.svc.Update(ctx, meta)
+}
+
+func (c *CachingVideoMetadataService) Delete(ctx context.Context, videoId string) error {
+	defer c.written(ctx, videoId)
+	return c.svc.Delete(ctx, videoId)
+}
+
+// written invalidates after a write, whether or not it succeeded: a failed
+// write such as ErrConflict or ErrAlreadyExists means the cached entry was
+// stale, and retrying from it would fail again.
+func (c *CachingVideoMetadataService) written(ctx context.Context, videoId string) {
+	c.Invalidate(videoId)
+	if c.invalidator == nil {
+		return
+	}
+	if err := c.invalidator.Publish(ctx, videoId); err != nil {
+		slog.Warn("failed to publish metadata cache invalidation", "video_id", videoId, "error", err)
+	}
+}
+
+// Invalidate drops the cached lookup of videoId and every cached listing.
+// Use it to report changes made outside this cache.
+func (c *CachingVideoMetadataService) Invalidate(videoId string) {
+	c.cache.removeIf(func(key string) bool {
+		return key == cacheKeyRead+videoId || strings.HasPrefix(key, cacheKeyListing)
+	})
+}
+
+// InvalidateAll empties the cache.
+func (c *CachingVideoMetadataService) InvalidateAll() {
+	c.cache.removeIf(func(string) bool { return true })
+}
+
+type cachingSearchService struct {
+	*CachingVideoMetadataService
+	searcher VideoSearcher
+}
+
+func (c *cachingSearchService) Search(ctx context.Context, query string, opts ListOptions) (*SearchResult, error) {
+	return c.searcher.Search(ctx, query, opts)
+}
+
+// lruCache is a size-bounded map whose entries also expire. Every removal
+// bumps a generation counter, so a lookup that started before an
+// invalidation cannot put its now stale result back afterwards.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[string]*list.Element
+	gen     uint64
+}
+
+type lruEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (l *lruCache) get(key string) (any, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		l.order.Remove(elem)
+		delete(l.entries, key)
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (l *lruCache) generation() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.gen
+}
+
+// add stores value unless something was removed since generation was read.
+func (l *lruCache) add(key string, value any, ttl time.Duration, generation uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if generation != l.gen {
+		return
+	}
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if elem, ok := l.entries[key]; ok {
+		elem.Value = entry
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.entries[key] = l.order.PushFront(entry)
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+		metadataCacheEvictions.Add(1)
+	}
+}
+
+func (l *lruCache) removeIf(match func(key string) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.gen++
+	for key, elem := range l.entries {
+		if match(key) {
+			l.order.Remove(elem)
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package web_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tritontube/internal/storage"
+	"tritontube/internal/web"
+	"tritontube/internal/web/webtest"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// These tests run the shared conformance checks from package webtest. The
+// memory, sqlite, etcd, fs and nw backends always run, etcd against an
+// in-process server. DynamoDB and S3 need a local stand-in and are skipped
+// unless DYNAMODB_ENDPOINT or S3_ENDPOINT (with S3_BUCKET_NAME naming an
+// existing bucket) is set.
+
+// report turns each conformance result into a subtest.
+func report(t *testing.T, results []webtest.Result) {
+	t.Helper()
+	for _, r := range results {
+		t.Run(r.Name, func(t *testing.T) {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+		})
+	}
+}
+
+// checkMetadata runs the metadata checks and, for backends that also store
+// user accounts and grants, the user and ACL checks.
+func checkMetadata(t *testing.T, newService webtest.MetadataFactory, stores bool) {
+	ctx := context.Background()
+	t.Run("metadata", func(t *testing.T) { report(t, webtest.CheckMetadataService(ctx, newService)) })
+	if !stores {
+		return
+	}
+	t.Run("users", func(t *testing.T) {
+		report(t, webtest.CheckUserStore(ctx, func(ctx context.Context) (web.UserStore, error) {
+			svc, err := newService(ctx)
+			if err != nil {
+				return nil, err
+			}
+			store, ok := svc.(web.UserStore)
+			if !ok {
+				return nil, fmt.Errorf("%T does not store user accounts", svc)
+			}
+			return store, nil
+		}))
+	})
+	t.Run("acl", func(t *testing.T) {
+		report(t, webtest.CheckACLStore(ctx, func(ctx context.Context) (web.ACLStore, error) {
+			svc, err := newService(ctx)
+			if err != nil {
+				return nil, err
+			}
+			store, ok := svc.(web.ACLStore)
+			if !ok {
+				return nil, fmt.Errorf("%T does not store grants", svc)
+			}
+			return store, nil
+		}))
+	})
+}
+
+func TestMemoryMetadataConformance(t *testing.T) {
+	checkMetadata(t, func(context.Context) (web.VideoMetadataService, error) {
+		return web.NewMemoryVideoMetadataService(), nil
+	}, true)
+}
+
+func TestSQLiteMetadataConformance(t *testing.T) {
+	dir := t.TempDir()
+	checkMetadata(t, func(context.Context) (web.VideoMetadataService, error) {
+		return web.NewSQLiteVideoMetadataService(filepath.Join(dir, "metadata-"+rand.Text()+".db"))
+	}, true)
+}
+
+func TestCachedSQLiteMetadataConformance(t *testing.T) {
+	dir := t.TempDir()
+	checkMetadata(t, func(context.Context) (web.VideoMetadataService, error) {
+		svc, err := web.NewSQLiteVideoMetadataService(filepath.Join(dir, "metadata-"+rand.Text()+".db"))
+		if err != nil {
+			return nil, err
+		}
+		return web.NewCachingVideoMetadataService(svc, web.MetadataCacheOptions{Size: 64, TTL: time.Minute}), nil
+	}, false)
+}
+
+func TestDynamoDBMetadataConformance(t *testing.T) {
+	if os.Getenv("DYNAMODB_ENDPOINT") == "" {
+		t.Skip("DYNAMODB_ENDPOINT is not set")
+	}
+	checkMetadata(t, func(ctx context.Context) (web.VideoMetadataService, error) {
+		svc, err := web.NewDynamoDBVideoMetadataService("conformance-" + rand.Text())
+		if err != nil {
+			return nil, err
+		}
+		return svc, svc.CreateTable(ctx)
+	}, true)
+}
+
+func TestEtcdMetadataConformance(t *testing.T) {
+	endpoint := web.StartEtcdServer(t)
+	checkMetadata(t, func(context.Context) (web.VideoMetadataService, error) {
+		client, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}, DialTimeout: 5 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		svc := web.NewEtcdVideoMetadataServiceFromClient(client, "/tritontube-conformance/"+rand.Text()+"/")
+		t.Cleanup(func() { svc.Close() })
+		return svc, nil
+	}, true)
+}
+
+func TestMemoryContentConformance(t *testing.T) {
+	report(t, webtest.CheckContentService(context.Background(), func(context.Context) (web.VideoContentService, error) {
+		return web.NewMemoryVideoContentService(), nil
+	}))
+}
+
+func TestFSContentConformance(t *testing.T) {
+	dir := t.TempDir()
+	report(t, webtest.CheckContentService(context.Background(), func(context.Context) (web.VideoContentService, error) {
+		return web.NewFSVideoContentService(dir), nil
+	}))
+}
+
+func TestNetworkContentConformance(t *testing.T) {
+	nodes := startStorageNodes(t, 3)
+	report(t, webtest.CheckContentService(context.Background(), func(context.Context) (web.VideoContentService, error) {
+		return web.NewNetworkVideoContentService(nodes)
+	}))
+}
+
+func TestS3ContentConformance(t *testing.T) {
+	if os.Getenv("S3_ENDPOINT") == "" || os.Getenv("S3_BUCKET_NAME") == "" {
+		t.Skip("S3_ENDPOINT or S3_BUCKET_NAME is not set")
+	}
+	report(t, webtest.CheckContentService(context.Background(), func(context.Context) (web.VideoContentService, error) {
+		return web.NewS3VideoContentService(os.Getenv("S3_BUCKET_NAME"))
+	}))
+}
+
+// startStorageNodes serves n storage nodes on loopback ports for the rest of
+// the test, each with its own data directory, and returns their addresses.
+func startStorageNodes(t *testing.T, n int) []string {
+	t.Helper()
+	addrs := make([]string, 0, n)
+	for range n {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		node := &storage.Server{Dirs: []string{t.TempDir()}}
+		go storage.Serve(lis, node)
+		t.Cleanup(func() { lis.Close() })
+		addrs = append(addrs, lis.Addr().String())
+	}
+	return addrs
+}
@@ -0,0 +1,221 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CORSRule sets what cross-origin requests may do on a path.
+type CORSRule struct {
+	// Path is matched like a ServeMux pattern: exactly, or as a prefix if
+	// it ends in a slash. The longest matching path applies.
+	Path string `json:"path"`
+	// Methods allowed cross-origin. A rule without methods keeps the path
+	// same-origin only.
+	Methods []string `json:"methods"`
+	// Headers a cross-origin request may send beyond the CORS-safelisted
+	// ones.
+	Headers []string `json:"headers,omitempty"`
+}
+
+// DefaultCORSRules cover what the frontend uses: the JSON API with session
+// cookies or bearer tokens, and ranged reads of video content. The admin
+// API and the runtime counters are same-origin only.
+var DefaultCORSRules = []CORSRule{
+	{
+		Path:    "/api/",
+		Methods: []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete},
+		Headers: []string{"Content-Type", "Authorization", "X-API-Key"},
+	},
+	{Path: "/api/admin/"},
+	{Path: "/content/", Methods: []string{http.MethodGet, http.MethodHead}, Headers: []string{"Range"}},
+	{Path: "/thumbnail/", Methods: []string{http.MethodGet, http.MethodHead}},
+}
+
+// DefaultCORSOrigins is the React development server.
+var DefaultCORSOrigins = []string{"http://localhost:3000"}
+
+// DefaultCORSMaxAge is how long browsers may cache a preflight response.
+const DefaultCORSMaxAge = 10 * time.Minute
+
+// CORSOptions configures a CORSPolicy.
+type CORSOptions struct {
+	// AllowedOrigins lists origins such as "https://app.example.com".
+	// "https://*.example.com" allows every subdomain of example.com, but
+	// not example.com itself. "*" allows any origin, but then credentials
+	// are not allowed.
+	AllowedOrigins []string
+	Rules          []CORSRule    // DefaultCORSRules if nil
+	MaxAge         time.Duration // DefaultCORSMaxAge if zero
+}
+
+// CORSPolicy decides which cross-origin requests are allowed.
+type CORSPolicy struct {
+	origins   []originPattern
+	anyOrigin bool
+	rules     []CORSRule
+	maxAge    string
+}
+
+// originPattern is an allowed origin. A wildcard pattern has host set to
+// the suffix after "*.", including the leading dot.
+type originPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+func NewCORSPolicy(opts CORSOptions) (*CORSPolicy, error) {
+	p := &CORSPolicy{rules: opts.Rules}
+	if p.rules == nil {
+		p.rules = DefaultCORSRules
+	}
+	maxAge := opts.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultCORSMaxAge
+	}
+	if maxAge < 0 {
+		return nil, fmt.Errorf("CORS max age must not be negative")
+	}
+	p.maxAge = fmt.Sprint(int(maxAge.Seconds()))
+
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.TrimSpace(origin)
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, err
+		}
+		p.origins = append(p.origins, pattern)
+	}
+	return p, nil
+}
+
+func parseOriginPattern(origin string) (originPattern, error) {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return originPattern{}, fmt.Errorf("invalid origin %q, want scheme://host[:port]", origin)
+	}
+	pattern := originPattern{scheme: u.Scheme, host: strings.ToLower(u.Hostname()), port: u.Port()}
+	if suffix, ok := strings.CutPrefix(pattern.host, "*."); ok {
+		if suffix == "" || strings.Contains(suffix, "*") {
+			return originPattern{}, fmt.Errorf("invalid origin %q: a wildcard must cover a whole domain", origin)
+		}
+		pattern.host = "." + suffix
+		pattern.wildcard = true
+	} else if strings.Contains(pattern.host, "*") {
+		return originPattern{}, fmt.Errorf("invalid origin %q: only a leading *. wildcard is supported", origin)
+	}
+	return pattern, nil
+}
+
+// LoadCORSRules reads a JSON list of CORSRules, such as
+// [{"path": "/api/", "methods": ["GET"], "headers": ["Authorization"]}].
+// They replace DefaultCORSRules rather than add to them.
+func LoadCORSRules(path string) ([]CORSRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := []CORSRule{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, rule := range rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("%s: rule %d: path must start with /", path, i)
+		}
+		for j, method := range rule.Methods {
+			rules[i].Methods[j] = strings.ToUpper(method)
+		}
+	}
+	return rules, nil
+}
+
+// allowOrigin reports whether origin may make cross-origin requests, and
+// whether it may send credentials.
+func (p *CORSPolicy) allowOrigin(origin string) (allowed, credentials bool) {
+	u, err := url.Parse(origin)
+	if err == nil && u.Host != "" {
+		host, port := strings.ToLower(u.Hostname()), u.Port()
+		for _, pattern := range p.origins {
+			if pattern.scheme != u.Scheme || pattern.port != port {
+				continue
+			}
+			if host == pattern.host || (pattern.wildcard && strings.HasSuffix(host, pattern.host)) {
+				return true, true
+			}
+		}
+	}
+	return p.anyOrigin, false
+}
+
+// rule returns the rule for path, or nil if none matches.
+func (p *CORSPolicy) rule(path string) *CORSRule {
+	var best *CORSRule
+	for i, rule := range p.rules {
+		if matchPathPattern(rule.Path, path) && (best == nil || len(rule.Path) > len(best.Path)) {
+			best = &p.rules[i]
+		}
+	}
+	return best
+}
+
+func (rule *CORSRule) allowsMethod(method string) bool {
+	return slices.Contains(rule.Methods, method)
+}
+
+// allowsHeaders reports whether every header in the comma-separated
+// Access-Control-Request-Headers value may be sent.
+func (rule *CORSRule) allowsHeaders(requested string) bool {
+	for name := range strings.SplitSeq(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.ContainsFunc(rule.Headers, func(allowed string) bool { return strings.EqualFold(allowed, name) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameOrigin reports whether origin is the server's own, as it is for
+// browsers sending Origin on same-origin POSTs. Scheme, host and port must
+// all match, with the scheme's default port filled in where it is left out.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return strings.EqualFold(u.Scheme, scheme) &&
+		strings.EqualFold(withDefaultPort(u.Host, scheme), withDefaultPort(r.Host, scheme))
+}
+
+// withDefaultPort adds the default port of scheme to host if it has none.
+func withDefaultPort(host, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := "80"
+	if scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
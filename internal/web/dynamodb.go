@@ -2,7 +2,13 @@ package web
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -10,23 +16,80 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
 )
 
 // DynamoDBVideoMetadataService implements VideoMetadataService using DynamoDB
 type DynamoDBVideoMetadataService struct {
 	client    *dynamodb.Client
+	streams   *dynamodbstreams.Client // reads the table's stream for Watch
 	tableName string
+
+	// indexesMissing is set once a query finds the table has no list
+	// indexes, after which listing falls back to scanning.
+	indexesMissing atomic.Bool
 }
 
 // videoMetadataItem represents the DynamoDB item structure
 type videoMetadataItem struct {
 	ID         string `dynamodbav:"id"`
 	UploadedAt int64  `dynamodbav:"uploadedAt"` // Unix timestamp
-	Status     string `dynamodbav:"status"`     // "processing", "ready", "error"
+	Status     string `dynamodbav:"status"`     // a VideoStatus, or "processing"/"error" on old items
+	ListKey    string `dynamodbav:"listKey"`    // always dynamoListKey, partition key of dynamoListIndex
+
+	Title       string  `dynamodbav:"title,omitempty"`
+	Description string  `dynamodbav:"description,omitempty"`
+	Duration    float64 `dynamodbav:"duration,omitempty"`
+	FileSize    int64   `dynamodbav:"fileSize,omitempty"`
+	Width       int     `dynamodbav:"width,omitempty"`
+	Height      int     `dynamodbav:"height,omitempty"`
+	Bitrate     int64   `dynamodbav:"bitrate,omitempty"`
+	VideoCodec  string  `dynamodbav:"videoCodec,omitempty"`
+	AudioCodec  string  `dynamodbav:"audioCodec,omitempty"`
+
+	FailureReason string `dynamodbav:"failureReason,omitempty"`
+	Progress      int    `dynamodbav:"progress,omitempty"`
+	DeletedAt     int64  `dynamodbav:"deletedAt,omitempty"` // Unix timestamp, 0 unless trashed
+	RestoreStatus string `dynamodbav:"restoreStatus,omitempty"`
+	OwnerId       string `dynamodbav:"ownerId,omitempty"`
+	Visibility    string `dynamodbav:"visibility,omitempty"`
+
+	Version int64 `dynamodbav:"version"` // missing on items written before versioning, read as 0
+}
+
+func (item videoMetadataItem) toMetadata() VideoMetadata {
+	var deletedAt time.Time
+	if item.DeletedAt != 0 {
+		deletedAt = time.Unix(item.DeletedAt, 0)
+	}
+	return VideoMetadata{
+		Id:          item.ID,
+		UploadedAt:  time.Unix(item.UploadedAt, 0),
+		Status:      legacyStatus(item.Status),
+		Title:       item.Title,
+		Description: item.Description,
+		MediaInfo: MediaInfo{
+			Duration:   item.Duration,
+			FileSize:   item.FileSize,
+			Width:      item.Width,
+			Height:     item.Height,
+			Bitrate:    item.Bitrate,
+			VideoCodec: item.VideoCodec,
+			AudioCodec: item.AudioCodec,
+		},
+		FailureReason: item.FailureReason,
+		Progress:      item.Progress,
+		DeletedAt:     deletedAt,
+		RestoreStatus: VideoStatus(item.RestoreStatus),
+		OwnerId:       item.OwnerId,
+		Visibility:    Visibility(item.Visibility),
+		Version:       item.Version,
+	}
 }
 
 // NewDynamoDBVideoMetadataService creates a new DynamoDB metadata service
-// tableName should be the DynamoDB table name
+// tableName should be the DynamoDB table name. Set DYNAMODB_ENDPOINT (e.g.
+// http://localhost:8000) to use DynamoDB Local instead of AWS.
 func NewDynamoDBVideoMetadataService(tableName string) (*DynamoDBVideoMetadataService, error) {
 	if tableName == "" {
 		return nil, fmt.Errorf("DynamoDB table name cannot be empty")
@@ -37,25 +100,41 @@ func NewDynamoDBVideoMetadataService(tableName string) (*DynamoDBVideoMetadataSe
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	client := dynamodb.NewFromConfig(cfg)
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	streams := dynamodbstreams.NewFromConfig(cfg, func(o *dynamodbstreams.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
 
 	return &DynamoDBVideoMetadataService{
 		client:    client,
+		streams:   streams,
 		tableName: tableName,
 	}, nil
 }
 
 // Create adds a new video metadata entry with "ready" status
-func (s *DynamoDBVideoMetadataService) Create(id string, uploadedAt time.Time) error {
-	return s.CreateWithStatus(id, uploadedAt, "ready")
+func (s *DynamoDBVideoMetadataService) Create(ctx context.Context, id string, uploadedAt time.Time, ownerId string, visibility Visibility) error {
+	return s.CreateWithStatus(ctx, id, uploadedAt, StatusReady, ownerId, visibility)
 }
 
-// CreateWithStatus adds a new video metadata entry with specified status
-func (s *DynamoDBVideoMetadataService) CreateWithStatus(id string, uploadedAt time.Time, status string) error {
+// CreateWithStatus adds a new video metadata entry with specified status,
+// failing with ErrAlreadyExists if the ID is taken
+func (s *DynamoDBVideoMetadataService) CreateWithStatus(ctx context.Context, id string, uploadedAt time.Time, status VideoStatus, ownerId string, visibility Visibility) error {
 	item := videoMetadataItem{
 		ID:         id,
 		UploadedAt: uploadedAt.Unix(),
-		Status:     status,
+		Status:     string(status),
+		OwnerId:    ownerId,
+		Visibility: string(visibility.orPublic()),
+		ListKey:    dynamoListKey,
+		Version:    1,
 	}
 
 	av, err := attributevalue.MarshalMap(item)
@@ -63,11 +142,16 @@ func (s *DynamoDBVideoMetadataService) CreateWithStatus(id string, uploadedAt ti
 		return fmt.Errorf("failed to marshal item: %w", err)
 	}
 
-	_, err = s.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(s.tableName),
-		Item:      av,
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
 	})
 	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return ErrAlreadyExists
+		}
 		return fmt.Errorf("failed to put item: %w", err)
 	}
 
@@ -75,30 +159,117 @@ func (s *DynamoDBVideoMetadataService) CreateWithStatus(id string, uploadedAt ti
 }
 
 // UpdateStatus updates the status of an existing video metadata entry
-func (s *DynamoDBVideoMetadataService) UpdateStatus(id string, status string) error {
-	_, err := s.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+func (s *DynamoDBVideoMetadataService) UpdateStatus(ctx context.Context, id string, status VideoStatus) error {
+	return s.updateFields(ctx, id, map[string]types.AttributeValue{
+		"status": &types.AttributeValueMemberS{Value: string(status)},
+	}, nil)
+}
+
+// UpdateDetails sets the user-supplied title and description
+func (s *DynamoDBVideoMetadataService) UpdateDetails(ctx context.Context, id string, title string, description string) error {
+	return s.updateFields(ctx, id, map[string]types.AttributeValue{
+		"title":       &types.AttributeValueMemberS{Value: title},
+		"description": &types.AttributeValueMemberS{Value: description},
+	}, nil)
+}
+
+// UpdateMediaInfo stores the technical properties found by probing the upload
+func (s *DynamoDBVideoMetadataService) UpdateMediaInfo(ctx context.Context, id string, info MediaInfo) error {
+	return s.updateFields(ctx, id, mediaInfoAttributes(info), nil)
+}
+
+// Update writes meta if the stored version still matches meta.Version
+func (s *DynamoDBVideoMetadataService) Update(ctx context.Context, meta *VideoMetadata) error {
+	fields := mediaInfoAttributes(meta.MediaInfo)
+	fields["status"] = &types.AttributeValueMemberS{Value: string(meta.Status)}
+	fields["failureReason"] = &types.AttributeValueMemberS{Value: meta.FailureReason}
+	fields["progress"] = &types.AttributeValueMemberN{Value: strconv.Itoa(meta.Progress)}
+	fields["restoreStatus"] = &types.AttributeValueMemberS{Value: string(meta.RestoreStatus)}
+	var deletedAt int64
+	if !meta.DeletedAt.IsZero() {
+		deletedAt = meta.DeletedAt.Unix()
+	}
+	fields["deletedAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(deletedAt, 10)}
+	fields["title"] = &types.AttributeValueMemberS{Value: meta.Title}
+	fields["description"] = &types.AttributeValueMemberS{Value: meta.Description}
+	fields["ownerId"] = &types.AttributeValueMemberS{Value: meta.OwnerId}
+	fields["visibility"] = &types.AttributeValueMemberS{Value: string(meta.EffectiveVisibility())}
+
+	if err := s.updateFields(ctx, meta.Id, fields, &meta.Version); err != nil {
+		return err
+	}
+	meta.Version++
+	return nil
+}
+
+func mediaInfoAttributes(info MediaInfo) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"duration":   &types.AttributeValueMemberN{Value: strconv.FormatFloat(info.Duration, 'f', -1, 64)},
+		"fileSize":   &types.AttributeValueMemberN{Value: strconv.FormatInt(info.FileSize, 10)},
+		"width":      &types.AttributeValueMemberN{Value: strconv.Itoa(info.Width)},
+		"height":     &types.AttributeValueMemberN{Value: strconv.Itoa(info.Height)},
+		"bitrate":    &types.AttributeValueMemberN{Value: strconv.FormatInt(info.Bitrate, 10)},
+		"videoCodec": &types.AttributeValueMemberS{Value: info.VideoCodec},
+		"audioCodec": &types.AttributeValueMemberS{Value: info.AudioCodec},
+	}
+}
+
+// updateFields sets the given attributes on an existing item and increments
+// its version. If expectedVersion is not nil the update only applies while
+// the stored version equals it; items from before versioning count as 0.
+func (s *DynamoDBVideoMetadataService) updateFields(ctx context.Context, id string, fields map[string]types.AttributeValue, expectedVersion *int64) error {
+	names := map[string]string{"#version": "version"}
+	values := map[string]types.AttributeValue{
+		":one": &types.AttributeValueMemberN{Value: "1"},
+	}
+	assignments := make([]string, 0, len(fields))
+	for name, value := range fields {
+		names["#"+name] = name
+		values[":"+name] = value
+		assignments = append(assignments, fmt.Sprintf("#%s = :%s", name, name))
+	}
+	sort.Strings(assignments)
+
+	condition := "attribute_exists(id)"
+	if expectedVersion != nil {
+		if *expectedVersion == 0 {
+			condition += " AND attribute_not_exists(#version)"
+		} else {
+			condition += " AND #version = :expectedVersion"
+			values[":expectedVersion"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(*expectedVersion, 10)}
+		}
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
-		UpdateExpression: aws.String("SET #status = :status"),
-		ExpressionAttributeNames: map[string]string{
-			"#status": "status",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":status": &types.AttributeValueMemberS{Value: status},
-		},
+		UpdateExpression:                    aws.String("SET " + strings.Join(assignments, ", ") + " ADD #version :one"),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to update status: %w", err)
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			// The old item comes back only if it exists, which tells a
+			// missing video apart from a version mismatch.
+			if len(condErr.Item) == 0 {
+				return ErrNotFound
+			}
+			return ErrConflict
+		}
+		return fmt.Errorf("failed to update item: %w", err)
 	}
 
 	return nil
 }
 
 // Read retrieves video metadata by ID
-func (s *DynamoDBVideoMetadataService) Read(id string) (*VideoMetadata, error) {
-	result, err := s.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+func (s *DynamoDBVideoMetadataService) Read(ctx context.Context, id string) (*VideoMetadata, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
@@ -118,51 +289,27 @@ func (s *DynamoDBVideoMetadataService) Read(id string) (*VideoMetadata, error) {
 		return nil, fmt.Errorf("failed to unmarshal item: %w", err)
 	}
 
-	return &VideoMetadata{
-		Id:         item.ID,
-		UploadedAt: time.Unix(item.UploadedAt, 0),
-		Status:     item.Status,
-	}, nil
-}
-
-// List retrieves all video metadata entries
-func (s *DynamoDBVideoMetadataService) List() ([]VideoMetadata, error) {
-	result, err := s.client.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(s.tableName),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to scan table: %w", err)
-	}
-
-	var items []videoMetadataItem
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &items)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal items: %w", err)
-	}
-
-	videos := make([]VideoMetadata, 0, len(items))
-	for _, item := range items {
-		videos = append(videos, VideoMetadata{
-			Id:         item.ID,
-			UploadedAt: time.Unix(item.UploadedAt, 0),
-			Status:     item.Status,
-		})
-	}
-
-	return videos, nil
+	meta := item.toMetadata()
+	return &meta, nil
 }
 
 // Delete removes video metadata by ID
-func (s *DynamoDBVideoMetadataService) Delete(id string) error {
-	_, err := s.client.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+func (s *DynamoDBVideoMetadataService) Delete(ctx context.Context, id string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 		TableName: aws.String(s.tableName),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
+		ConditionExpression: aws.String("attribute_exists(id)"),
 	})
 	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return ErrNotFound
+		}
 		return fmt.Errorf("failed to delete item: %w", err)
 	}
 
+	s.deleteACL(ctx, id)
 	return nil
 }
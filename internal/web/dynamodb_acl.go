@@ -0,0 +1,183 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var _ ACLStore = (*DynamoDBVideoMetadataService)(nil)
+
+// Grants are kept in a third table named after the metadata table, keyed by
+// video ID and grantee, with an index by grantee for SharedWith.
+const (
+	dynamoACLTableSuffix = "-acl"
+	dynamoGranteeIndex   = "grantee-index"
+)
+
+// grantItem represents a grant in the ACL table.
+type grantItem struct {
+	VideoId string `dynamodbav:"videoId"`
+	Grantee string `dynamodbav:"grantee"`
+	Role    string `dynamodbav:"role"`
+}
+
+func (s *DynamoDBVideoMetadataService) aclTableName() string {
+	return s.tableName + dynamoACLTableSuffix
+}
+
+func grantKey(videoId string, grantee Grantee) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"videoId": &types.AttributeValueMemberS{Value: videoId},
+		"grantee": &types.AttributeValueMemberS{Value: string(grantee)},
+	}
+}
+
+func (s *DynamoDBVideoMetadataService) ReadACL(ctx context.Context, videoId string) ([]Grant, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.aclTableName()),
+		KeyConditionExpression: aws.String("videoId = :videoId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":videoId": &types.AttributeValueMemberS{Value: videoId},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	var grants []Grant
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query grants: %w", err)
+		}
+		var items []grantItem
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal grants: %w", err)
+		}
+		for _, item := range items {
+			grants = append(grants, Grant{Grantee: Grantee(item.Grantee), Role: Role(item.Role)})
+		}
+	}
+	return grants, nil
+}
+
+func (s *DynamoDBVideoMetadataService) PutGrant(ctx context.Context, videoId string, grant Grant) error {
+	av, err := attributevalue.MarshalMap(grantItem{VideoId: videoId, Grantee: string(grant.Grantee), Role: string(grant.Role)})
+	if err != nil {
+		return fmt.Errorf("failed to marshal grant: %w", err)
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.aclTableName()),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put grant: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoDBVideoMetadataService) RevokeGrant(ctx context.Context, videoId string, grantee Grantee) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(s.aclTableName()),
+		Key:                 grantKey(videoId, grantee),
+		ConditionExpression: aws.String("attribute_exists(videoId)"),
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete grant: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoDBVideoMetadataService) SharedWith(ctx context.Context, grantees []Grantee) ([]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, grantee := range grantees {
+		paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+			TableName:              aws.String(s.aclTableName()),
+			IndexName:              aws.String(dynamoGranteeIndex),
+			KeyConditionExpression: aws.String("grantee = :grantee"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":grantee": &types.AttributeValueMemberS{Value: string(grantee)},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to query shared videos: %w", err)
+			}
+			var items []grantItem
+			if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal grants: %w", err)
+			}
+			for _, item := range items {
+				if !seen[item.VideoId] {
+					seen[item.VideoId] = true
+					ids = append(ids, item.VideoId)
+				}
+			}
+		}
+	}
+	return ids, nil
+}
+
+// deleteACL removes every grant on a deleted video. The video is gone
+// already, so a failure only leaves grants behind and is logged.
+func (s *DynamoDBVideoMetadataService) deleteACL(ctx context.Context, videoId string) {
+	grants, err := s.ReadACL(ctx, videoId)
+	for _, grant := range grants {
+		if err != nil {
+			break
+		}
+		_, err = s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(s.aclTableName()),
+			Key:       grantKey(videoId, grant.Grantee),
+		})
+	}
+	if err != nil {
+		slog.Warn("failed to delete grants of deleted video", "video_id", videoId, "error", err)
+	}
+}
+
+// createACLTable creates the ACL table and its grantee index for
+// CreateTable. An existing table is left alone.
+func (s *DynamoDBVideoMetadataService) createACLTable(ctx context.Context) error {
+	_, err := s.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   aws.String(s.aclTableName()),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("videoId"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("grantee"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("videoId"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("grantee"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+			IndexName: aws.String(dynamoGranteeIndex),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("grantee"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("videoId"), KeyType: types.KeyTypeRange},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeKeysOnly},
+		}},
+	})
+	var inUse *types.ResourceInUseException
+	if errors.As(err, &inUse) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create ACL table: %w", err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(s.client)
+	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(s.aclTableName())}, 2*time.Minute)
+}
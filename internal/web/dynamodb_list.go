@@ -0,0 +1,343 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Global secondary indexes used for listing. Both are sorted by upload time:
+//
+//	dynamoListIndex    listKey (always dynamoListKey) + uploadedAt
+//	dynamoStatusIndex  status + uploadedAt
+//
+// Every item shares one listKey value, which puts the whole list in a single
+// index partition. That keeps a time-ordered query possible without a scan and
+// is fine for a catalogue of this size.
+const (
+	dynamoListIndex   = "listKey-uploadedAt-index"
+	dynamoStatusIndex = "status-uploadedAt-index"
+	dynamoListKey     = "video"
+)
+
+// List retrieves all video metadata entries outside the trash, newest first
+func (s *DynamoDBVideoMetadataService) List(ctx context.Context) ([]VideoMetadata, error) {
+	if !s.indexesMissing.Load() {
+		input := s.indexQuery(ListOptions{SortOrder: SortDesc})
+		var videos []VideoMetadata
+		paginator := dynamodb.NewQueryPaginator(s.client, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if s.checkIndexMissing(err) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to query table: %w", err)
+			}
+			items, err := unmarshalVideoItems(page.Items)
+			if err != nil {
+				return nil, err
+			}
+			videos = append(videos, items...)
+		}
+		if !s.indexesMissing.Load() {
+			return videos, nil
+		}
+	}
+
+	videos, err := s.scanAll(ctx, "", false)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(videos, func(i, j int) bool {
+		return videos[i].UploadedAt.After(videos[j].UploadedAt)
+	})
+	return videos, nil
+}
+
+// Query returns one page of videos. Listings ordered by upload time, with or
+// without a status filter, are served from the time-ordered indexes and read
+// only as far as the requested page, without a Total. Owner and visibility
+// filters are applied to the index items as they are read. Search and other
+// sort orders have no index to use, so they scan the table and sort the
+// matches.
+func (s *DynamoDBVideoMetadataService) Query(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SortBy == SortByUploadedAt && opts.Search == "" && !s.indexesMissing.Load() {
+		result, err := s.queryIndex(ctx, opts)
+		if !s.checkIndexMissing(err) {
+			return result, err
+		}
+	}
+
+	videos, err := s.scanAll(ctx, opts.Status, opts.IncludeTrash)
+	if err != nil {
+		return nil, err
+	}
+	return queryInMemory(videos, opts)
+}
+
+// indexQuery builds the key condition for the index matching opts.Status.
+func (s *DynamoDBVideoMetadataService) indexQuery(opts ListOptions) *dynamodb.QueryInput {
+	input := &dynamodb.QueryInput{
+		TableName:        aws.String(s.tableName),
+		ScanIndexForward: aws.Bool(opts.SortOrder == SortAsc),
+	}
+	if opts.Status != "" {
+		input.IndexName = aws.String(dynamoStatusIndex)
+		input.KeyConditionExpression = aws.String("#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "status"}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: string(opts.Status)},
+		}
+	} else if opts.IncludeTrash {
+		input.IndexName = aws.String(dynamoListIndex)
+		input.KeyConditionExpression = aws.String("listKey = :listKey")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":listKey": &types.AttributeValueMemberS{Value: dynamoListKey},
+		}
+	} else {
+		// Trashed videos stay in the list index and are filtered out. The
+		// filter runs after Limit, which queryIndex makes up for by reading
+		// on until the page is full.
+		input.IndexName = aws.String(dynamoListIndex)
+		input.KeyConditionExpression = aws.String("listKey = :listKey")
+		input.FilterExpression = aws.String("attribute_not_exists(#status) OR #status <> :deleted")
+		input.ExpressionAttributeNames = map[string]string{"#status": "status"}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":listKey": &types.AttributeValueMemberS{Value: dynamoListKey},
+			":deleted": &types.AttributeValueMemberS{Value: string(StatusDeleted)},
+		}
+	}
+	return input
+}
+
+// queryIndex reads one page from the time-ordered index. The cursor is the
+// same keyset cursor the other backends use; it is turned back into the
+// index key of the last item on the previous page.
+func (s *DynamoDBVideoMetadataService) queryIndex(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	input := s.indexQuery(opts)
+
+	if opts.Cursor != "" {
+		value, id, err := decodeCursor(opts)
+		if err != nil {
+			return nil, err
+		}
+		startKey := map[string]types.AttributeValue{
+			"id":         &types.AttributeValueMemberS{Value: id},
+			"uploadedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(value.(time.Time).Unix(), 10)},
+		}
+		if opts.Status != "" {
+			startKey["status"] = &types.AttributeValueMemberS{Value: string(opts.Status)}
+		} else {
+			startKey["listKey"] = &types.AttributeValueMemberS{Value: dynamoListKey}
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	// Ask for one extra item to learn whether another page exists. A
+	// response can stop early at 1 MB, and the owner and visibility filters
+	// drop items after they are read, so keep reading until we have it.
+	var videos []VideoMetadata
+	for len(videos) <= opts.Limit {
+		input.Limit = aws.Int32(int32(opts.Limit + 1 - len(videos)))
+		out, err := s.client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		items, err := unmarshalVideoItems(out.Items)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range items {
+			if matchesFilters(v, opts) {
+				videos = append(videos, v)
+			}
+		}
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	// Counting would read the whole index partition on every page, which
+	// is what the index is here to avoid.
+	result := &ListResult{Videos: videos, Total: TotalUnknown}
+	if len(videos) > opts.Limit {
+		result.Videos = videos[:opts.Limit]
+		result.NextCursor = encodeCursor(result.Videos[opts.Limit-1], opts)
+	}
+	return result, nil
+}
+
+// scanAll reads every item, following LastEvaluatedKey past the 1 MB page
+// limit. A non-empty status is filtered on by DynamoDB; an empty one skips
+// trashed videos unless includeTrash is set.
+func (s *DynamoDBVideoMetadataService) scanAll(ctx context.Context, status VideoStatus, includeTrash bool) ([]VideoMetadata, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(s.tableName),
+		FilterExpression:         aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: string(status)},
+		},
+	}
+	if status == "" && includeTrash {
+		input.FilterExpression = nil
+		input.ExpressionAttributeNames = nil
+		input.ExpressionAttributeValues = nil
+	} else if status == "" {
+		// Items written before statuses existed have none and are ready.
+		input.FilterExpression = aws.String("attribute_not_exists(#status) OR #status <> :status")
+		input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: string(StatusDeleted)}
+	}
+
+	var videos []VideoMetadata
+	paginator := dynamodb.NewScanPaginator(s.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		items, err := unmarshalVideoItems(page.Items)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, items...)
+	}
+	return videos, nil
+}
+
+// checkIndexMissing reports whether err says the list indexes do not exist,
+// and if so remembers it so later calls go straight to scanning.
+func (s *DynamoDBVideoMetadataService) checkIndexMissing(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ValidationException" ||
+		!strings.Contains(apiErr.ErrorMessage(), "index") {
+		return false
+	}
+	if !s.indexesMissing.Swap(true) {
+		slog.Warn("DynamoDB list indexes are missing, falling back to table scans",
+			"table", s.tableName, "indexes", []string{dynamoListIndex, dynamoStatusIndex}, "error", err)
+	}
+	return true
+}
+
+func unmarshalVideoItems(avs []map[string]types.AttributeValue) ([]VideoMetadata, error) {
+	var items []videoMetadataItem
+	if err := attributevalue.UnmarshalListOfMaps(avs, &items); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal items: %w", err)
+	}
+	videos := make([]VideoMetadata, 0, len(items))
+	for _, item := range items {
+		videos = append(videos, item.toMetadata())
+	}
+	return videos, nil
+}
+
+// BackfillListKey sets listKey on items written before the list index
+// existed, so they appear in index queries. It returns the number of items
+// updated and is safe to run repeatedly.
+func (s *DynamoDBVideoMetadataService) BackfillListKey(ctx context.Context) (int, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:            aws.String(s.tableName),
+		FilterExpression:     aws.String("attribute_not_exists(listKey)"),
+		ProjectionExpression: aws.String("id"),
+	})
+
+	updated := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return updated, fmt.Errorf("failed to scan table: %w", err)
+		}
+		for _, key := range page.Items {
+			_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:           aws.String(s.tableName),
+				Key:                 map[string]types.AttributeValue{"id": key["id"]},
+				UpdateExpression:    aws.String("SET listKey = :listKey"),
+				ConditionExpression: aws.String("attribute_exists(id)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":listKey": &types.AttributeValueMemberS{Value: dynamoListKey},
+				},
+			})
+			var condErr *types.ConditionalCheckFailedException
+			if errors.As(err, &condErr) {
+				continue // deleted since the scan
+			}
+			if err != nil {
+				return updated, fmt.Errorf("failed to update item: %w", err)
+			}
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// CreateTable creates the metadata table with its list indexes and a stream
+// for Watch, and the users and ACL tables beside it. It is meant
+// for development against DynamoDB Local; production tables are managed by
+// terraform. An existing table is left alone.
+func (s *DynamoDBVideoMetadataService) CreateTable(ctx context.Context) error {
+	timeOrdered := func(name, hashKey string) types.GlobalSecondaryIndex {
+		return types.GlobalSecondaryIndex{
+			IndexName: aws.String(name),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String(hashKey), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("uploadedAt"), KeyType: types.KeyTypeRange},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}
+	}
+
+	_, err := s.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   aws.String(s.tableName),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("listKey"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("status"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("uploadedAt"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			timeOrdered(dynamoListIndex, "listKey"),
+			timeOrdered(dynamoStatusIndex, "status"),
+		},
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: types.StreamViewTypeNewImage,
+		},
+	})
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	if err == nil {
+		waiter := dynamodb.NewTableExistsWaiter(s.client)
+		if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(s.tableName)}, 2*time.Minute); err != nil {
+			return err
+		}
+	}
+	if err := s.createUsersTable(ctx); err != nil {
+		return err
+	}
+	return s.createACLTable(ctx)
+}
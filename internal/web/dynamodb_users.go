@@ -0,0 +1,109 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var _ UserStore = (*DynamoDBVideoMetadataService)(nil)
+
+// Users are kept in a second table named after the metadata table, keyed by
+// username, so scans and streams of the metadata table only ever see videos.
+const dynamoUsersTableSuffix = "-users"
+
+// userItem represents a user in the users table.
+type userItem struct {
+	Username     string `dynamodbav:"username"`
+	ID           string `dynamodbav:"id"`
+	PasswordHash string `dynamodbav:"passwordHash"`
+	CreatedAt    int64  `dynamodbav:"createdAt"` // Unix timestamp
+}
+
+func (s *DynamoDBVideoMetadataService) usersTableName() string {
+	return s.tableName + dynamoUsersTableSuffix
+}
+
+func (s *DynamoDBVideoMetadataService) CreateUser(ctx context.Context, user User) error {
+	av, err := attributevalue.MarshalMap(userItem{
+		Username:     user.Username,
+		ID:           user.Id,
+		PasswordHash: user.PasswordHash,
+		CreatedAt:    user.CreatedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.usersTableName()),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(username)"),
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return ErrUserExists
+		}
+		return fmt.Errorf("failed to put user: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoDBVideoMetadataService) ReadUser(ctx context.Context, username string) (*User, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.usersTableName()),
+		Key: map[string]types.AttributeValue{
+			"username": &types.AttributeValueMemberS{Value: username},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if out.Item == nil {
+		return nil, nil
+	}
+
+	var item userItem
+	if err := attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return &User{
+		Id:           item.ID,
+		Username:     item.Username,
+		PasswordHash: item.PasswordHash,
+		CreatedAt:    time.Unix(item.CreatedAt, 0).UTC(),
+	}, nil
+}
+
+// createUsersTable creates the users table for CreateTable. An existing
+// table is left alone.
+func (s *DynamoDBVideoMetadataService) createUsersTable(ctx context.Context) error {
+	_, err := s.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   aws.String(s.usersTableName()),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("username"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("username"), KeyType: types.KeyTypeHash},
+		},
+	})
+	var inUse *types.ResourceInUseException
+	if errors.As(err, &inUse) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create users table: %w", err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(s.client)
+	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(s.usersTableName())}, 2*time.Minute)
+}
@@ -0,0 +1,236 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+var _ VideoMetadataWatcher = (*DynamoDBVideoMetadataService)(nil)
+
+// dynamoStreamPollInterval is how often Watch asks each shard for records and
+// looks for new shards.
+const dynamoStreamPollInterval = time.Second
+
+// Watch reads the table's DynamoDB stream, which must be enabled with a view
+// type that includes new images (NEW_IMAGE or NEW_AND_OLD_IMAGES). CreateTable
+// and the terraform table both enable it.
+func (s *DynamoDBVideoMetadataService) Watch(ctx context.Context) (<-chan VideoChange, error) {
+	table, err := s.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(s.tableName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table: %w", err)
+	}
+	streamArn := table.Table.LatestStreamArn
+	if streamArn == nil {
+		return nil, fmt.Errorf("table %s has no stream enabled", s.tableName)
+	}
+
+	reader := &dynamoStreamReader{client: s.streams, streamArn: streamArn, iterators: make(map[string]*string), seen: make(map[string]bool)}
+	// Only changes from now on: start the shards that are open now at their
+	// latest record. Shards that appear later start at their beginning.
+	if err := reader.discoverShards(ctx, streamtypes.ShardIteratorTypeLatest); err != nil {
+		return nil, err
+	}
+
+	changes := make(chan VideoChange, watchBuffer)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(dynamoStreamPollInterval)
+		defer ticker.Stop()
+
+		for {
+			err := reader.poll(ctx, func(change VideoChange) bool {
+				select {
+				case changes <- change:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("dynamodb metadata watch failed", "error", err)
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// dynamoStreamReader follows every shard of a stream. A shard is only started
+// once its parent has been read to the end, so changes to one video are
+// reported in order across shard splits.
+type dynamoStreamReader struct {
+	client    *dynamodbstreams.Client
+	streamArn *string
+	iterators map[string]*string // open shard ID -> next iterator
+	seen      map[string]bool    // every shard started or skipped
+}
+
+// discoverShards starts reading shards not seen before, from the position
+// given by start. Closed shards found on the first call are skipped, since
+// they only hold changes from before Watch.
+func (r *dynamoStreamReader) discoverShards(ctx context.Context, start streamtypes.ShardIteratorType) error {
+	first := len(r.seen) == 0
+	var startAfter *string
+	for {
+		out, err := r.client.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             r.streamArn,
+			ExclusiveStartShardId: startAfter,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe stream: %w", err)
+		}
+
+		for _, shard := range out.StreamDescription.Shards {
+			id := aws.ToString(shard.ShardId)
+			if r.seen[id] {
+				continue
+			}
+			if first && shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil {
+				r.seen[id] = true
+				continue
+			}
+			if parent := aws.ToString(shard.ParentShardId); parent != "" {
+				if _, reading := r.iterators[parent]; reading {
+					continue // picked up once the parent is finished
+				}
+			}
+
+			it, err := r.client.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+				StreamArn:         r.streamArn,
+				ShardId:           shard.ShardId,
+				ShardIteratorType: start,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get shard iterator: %w", err)
+			}
+			r.seen[id] = true
+			r.iterators[id] = it.ShardIterator
+		}
+
+		startAfter = out.StreamDescription.LastEvaluatedShardId
+		if startAfter == nil {
+			return nil
+		}
+	}
+}
+
+// poll reads the new records of every open shard and passes them to emit,
+// stopping early if emit returns false, then looks for new shards.
+func (r *dynamoStreamReader) poll(ctx context.Context, emit func(VideoChange) bool) error {
+	for id, it := range r.iterators {
+		out, err := r.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: it})
+		if err != nil {
+			return fmt.Errorf("failed to get stream records: %w", err)
+		}
+		for _, record := range out.Records {
+			change, err := changeFromStreamRecord(record)
+			if err != nil {
+				slog.Warn("skipping undecodable metadata change", "shard", id, "error", err)
+				continue
+			}
+			if !emit(change) {
+				return nil
+			}
+		}
+		if out.NextShardIterator == nil {
+			delete(r.iterators, id) // the shard is closed and fully read
+		} else {
+			r.iterators[id] = out.NextShardIterator
+		}
+	}
+	return r.discoverShards(ctx, streamtypes.ShardIteratorTypeTrimHorizon)
+}
+
+func changeFromStreamRecord(record streamtypes.Record) (VideoChange, error) {
+	if record.Dynamodb == nil {
+		return VideoChange{}, fmt.Errorf("record %s has no data", aws.ToString(record.EventID))
+	}
+	var key struct {
+		ID string `dynamodbav:"id"`
+	}
+	if err := attributevalue.UnmarshalMap(fromStreamAttributes(record.Dynamodb.Keys), &key); err != nil {
+		return VideoChange{}, fmt.Errorf("failed to unmarshal key: %w", err)
+	}
+
+	change := VideoChange{VideoId: key.ID}
+	switch record.EventName {
+	case streamtypes.OperationTypeInsert:
+		change.Type = ChangeCreated
+	case streamtypes.OperationTypeModify:
+		change.Type = ChangeUpdated
+	case streamtypes.OperationTypeRemove:
+		change.Type = ChangeDeleted
+		return change, nil
+	default:
+		return VideoChange{}, fmt.Errorf("unknown event %q", record.EventName)
+	}
+
+	if record.Dynamodb.NewImage == nil {
+		return VideoChange{}, fmt.Errorf("stream does not include new images")
+	}
+	var item videoMetadataItem
+	if err := attributevalue.UnmarshalMap(fromStreamAttributes(record.Dynamodb.NewImage), &item); err != nil {
+		return VideoChange{}, fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+	meta := item.toMetadata()
+	change.Video = &meta
+	return change, nil
+}
+
+// fromStreamAttributes converts stream attribute values, which are their own
+// types in the SDK, to the DynamoDB ones attributevalue works with.
+func fromStreamAttributes(in map[string]streamtypes.AttributeValue) map[string]types.AttributeValue {
+	out := make(map[string]types.AttributeValue, len(in))
+	for k, v := range in {
+		out[k] = fromStreamAttribute(v)
+	}
+	return out
+}
+
+func fromStreamAttribute(v streamtypes.AttributeValue) types.AttributeValue {
+	switch v := v.(type) {
+	case *streamtypes.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *streamtypes.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *streamtypes.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: v.Value}
+	case *streamtypes.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *streamtypes.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: v.Value}
+	case *streamtypes.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: v.Value}
+	case *streamtypes.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: v.Value}
+	case *streamtypes.AttributeValueMemberBS:
+		return &types.AttributeValueMemberBS{Value: v.Value}
+	case *streamtypes.AttributeValueMemberL:
+		list := make([]types.AttributeValue, len(v.Value))
+		for i, elem := range v.Value {
+			list[i] = fromStreamAttribute(elem)
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case *streamtypes.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: fromStreamAttributes(v.Value)}
+	default:
+		return &types.AttributeValueMemberNULL{Value: true}
+	}
+}
@@ -0,0 +1,28 @@
+package web
+
+import "errors"
+
+// Errors returned by every VideoMetadataService implementation. Callers
+// should test for them with errors.Is, since backends may wrap them.
+var (
+	// ErrAlreadyExists is returned when creating a video whose ID is taken.
+	ErrAlreadyExists = errors.New("video ID already exists")
+	// ErrNotFound is returned when updating or deleting a video that does
+	// not exist. Read reports a missing video as (nil, nil) instead.
+	ErrNotFound = errors.New("video not found")
+	// ErrConflict is returned by Update when the stored version no longer
+	// matches, meaning someone else changed the video since it was read.
+	ErrConflict = errors.New("video was modified concurrently")
+)
+
+// Errors returned by every VideoContentService implementation.
+var (
+	// ErrContentNotFound is returned by Read when the file does not exist.
+	ErrContentNotFound = errors.New("video file not found")
+)
+
+// Errors returned by every UserStore implementation.
+var (
+	// ErrUserExists is returned when registering a username that is taken.
+	ErrUserExists = errors.New("username already taken")
+)
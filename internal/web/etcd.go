@@ -2,8 +2,379 @@
 
 package web
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdKeyPrefix namespaces all video metadata keys in etcd.
+const etcdKeyPrefix = "/tritontube/videos/"
+
+// etcdRequestTimeout bounds every etcd round trip.
+const etcdRequestTimeout = 5 * time.Second
+
+// etcdMaxCASRetries bounds how often a compare-and-swap update is retried
+// when another writer modified the key in between.
+const etcdMaxCASRetries = 10
+
+// EtcdVideoMetadataService implements VideoMetadataService on etcd. Each video
+// is stored as a JSON document under its own key, so every operation touches
+// exactly one key and can use etcd transactions for atomicity.
 type EtcdVideoMetadataService struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// etcdVideoRecord is the JSON document stored per video.
+type etcdVideoRecord struct {
+	Id         string    `json:"id"`
+	UploadedAt time.Time `json:"uploadedAt"`
+	Status     string    `json:"status"`
+
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	MediaInfo   MediaInfo `json:"mediaInfo"`
+
+	FailureReason string `json:"failureReason,omitempty"`
+	Progress      int    `json:"progress,omitempty"`
+
+	DeletedAt     time.Time `json:"deletedAt,omitzero"`
+	RestoreStatus string    `json:"restoreStatus,omitempty"`
+
+	OwnerId    string `json:"ownerId,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+
+	Version int64 `json:"version"`
 }
 
 // Uncomment the following line to ensure EtcdVideoMetadataService implements VideoMetadataService
-// var _ VideoMetadataService = (*EtcdVideoMetadataService)(nil)
+var _ VideoMetadataService = (*EtcdVideoMetadataService)(nil)
+var _ VideoMetadataWatcher = (*EtcdVideoMetadataService)(nil)
+
+// NewEtcdVideoMetadataService connects to the etcd cluster at endpoints.
+func NewEtcdVideoMetadataService(endpoints []string) (*EtcdVideoMetadataService, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("at least one etcd endpoint is required")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdRequestTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
+	}
+
+	return NewEtcdVideoMetadataServiceFromClient(client, etcdKeyPrefix), nil
+}
+
+// NewEtcdVideoMetadataServiceFromClient wraps an existing client, e.g. one
+// connected to an embedded in-process etcd server. prefix must end in "/".
+func NewEtcdVideoMetadataServiceFromClient(client *clientv3.Client, prefix string) *EtcdVideoMetadataService {
+	return &EtcdVideoMetadataService{client: client, prefix: prefix}
+}
+
+// Close releases the underlying etcd client.
+func (s *EtcdVideoMetadataService) Close() error {
+	return s.client.Close()
+}
+
+func (s *EtcdVideoMetadataService) key(videoId string) string {
+	return s.prefix + videoId
+}
+
+// Create adds a new video metadata entry with "ready" status
+func (s *EtcdVideoMetadataService) Create(ctx context.Context, videoId string, uploadedAt time.Time, ownerId string, visibility Visibility) error {
+	return s.CreateWithStatus(ctx, videoId, uploadedAt, StatusReady, ownerId, visibility)
+}
+
+// CreateWithStatus adds a new entry only if no entry exists for videoId yet.
+func (s *EtcdVideoMetadataService) CreateWithStatus(ctx context.Context, videoId string, uploadedAt time.Time, status VideoStatus, ownerId string, visibility Visibility) error {
+	data, err := json.Marshal(etcdVideoRecord{Id: videoId, UploadedAt: uploadedAt, Status: string(status), OwnerId: ownerId, Visibility: string(visibility.orPublic()), Version: 1})
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	key := s.key(videoId)
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("failed to create metadata: %w", err)
+	}
+
+	if !resp.Succeeded {
+		return ErrAlreadyExists
+	}
+
+	return nil
+}
+
+// UpdateStatus changes the status of an existing entry using compare-and-swap
+// on the key's mod revision, retrying if a concurrent writer got there first.
+func (s *EtcdVideoMetadataService) UpdateStatus(ctx context.Context, videoId string, status VideoStatus) error {
+	return s.update(ctx, videoId, func(rec *etcdVideoRecord) error {
+		rec.Status = string(status)
+		return nil
+	})
+}
+
+// UpdateDetails sets the user-supplied title and description.
+func (s *EtcdVideoMetadataService) UpdateDetails(ctx context.Context, videoId string, title string, description string) error {
+	return s.update(ctx, videoId, func(rec *etcdVideoRecord) error {
+		rec.Title = title
+		rec.Description = description
+		return nil
+	})
+}
+
+// UpdateMediaInfo stores the technical properties found by probing the upload.
+func (s *EtcdVideoMetadataService) UpdateMediaInfo(ctx context.Context, videoId string, info MediaInfo) error {
+	return s.update(ctx, videoId, func(rec *etcdVideoRecord) error {
+		rec.MediaInfo = info
+		return nil
+	})
+}
+
+// Update writes meta if the stored version still matches meta.Version. A
+// version mismatch is final and is not retried; only lost races on the key's
+// mod revision are.
+func (s *EtcdVideoMetadataService) Update(ctx context.Context, meta *VideoMetadata) error {
+	err := s.update(ctx, meta.Id, func(rec *etcdVideoRecord) error {
+		if rec.Version != meta.Version {
+			return ErrConflict
+		}
+		rec.Status = string(meta.Status)
+		rec.Title = meta.Title
+		rec.Description = meta.Description
+		rec.MediaInfo = meta.MediaInfo
+		rec.FailureReason = meta.FailureReason
+		rec.Progress = meta.Progress
+		rec.DeletedAt = meta.DeletedAt
+		rec.RestoreStatus = string(meta.RestoreStatus)
+		rec.OwnerId = meta.OwnerId
+		rec.Visibility = string(meta.EffectiveVisibility())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	meta.Version++
+	return nil
+}
+
+// update applies mutate to the stored record atomically and bumps its
+// version. An error from mutate aborts the update and is returned as is.
+func (s *EtcdVideoMetadataService) update(ctx context.Context, videoId string, mutate func(*etcdVideoRecord) error) error {
+	key := s.key(videoId)
+
+	for attempt := 0; attempt < etcdMaxCASRetries; attempt++ {
+		reqCtx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+		getResp, err := s.client.Get(reqCtx, key)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to read metadata: %w", err)
+		}
+		if len(getResp.Kvs) == 0 {
+			cancel()
+			return ErrNotFound
+		}
+
+		kv := getResp.Kvs[0]
+		var rec etcdVideoRecord
+		if err := json.Unmarshal(kv.Value, &rec); err != nil {
+			cancel()
+			return fmt.Errorf("failed to decode metadata: %w", err)
+		}
+
+		if err := mutate(&rec); err != nil {
+			cancel()
+			return err
+		}
+		rec.Version++
+		data, err := json.Marshal(rec)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to encode metadata: %w", err)
+		}
+
+		txnResp, err := s.client.Txn(reqCtx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(clientv3.OpPut(key, string(data))).
+			Commit()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to update metadata: %w", err)
+		}
+		if txnResp.Succeeded {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to update metadata for %s: too many concurrent modifications", videoId)
+}
+
+// Read retrieves video metadata by ID, returning nil if it does not exist.
+func (s *EtcdVideoMetadataService) Read(ctx context.Context, videoId string) (*VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, s.key(videoId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+
+	var rec etcdVideoRecord
+	if err := json.Unmarshal(resp.Kvs[0].Value, &rec); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	meta := rec.toMetadata()
+	return &meta, nil
+}
+
+// List returns every video outside the trash, newest first.
+func (s *EtcdVideoMetadataService) List(ctx context.Context) ([]VideoMetadata, error) {
+	videos, err := s.listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listed := videos[:0]
+	for _, v := range videos {
+		if v.Status != StatusDeleted {
+			listed = append(listed, v)
+		}
+	}
+	return listed, nil
+}
+
+// listAll returns every video including trashed ones, newest first.
+func (s *EtcdVideoMetadataService) listAll(ctx context.Context) ([]VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, s.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metadata: %w", err)
+	}
+
+	videos := make([]VideoMetadata, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var rec etcdVideoRecord
+		if err := json.Unmarshal(kv.Value, &rec); err != nil {
+			return nil, fmt.Errorf("failed to decode metadata for %s: %w", kv.Key, err)
+		}
+		videos = append(videos, rec.toMetadata())
+	}
+
+	sort.SliceStable(videos, func(i, j int) bool {
+		return videos[i].UploadedAt.After(videos[j].UploadedAt)
+	})
+
+	return videos, nil
+}
+
+// Query returns one page of videos. etcd has no secondary indexes, so the
+// prefix is read in full and filtered and sorted in memory.
+func (s *EtcdVideoMetadataService) Query(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	videos, err := s.listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return queryInMemory(videos, opts)
+}
+
+// Delete removes video metadata by ID.
+func (s *EtcdVideoMetadataService) Delete(ctx context.Context, videoId string) error {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := s.client.Delete(ctx, s.key(videoId))
+	if err != nil {
+		return fmt.Errorf("failed to delete metadata: %w", err)
+	}
+	if resp.Deleted == 0 {
+		return ErrNotFound
+	}
+
+	s.deleteACL(ctx, videoId)
+	return nil
+}
+
+func (rec etcdVideoRecord) toMetadata() VideoMetadata {
+	return VideoMetadata{
+		Id:            rec.Id,
+		UploadedAt:    rec.UploadedAt,
+		Status:        legacyStatus(rec.Status),
+		Title:         rec.Title,
+		Description:   rec.Description,
+		MediaInfo:     rec.MediaInfo,
+		FailureReason: rec.FailureReason,
+		Progress:      rec.Progress,
+		DeletedAt:     rec.DeletedAt,
+		RestoreStatus: VideoStatus(rec.RestoreStatus),
+		OwnerId:       rec.OwnerId,
+		Visibility:    Visibility(rec.Visibility),
+		Version:       rec.Version,
+	}
+}
+
+// Watch reports changes to any video under the service's prefix, using an
+// etcd watch, so changes made by other instances are seen too.
+func (s *EtcdVideoMetadataService) Watch(ctx context.Context) (<-chan VideoChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	events := s.client.Watch(clientv3.WithRequireLeader(ctx), s.prefix, clientv3.WithPrefix())
+
+	changes := make(chan VideoChange, watchBuffer)
+	go func() {
+		defer close(changes)
+		for resp := range events {
+			if err := resp.Err(); err != nil {
+				slog.Warn("etcd metadata watch failed", "error", err)
+				return
+			}
+			for _, ev := range resp.Events {
+				change := VideoChange{VideoId: strings.TrimPrefix(string(ev.Kv.Key), s.prefix)}
+				switch {
+				case ev.Type == clientv3.EventTypeDelete:
+					change.Type = ChangeDeleted
+				default:
+					var rec etcdVideoRecord
+					if err := json.Unmarshal(ev.Kv.Value, &rec); err != nil {
+						slog.Warn("skipping undecodable metadata change", "key", string(ev.Kv.Key), "error", err)
+						continue
+					}
+					meta := rec.toMetadata()
+					change.Video = &meta
+					change.Type = ChangeUpdated
+					if ev.IsCreate() {
+						change.Type = ChangeCreated
+					}
+				}
+
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
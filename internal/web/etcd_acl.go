@@ -0,0 +1,116 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ ACLStore = (*EtcdVideoMetadataService)(nil)
+
+// Grants are kept twice beside the video prefix, like users: by video under
+// <prefix>-acl/<videoId>/<grantee>, holding the role, and by grantee under
+// <prefix>-shared/<grantee>/<videoId>, so SharedWith need not read every
+// grant. Both are written in one transaction.
+
+func (s *EtcdVideoMetadataService) aclPrefix(videoId string) string {
+	return strings.TrimSuffix(s.prefix, "/") + "-acl/" + videoId + "/"
+}
+
+func (s *EtcdVideoMetadataService) sharedPrefix(grantee Grantee) string {
+	return strings.TrimSuffix(s.prefix, "/") + "-shared/" + string(grantee) + "/"
+}
+
+func (s *EtcdVideoMetadataService) ReadACL(ctx context.Context, videoId string) ([]Grant, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	prefix := s.aclPrefix(videoId)
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grants: %w", err)
+	}
+	grants := make([]Grant, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		grants = append(grants, Grant{
+			Grantee: Grantee(strings.TrimPrefix(string(kv.Key), prefix)),
+			Role:    Role(kv.Value),
+		})
+	}
+	return grants, nil
+}
+
+func (s *EtcdVideoMetadataService) PutGrant(ctx context.Context, videoId string, grant Grant) error {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	_, err := s.client.Txn(ctx).Then(
+		clientv3.OpPut(s.aclPrefix(videoId)+string(grant.Grantee), string(grant.Role)),
+		clientv3.OpPut(s.sharedPrefix(grant.Grantee)+videoId, ""),
+	).Commit()
+	if err != nil {
+		return fmt.Errorf("failed to put grant: %w", err)
+	}
+	return nil
+}
+
+func (s *EtcdVideoMetadataService) RevokeGrant(ctx context.Context, videoId string, grantee Grantee) error {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	key := s.aclPrefix(videoId) + string(grantee)
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpDelete(key), clientv3.OpDelete(s.sharedPrefix(grantee)+videoId)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("failed to revoke grant: %w", err)
+	}
+	if !resp.Succeeded {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *EtcdVideoMetadataService) SharedWith(ctx context.Context, grantees []Grantee) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, grantee := range grantees {
+		prefix := s.sharedPrefix(grantee)
+		resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read shared videos: %w", err)
+		}
+		for _, kv := range resp.Kvs {
+			if id := strings.TrimPrefix(string(kv.Key), prefix); !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// deleteACL removes every grant on a deleted video. The video is gone
+// already, so a failure only leaves grants behind and is logged.
+func (s *EtcdVideoMetadataService) deleteACL(ctx context.Context, videoId string) {
+	grants, err := s.ReadACL(ctx, videoId)
+	if err == nil && len(grants) > 0 {
+		ops := []clientv3.Op{clientv3.OpDelete(s.aclPrefix(videoId), clientv3.WithPrefix())}
+		for _, grant := range grants {
+			ops = append(ops, clientv3.OpDelete(s.sharedPrefix(grant.Grantee)+videoId))
+		}
+		ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+		defer cancel()
+		_, err = s.client.Txn(ctx).Then(ops...).Commit()
+	}
+	if err != nil {
+		slog.Warn("failed to delete grants of deleted video", "video_id", videoId, "error", err)
+	}
+}
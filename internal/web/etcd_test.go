@@ -0,0 +1,162 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// startEtcd runs an in-process etcd server in a temp dir for the duration
+// of the test and returns a metadata service connected to it.
+func startEtcd(t *testing.T) *EtcdVideoMetadataService {
+	t.Helper()
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{startEtcdServer(t)},
+		DialTimeout: etcdRequestTimeout,
+	})
+	if err != nil {
+		t.Fatalf("failed to connect to etcd: %v", err)
+	}
+	svc := NewEtcdVideoMetadataServiceFromClient(client, "/tritontube-test/")
+	t.Cleanup(func() { svc.Close() })
+	return svc
+}
+
+// startEtcdServer runs an in-process etcd server in a temp dir for the
+// duration of the test and returns its client endpoint.
+func startEtcdServer(t *testing.T) string {
+	t.Helper()
+
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg.ListenClientUrls = []url.URL{*local}
+	cfg.AdvertiseClientUrls = []url.URL{*local}
+	cfg.ListenPeerUrls = []url.URL{*local}
+	cfg.AdvertisePeerUrls = []url.URL{*local}
+	cfg.InitialCluster = cfg.Name + "=" + local.String()
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("failed to start etcd: %v", err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("etcd did not become ready")
+	}
+	return e.Clients[0].Addr().String()
+}
+
+func TestEtcdCreateIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	svc := startEtcd(t)
+
+	uploadedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := svc.CreateWithStatus(ctx, "a", uploadedAt, StatusUploaded, "", ""); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := svc.Create(ctx, "a", uploadedAt.Add(time.Hour), "", ""); !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("second create: got %v, want ErrAlreadyExists", err)
+	}
+
+	meta, err := svc.Read(ctx, "a")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if meta == nil || !meta.UploadedAt.Equal(uploadedAt) || meta.Status != StatusUploaded {
+		t.Fatalf("read: got %+v, want the first create to stand", meta)
+	}
+}
+
+func TestEtcdUpdateRetriesLostRace(t *testing.T) {
+	ctx := context.Background()
+	svc := startEtcd(t)
+
+	if err := svc.Create(ctx, "a", time.Now(), "", ""); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// The first attempt loses the compare-and-swap to a concurrent write,
+	// so the update has to read again and apply on top of it.
+	attempts := 0
+	err := svc.update(ctx, "a", func(rec *etcdVideoRecord) error {
+		attempts++
+		if attempts == 1 {
+			if err := svc.UpdateDetails(ctx, "a", "concurrent", ""); err != nil {
+				t.Fatalf("concurrent update: %v", err)
+			}
+		}
+		rec.Status = string(StatusFailed)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("update took %d attempts, want 2", attempts)
+	}
+
+	meta, err := svc.Read(ctx, "a")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if meta.Title != "concurrent" || meta.Status != StatusFailed || meta.Version != 3 {
+		t.Fatalf("read: got title %q, status %s, version %d; want both writes and version 3", meta.Title, meta.Status, meta.Version)
+	}
+}
+
+func TestEtcdUpdateConflict(t *testing.T) {
+	ctx := context.Background()
+	svc := startEtcd(t)
+
+	if err := svc.Create(ctx, "a", time.Now(), "", ""); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	stale, err := svc.Read(ctx, "a")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := svc.UpdateDetails(ctx, "a", "first", ""); err != nil {
+		t.Fatalf("update details: %v", err)
+	}
+
+	stale.Title = "second"
+	if err := svc.Update(ctx, stale); !errors.Is(err, ErrConflict) {
+		t.Fatalf("update with a stale version: got %v, want ErrConflict", err)
+	}
+	meta, err := svc.Read(ctx, "a")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if meta.Title != "first" {
+		t.Fatalf("read: got title %q, want the conflicting update to be dropped", meta.Title)
+	}
+}
+
+func TestEtcdMissingVideo(t *testing.T) {
+	ctx := context.Background()
+	svc := startEtcd(t)
+
+	if err := svc.UpdateStatus(ctx, "missing", StatusReady); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update status: got %v, want ErrNotFound", err)
+	}
+	if err := svc.Update(ctx, &VideoMetadata{Id: "missing", Version: 1}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update: got %v, want ErrNotFound", err)
+	}
+	if err := svc.Delete(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete: got %v, want ErrNotFound", err)
+	}
+	meta, err := svc.Read(ctx, "missing")
+	if err != nil || meta != nil {
+		t.Errorf("read: got %+v, %v; want nil, nil", meta, err)
+	}
+}
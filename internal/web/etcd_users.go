@@ -0,0 +1,70 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ UserStore = (*EtcdVideoMetadataService)(nil)
+
+// etcdUserRecord is the JSON document stored per user.
+type etcdUserRecord struct {
+	Id           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// usersKey returns the key of a user's JSON document. Users live beside the
+// video prefix rather than under it, so listing videos never sees them; with
+// the default prefix that is /tritontube/videos-users/<username>.
+func (s *EtcdVideoMetadataService) usersKey(username string) string {
+	return strings.TrimSuffix(s.prefix, "/") + "-users/" + username
+}
+
+func (s *EtcdVideoMetadataService) CreateUser(ctx context.Context, user User) error {
+	data, err := json.Marshal(etcdUserRecord(user))
+	if err != nil {
+		return fmt.Errorf("failed to encode user: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	key := s.usersKey(user.Username)
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	if !resp.Succeeded {
+		return ErrUserExists
+	}
+	return nil
+}
+
+func (s *EtcdVideoMetadataService) ReadUser(ctx context.Context, username string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, s.usersKey(username))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	var rec etcdUserRecord
+	if err := json.Unmarshal(resp.Kvs[0].Value, &rec); err != nil {
+		return nil, fmt.Errorf("failed to decode user: %w", err)
+	}
+	user := User(rec)
+	return &user, nil
+}
@@ -0,0 +1,145 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// eventsHeartbeat is how often an idle event stream sends a comment, so
+// proxies do not close it and dead clients are noticed.
+const eventsHeartbeat = 15 * time.Second
+
+// handleAPIEvents handles GET /api/events, a server-sent event stream of
+// video changes, so clients need not poll for processing status.
+//
+// With ?id=, only that video's changes are sent, preceded by a "snapshot"
+// event with its current state. Events are "created", "updated" and, for
+// videos trashed, purged or hidden from the user, "deleted". Created, updated and snapshot events
+// carry the same JSON as GET /api/videos/{id}; deleted events carry only
+// {"id": ...}. The stream ends if the server falls behind, and clients should
+// reconnect and re-read what they show, as EventSource does automatically.
+func (s *server) handleAPIEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.changes == nil {
+		s.sendJSONError(w, "change events are not supported by this metadata service", http.StatusNotImplemented)
+		return
+	}
+	videoId := r.URL.Query().Get("id")
+	user := s.currentUser(r)
+	listed := s.listedFor(r.Context(), user)
+
+	// Subscribe before reading the snapshot so no change falls in between.
+	changes := s.changes.Subscribe(r.Context())
+
+	var snapshot *VideoMetadata
+	if videoId != "" {
+		meta, err := s.metadataService.Read(r.Context(), videoId)
+		if err != nil {
+			slog.Error("failed to read video metadata", "video_id", videoId, "error", err)
+			s.sendJSONError(w, "failed to read video metadata", http.StatusInternalServerError)
+			return
+		}
+		if meta == nil || meta.Status == StatusDeleted || !s.canView(r.Context(), user, meta) {
+			s.sendJSONError(w, "video not found", http.StatusNotFound)
+			return
+		}
+		snapshot = meta
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(event string, data any) bool {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			slog.Error("failed to encode change event", "error", err)
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	// Like listings, the full stream leaves out other users' unlisted and
+	// private videos, except those that were shared with the user when the
+	// stream started. Deletes are only sent for videos the user could see.
+	visible := func(v *VideoMetadata) bool {
+		return (videoId != "" || matchesFilters(*v, listed)) && s.canView(r.Context(), user, v)
+	}
+	// sent holds the videos this stream has told the client about, which
+	// it is told of again when they are deleted or hidden from it.
+	sent := make(map[string]bool)
+
+	if snapshot != nil {
+		if !send("snapshot", s.newAPIVideoResponse(*snapshot)) {
+			return
+		}
+		sent[snapshot.Id] = true
+	} else if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			if videoId != "" && change.VideoId != videoId {
+				continue
+			}
+			if change.Type == ChangeDeleted || change.Video == nil || change.Video.Status == StatusDeleted {
+				// A video the client may have listed before the stream
+				// started is judged as it was before it went to the trash.
+				// Purged videos leave nothing to judge.
+				wasVisible := sent[change.VideoId]
+				if !wasVisible && change.Video != nil {
+					prior := *change.Video
+					prior.Status = prior.RestoreStatus
+					wasVisible = visible(&prior)
+				}
+				if !wasVisible {
+					continue
+				}
+				delete(sent, change.VideoId)
+				if !send(string(ChangeDeleted), map[string]string{"id": change.VideoId}) {
+					return
+				}
+				continue
+			}
+			if !visible(change.Video) {
+				// A video made private is gone as far as this client is
+				// concerned.
+				if sent[change.VideoId] {
+					delete(sent, change.VideoId)
+					if !send(string(ChangeDeleted), map[string]string{"id": change.VideoId}) {
+						return
+					}
+				}
+				continue
+			}
+			sent[change.VideoId] = true
+			if !send(string(change.Type), s.newAPIVideoResponse(*change.Video)) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
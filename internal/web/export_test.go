@@ -0,0 +1,5 @@
+package web
+
+// StartEtcdServer lets the conformance tests in package web_test run etcd
+// in-process.
+var StartEtcdServer = startEtcdServer
@@ -0,0 +1,41 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetadataServiceTypes lists the backends OpenVideoMetadataService accepts.
+var MetadataServiceTypes = []string{"sqlite", "dynamodb", "etcd", "memory"}
+
+// OpenVideoMetadataService constructs the metadata backend named by kind.
+// options is backend specific: a database path for sqlite, a table name for
+// dynamodb and comma-separated endpoints for etcd; memory takes none.
+//
+// Callers that need backend-specific setup, such as creating a DynamoDB
+// table, can type-assert the result to the concrete service.
+func OpenVideoMetadataService(kind, options string) (VideoMetadataService, error) {
+	switch kind {
+	case "sqlite":
+		svc, err := NewSQLiteVideoMetadataService(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open SQLite metadata service: %w", err)
+		}
+		return svc, nil
+	case "dynamodb":
+		svc, err := NewDynamoDBVideoMetadataService(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open DynamoDB metadata service: %w", err)
+		}
+		return svc, nil
+	case "etcd":
+		svc, err := NewEtcdVideoMetadataService(strings.Split(options, ","))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open etcd metadata service: %w", err)
+		}
+		return svc, nil
+	case "memory":
+		return NewMemoryVideoMetadataService(), nil
+	}
+	return nil, fmt.Errorf("unsupported metadata service type %q (want one of %s)", kind, strings.Join(MetadataServiceTypes, ", "))
+}
@@ -3,14 +3,19 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"tritontube/internal/encryption"
 )
 
 // FSVideoContentService implements VideoContentService using the local filesystem.
 type FSVideoContentService struct {
 	baseDir string
+	keyring *encryption.Keyring
 }
 
 // Uncomment the following line to ensure FSVideoContentService implements VideoContentService
@@ -20,12 +25,32 @@ func NewFSVideoContentService(baseDir string) *FSVideoContentService {
 	return &FSVideoContentService{baseDir: baseDir}
 }
 
-func (fs *FSVideoContentService) Write(videoId string, filename string, data []byte) error {
+// NewEncryptedFSVideoContentService creates a filesystem content service that
+// encrypts files at rest with keys from the given keyring.
+func NewEncryptedFSVideoContentService(baseDir string, keyring *encryption.Keyring) *FSVideoContentService {
+	return &FSVideoContentService{baseDir: baseDir, keyring: keyring}
+}
+
+// Local file operations cannot be interrupted, so the FS methods only check
+// ctx before starting.
+
+func (fs *FSVideoContentService) Write(ctx context.Context, videoId string, filename string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	videoDir := filepath.Join(fs.baseDir, videoId)
 	if err := os.MkdirAll(videoDir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
+	if fs.keyring != nil {
+		sealed, err := fs.keyring.Seal(data, []byte(videoId+"/"+filename))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt video file: %w", err)
+		}
+		data = sealed
+	}
+
 	filePath := filepath.Join(videoDir, filename)
 	if err := os.WriteFile(filePath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write video file: %w", err)
@@ -34,17 +59,35 @@ func (fs *FSVideoContentService) Write(videoId string, filename string, data []b
 	return nil
 }
 
-func (fs *FSVideoContentService) Read(videoId string, filename string) ([]byte, error) {
+func (fs *FSVideoContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	fullPath := filepath.Join(fs.baseDir, videoId, filename)
 	data, err := os.ReadFile(fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrContentNotFound, videoId, filename)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
+	if fs.keyring != nil {
+		data, err = fs.keyring.Open(data, []byte(videoId+"/"+filename))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt file: %w", err)
+		}
+	} else if encryption.IsSealed(data) {
+		return nil, fmt.Errorf("file %s is encrypted but no keyfile is configured", fullPath)
+	}
+
 	return data, nil
 }
 
-func (fs *FSVideoContentService) DeleteAll(videoId string) error {
+func (fs *FSVideoContentService) DeleteAll(ctx context.Context, videoId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	videoDir := filepath.Join(fs.baseDir, videoId)
 	if err := os.RemoveAll(videoDir); err != nil {
 		return fmt.Errorf("failed to delete video directory: %w", err)
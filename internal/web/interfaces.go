@@ -1,24 +1,75 @@
 package web
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type VideoMetadata struct {
-	Id         string
-	UploadedAt time.Time
-	Status     string // "processing", "ready", "error"
+	Id          string
+	UploadedAt  time.Time
+	Status      VideoStatus
+	Title       string
+	Description string
+	MediaInfo
+
+	FailureReason string // why the video failed, set while Status is StatusFailed
+	Progress      int    // percent of transcoding done, 0-100
+
+	// Set while the video is in the trash (Status is StatusDeleted).
+	DeletedAt     time.Time
+	RestoreStatus VideoStatus // status to return to when restored
+
+	OwnerId    string     // Id of the User who uploaded the video, empty for older videos
+	Visibility Visibility // who may find and watch the video; empty means public
+
+	// Version increases with every write. Update only succeeds if it still
+	// matches the stored value.
+	Version int64
+}
+
+// MediaInfo holds the technical properties of the uploaded source file. It is
+// filled in by probing the file during transcoding.
+type MediaInfo struct {
+	Duration   float64 `json:"duration"` // seconds
+	FileSize   int64   `json:"fileSize"` // bytes
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Bitrate    int64   `json:"bitrate"` // bits per second
+	VideoCodec string  `json:"videoCodec"`
+	AudioCodec string  `json:"audioCodec"`
 }
 
+// VideoMetadataService stores video metadata. Every method honours the
+// cancellation and deadline of ctx.
 type VideoMetadataService interface {
-	Read(id string) (*VideoMetadata, error)
-	List() ([]VideoMetadata, error)
-	Create(videoId string, uploadedAt time.Time) error
-	CreateWithStatus(videoId string, uploadedAt time.Time, status string) error
-	UpdateStatus(videoId string, status string) error
-	Delete(id string) error
+	Read(ctx context.Context, id string) (*VideoMetadata, error)
+	// List returns every video except those in the trash, newest first.
+	List(ctx context.Context) ([]VideoMetadata, error)
+	Query(ctx context.Context, opts ListOptions) (*ListResult, error)
+	// Create adds a "ready" video owned by ownerId, or by nobody if it is
+	// empty, and returns ErrAlreadyExists if the ID is taken. The video has
+	// the given visibility from the start; unset means public.
+	Create(ctx context.Context, videoId string, uploadedAt time.Time, ownerId string, visibility Visibility) error
+	// CreateWithStatus is Create with an initial status other than ready.
+	CreateWithStatus(ctx context.Context, videoId string, uploadedAt time.Time, status VideoStatus, ownerId string, visibility Visibility) error
+	// UpdateStatus sets the status without checking the transition. Use
+	// TransitionStatus for lifecycle changes.
+	UpdateStatus(ctx context.Context, videoId string, status VideoStatus) error
+	UpdateDetails(ctx context.Context, videoId string, title string, description string) error
+	UpdateMediaInfo(ctx context.Context, videoId string, info MediaInfo) error
+	// Update stores every field of meta except Id and UploadedAt if
+	// meta.Version matches the stored version, and then increments
+	// meta.Version. It returns ErrConflict if the video changed since it was
+	// read and ErrNotFound if it no longer exists.
+	Update(ctx context.Context, meta *VideoMetadata) error
+	Delete(ctx context.Context, id string) error
 }
 
+// VideoContentService stores the files of transcoded videos. Every method
+// honours the cancellation and deadline of ctx.
 type VideoContentService interface {
-	Read(videoId string, filename string) ([]byte, error)
-	Write(videoId string, filename string, data []byte) error
-	DeleteAll(videoId string) error
+	Read(ctx context.Context, videoId string, filename string) ([]byte, error)
+	Write(ctx context.Context, videoId string, filename string, data []byte) error
+	DeleteAll(ctx context.Context, videoId string) error
 }
@@ -0,0 +1,243 @@
+package web
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for a JWT that is malformed, badly signed,
+// expired or meant for someone else.
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTConfig configures a JWTVerifier. At least one of HMACSecret and
+// RSAPublicKey must be set; a token is accepted with whichever algorithm
+// matches its header.
+type JWTConfig struct {
+	HMACSecret   []byte         // for HS256
+	RSAPublicKey *rsa.PublicKey // for RS256
+	Issuer       string         // if set, the iss claim must match
+	Audience     string         // if set, the aud claim must contain it
+	Leeway       time.Duration  // allowed clock skew for exp and nbf
+}
+
+// JWTVerifier checks bearer tokens issued by an external identity provider.
+// Only compact JWS tokens signed with HS256 or RS256 are accepted, and the
+// exp claim is required.
+type JWTVerifier struct {
+	cfg JWTConfig
+}
+
+// minHMACSecret is the shortest HS256 secret accepted; RFC 7518 requires a
+// key at least as long as the hash output.
+const minHMACSecret = 32
+
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	if cfg.HMACSecret == nil && cfg.RSAPublicKey == nil {
+		return nil, fmt.Errorf("JWT verification needs an HMAC secret or an RSA public key")
+	}
+	if cfg.HMACSecret != nil && len(cfg.HMACSecret) < minHMACSecret {
+		return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minHMACSecret)
+	}
+	if cfg.RSAPublicKey != nil && cfg.RSAPublicKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RS256 public key must be at least 2048 bits")
+	}
+	return &JWTVerifier{cfg: cfg}, nil
+}
+
+// LoadRSAPublicKey reads a PEM encoded RSA public key, either PKIX
+// ("PUBLIC KEY"), PKCS #1 ("RSA PUBLIC KEY") or inside a certificate.
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA public key", path)
+	}
+	return rsaKey, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	Username  string      `json:"preferred_username"`
+	Scope     string      `json:"scope"` // space separated, RFC 8693
+	Scopes    []string    `json:"scp"`   // as a list, as some providers send it
+	Groups    []string    `json:"groups"`
+}
+
+// jwtAudience is the aud claim, which may be a single string or a list.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// Verify checks token's signature and claims at time now and returns who it
+// was issued to. Errors wrap ErrInvalidToken.
+func (v *JWTVerifier) Verify(token string, now time.Time) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a compact JWS", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkSignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	// Only look at the claims once the signature is known to be good.
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(&claims, now); err != nil {
+		return nil, err
+	}
+
+	scopes := claims.Scopes
+	if claims.Scope != "" {
+		scopes = append(scopes, strings.Fields(claims.Scope)...)
+	}
+	// Groups that are not valid names could never have been granted
+	// anything, so they are dropped rather than failing the token.
+	var groups []string
+	for _, group := range claims.Groups {
+		if group, err := NormalizeGroup(group); err == nil {
+			groups = append(groups, group)
+		}
+	}
+	return &Principal{
+		UserId:   jwtUserId(claims.Issuer, claims.Subject),
+		Username: claims.Username,
+		Scopes:   scopes,
+		Groups:   groups,
+		Method:   AuthMethodJWT,
+	}, nil
+}
+
+// jwtUserId namespaces a token's subject by its issuer. Subjects are only
+// unique per identity provider, and unprefixed they could equal the ID of a
+// local account and be handed its videos.
+func jwtUserId(issuer, subject string) string {
+	return "jwt:" + issuer + ":" + subject
+}
+
+// checkSignature verifies signature over signed. The algorithm named in the
+// header must be one a key is configured for, so a token cannot pick "none"
+// or get an RSA public key used as an HMAC secret.
+func (v *JWTVerifier) checkSignature(alg, signed string, signature []byte) error {
+	switch {
+	case alg == "HS256" && v.cfg.HMACSecret != nil:
+		mac := hmac.New(sha256.New, v.cfg.HMACSecret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	case alg == "RS256" && v.cfg.RSAPublicKey != nil:
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(v.cfg.RSAPublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+}
+
+func (v *JWTVerifier) checkClaims(claims *jwtClaims, now time.Time) error {
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if now.After(unixTime(*claims.ExpiresAt).Add(v.cfg.Leeway)) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != nil && now.Add(v.cfg.Leeway).Before(unixTime(*claims.NotBefore)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if v.cfg.Issuer != "" && claims.Issuer != v.cfg.Issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if v.cfg.Audience != "" && !slices.Contains(claims.Audience, v.cfg.Audience) {
+		return fmt.Errorf("%w: not issued for this audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// unixTime converts a JWT NumericDate, which may have a fractional part.
+func unixTime(seconds float64) time.Time {
+	return time.UnixMilli(int64(seconds * 1000))
+}
@@ -0,0 +1,353 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryVideoMetadataService implements VideoMetadataService in process
+// memory. Nothing survives a restart, so it is meant for tests, demos and as
+// the reference the conformance suite in webtest is checked against.
+type MemoryVideoMetadataService struct {
+	mu     sync.RWMutex
+	videos map[string]VideoMetadata
+	users  map[string]User             // by username
+	acls   map[string]map[Grantee]Role // videoId -> grantee -> role
+	feed   *changeFeed
+}
+
+// Uncomment the following line to ensure MemoryVideoMetadataService implements VideoMetadataService
+var _ VideoMetadataService = (*MemoryVideoMetadataService)(nil)
+var _ VideoMetadataWatcher = (*MemoryVideoMetadataService)(nil)
+var _ UserStore = (*MemoryVideoMetadataService)(nil)
+var _ ACLStore = (*MemoryVideoMetadataService)(nil)
+
+func NewMemoryVideoMetadataService() *MemoryVideoMetadataService {
+	return &MemoryVideoMetadataService{
+		videos: make(map[string]VideoMetadata),
+		users:  make(map[string]User),
+		acls:   make(map[string]map[Grantee]Role),
+		feed:   newChangeFeed(),
+	}
+}
+
+// In-memory operations never block, so the memory services only check ctx
+// before starting, like the filesystem content service.
+
+// Create adds a new video metadata entry with "ready" status
+func (s *MemoryVideoMetadataService) Create(ctx context.Context, videoId string, uploadedAt time.Time, ownerId string, visibility Visibility) error {
+	return s.CreateWithStatus(ctx, videoId, uploadedAt, StatusReady, ownerId, visibility)
+}
+
+// CreateWithStatus adds a new entry, failing with ErrAlreadyExists if the ID
+// is taken.
+func (s *MemoryVideoMetadataService) CreateWithStatus(ctx context.Context, videoId string, uploadedAt time.Time, status VideoStatus, ownerId string, visibility Visibility) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.videos[videoId]; ok {
+		return ErrAlreadyExists
+	}
+	meta := VideoMetadata{Id: videoId, UploadedAt: uploadedAt, Status: status, OwnerId: ownerId, Visibility: visibility, Version: 1}
+	s.videos[videoId] = meta
+	s.feed.publish(VideoChange{Type: ChangeCreated, VideoId: videoId, Video: &meta})
+	return nil
+}
+
+func (s *MemoryVideoMetadataService) UpdateStatus(ctx context.Context, videoId string, status VideoStatus) error {
+	return s.update(ctx, videoId, func(meta *VideoMetadata) error {
+		meta.Status = status
+		return nil
+	})
+}
+
+func (s *MemoryVideoMetadataService) UpdateDetails(ctx context.Context, videoId string, title string, description string) error {
+	return s.update(ctx, videoId, func(meta *VideoMetadata) error {
+		meta.Title = title
+		meta.Description = description
+		return nil
+	})
+}
+
+func (s *MemoryVideoMetadataService) UpdateMediaInfo(ctx context.Context, videoId string, info MediaInfo) error {
+	return s.update(ctx, videoId, func(meta *VideoMetadata) error {
+		meta.MediaInfo = info
+		return nil
+	})
+}
+
+// Update replaces the stored entry with meta if its version still matches.
+func (s *MemoryVideoMetadataService) Update(ctx context.Context, meta *VideoMetadata) error {
+	err := s.update(ctx, meta.Id, func(stored *VideoMetadata) error {
+		if stored.Version != meta.Version {
+			return ErrConflict
+		}
+		*stored = *meta
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	meta.Version++
+	return nil
+}
+
+// update applies mutate to the stored entry and bumps its version. An error
+// from mutate leaves the entry unchanged.
+func (s *MemoryVideoMetadataService) update(ctx context.Context, videoId string, mutate func(*VideoMetadata) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meta, ok := s.videos[videoId]
+	if !ok {
+		return ErrNotFound
+	}
+	version := meta.Version
+	if err := mutate(&meta); err != nil {
+		return err
+	}
+	meta.Version = version + 1
+	s.videos[videoId] = meta
+	changed := meta
+	s.feed.publish(VideoChange{Type: ChangeUpdated, VideoId: videoId, Video: &changed})
+	return nil
+}
+
+// Read returns a copy of the entry, or nil if it does not exist.
+func (s *MemoryVideoMetadataService) Read(ctx context.Context, videoId string) (*VideoMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta, ok := s.videos[videoId]
+	if !ok {
+		return nil, nil
+	}
+	return &meta, nil
+}
+
+// List returns every video outside the trash, newest first.
+func (s *MemoryVideoMetadataService) List(ctx context.Context) ([]VideoMetadata, error) {
+	videos, err := s.listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listed := videos[:0]
+	for _, v := range videos {
+		if v.Status != StatusDeleted {
+			listed = append(listed, v)
+		}
+	}
+	return listed, nil
+}
+
+// listAll returns every video including trashed ones, newest first.
+func (s *MemoryVideoMetadataService) listAll(ctx context.Context) ([]VideoMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	videos := make([]VideoMetadata, 0, len(s.videos))
+	for _, v := range s.videos {
+		videos = append(videos, v)
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(videos, func(i, j int) bool {
+		if !videos[i].UploadedAt.Equal(videos[j].UploadedAt) {
+			return videos[i].UploadedAt.After(videos[j].UploadedAt)
+		}
+		return videos[i].Id < videos[j].Id
+	})
+	return videos, nil
+}
+
+// Query returns one page of videos, filtered and sorted in memory.
+func (s *MemoryVideoMetadataService) Query(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	videos, err := s.listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return queryInMemory(videos, opts)
+}
+
+// Delete removes an entry, returning ErrNotFound if it does not exist.
+func (s *MemoryVideoMetadataService) Delete(ctx context.Context, videoId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.videos[videoId]; !ok {
+		return ErrNotFound
+	}
+	delete(s.videos, videoId)
+	delete(s.acls, videoId)
+	s.feed.publish(VideoChange{Type: ChangeDeleted, VideoId: videoId})
+	return nil
+}
+
+// Watch reports changes made through this service.
+func (s *MemoryVideoMetadataService) Watch(ctx context.Context) (<-chan VideoChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.feed.subscribe(ctx), nil
+}
+
+func (s *MemoryVideoMetadataService) CreateUser(ctx context.Context, user User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.Username]; ok {
+		return ErrUserExists
+	}
+	s.users[user.Username] = user
+	return nil
+}
+
+func (s *MemoryVideoMetadataService) ReadUser(ctx context.Context, username string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (s *MemoryVideoMetadataService) ReadACL(ctx context.Context, videoId string) ([]Grant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var grants []Grant
+	for grantee, role := range s.acls[videoId] {
+		grants = append(grants, Grant{Grantee: grantee, Role: role})
+	}
+	return grants, nil
+}
+
+func (s *MemoryVideoMetadataService) PutGrant(ctx context.Context, videoId string, grant Grant) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.acls[videoId] == nil {
+		s.acls[videoId] = make(map[Grantee]Role)
+	}
+	s.acls[videoId][grant.Grantee] = grant.Role
+	return nil
+}
+
+func (s *MemoryVideoMetadataService) RevokeGrant(ctx context.Context, videoId string, grantee Grantee) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.acls[videoId][grantee]; !ok {
+		return ErrNotFound
+	}
+	delete(s.acls[videoId], grantee)
+	if len(s.acls[videoId]) == 0 {
+		delete(s.acls, videoId)
+	}
+	return nil
+}
+
+func (s *MemoryVideoMetadataService) SharedWith(ctx context.Context, grantees []Grantee) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for videoId, acl := range s.acls {
+		for _, grantee := range grantees {
+			if _, ok := acl[grantee]; ok {
+				ids = append(ids, videoId)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// MemoryVideoContentService implements VideoContentService in process memory.
+type MemoryVideoContentService struct {
+	mu    sync.RWMutex
+	files map[string]map[string][]byte // videoId -> filename -> data
+}
+
+// Uncomment the following line to ensure MemoryVideoContentService implements VideoContentService
+var _ VideoContentService = (*MemoryVideoContentService)(nil)
+
+func NewMemoryVideoContentService() *MemoryVideoContentService {
+	return &MemoryVideoContentService{files: make(map[string]map[string][]byte)}
+}
+
+func (s *MemoryVideoContentService) Write(ctx context.Context, videoId string, filename string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.files[videoId] == nil {
+		s.files[videoId] = make(map[string][]byte)
+	}
+	// Copy so the caller may reuse data.
+	s.files[videoId][filename] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *MemoryVideoContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.files[videoId][filename]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrContentNotFound, videoId, filename)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryVideoContentService) DeleteAll(ctx context.Context, videoId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.files, videoId)
+	return nil
+}
@@ -0,0 +1,5 @@
+-- The original schema, before status was added.
+CREATE TABLE IF NOT EXISTS video_metadata (
+	video_id TEXT PRIMARY KEY,
+	uploaded_at DATETIME
+);
@@ -0,0 +1 @@
+ALTER TABLE video_metadata ADD COLUMN status TEXT DEFAULT 'ready';
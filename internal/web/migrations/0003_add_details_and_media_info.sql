@@ -0,0 +1,9 @@
+ALTER TABLE video_metadata ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE video_metadata ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE video_metadata ADD COLUMN duration REAL NOT NULL DEFAULT 0;
+ALTER TABLE video_metadata ADD COLUMN file_size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE video_metadata ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE video_metadata ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE video_metadata ADD COLUMN bitrate INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE video_metadata ADD COLUMN video_codec TEXT NOT NULL DEFAULT '';
+ALTER TABLE video_metadata ADD COLUMN audio_codec TEXT NOT NULL DEFAULT '';
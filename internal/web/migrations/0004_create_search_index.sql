@@ -0,0 +1,31 @@
+-- Full-text index over titles and descriptions. It keeps its own copy of the
+-- text keyed by video_id rather than rowid, which VACUUM may renumber, and the
+-- triggers keep it in step with video_metadata.
+CREATE VIRTUAL TABLE IF NOT EXISTS video_search USING fts5(
+	video_id UNINDEXED,
+	title,
+	description,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3'
+);
+
+CREATE TRIGGER IF NOT EXISTS video_search_insert AFTER INSERT ON video_metadata BEGIN
+	INSERT INTO video_search (video_id, title, description)
+	VALUES (new.video_id, new.title, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_delete AFTER DELETE ON video_metadata BEGIN
+	DELETE FROM video_search WHERE video_id = old.video_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_search_update AFTER UPDATE OF video_id, title, description ON video_metadata BEGIN
+	DELETE FROM video_search WHERE video_id = old.video_id;
+	INSERT INTO video_search (video_id, title, description)
+	VALUES (new.video_id, new.title, new.description);
+END;
+
+-- Rebuild from scratch so databases that already had the index end up with
+-- exactly one entry per video.
+DELETE FROM video_search;
+INSERT INTO video_search (video_id, title, description)
+SELECT video_id, title, description FROM video_metadata;
@@ -0,0 +1,2 @@
+-- Incremented on every write, for compare-and-set updates.
+ALTER TABLE video_metadata ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
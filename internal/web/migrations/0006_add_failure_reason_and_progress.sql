@@ -0,0 +1,7 @@
+ALTER TABLE video_metadata ADD COLUMN failure_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE video_metadata ADD COLUMN progress INTEGER NOT NULL DEFAULT 0;
+
+-- Map the statuses used before the typed lifecycle onto it.
+UPDATE video_metadata SET status = 'ready' WHERE status IS NULL;
+UPDATE video_metadata SET status = 'transcoding' WHERE status = 'processing';
+UPDATE video_metadata SET status = 'failed' WHERE status = 'error';
@@ -0,0 +1,5 @@
+ALTER TABLE video_metadata ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE video_metadata ADD COLUMN restore_status TEXT NOT NULL DEFAULT '';
+
+-- The purger looks for trashed videos by deletion time.
+CREATE INDEX IF NOT EXISTS idx_video_metadata_deleted_at ON video_metadata (deleted_at) WHERE deleted_at IS NOT NULL;
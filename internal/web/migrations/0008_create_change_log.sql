@@ -0,0 +1,26 @@
+-- Change log read by Watch. The triggers record every write, including ones
+-- made by other processes sharing the database file; watchers poll for rows
+-- past the last sequence number they saw.
+CREATE TABLE IF NOT EXISTS video_changes (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	video_id TEXT NOT NULL,
+	change TEXT NOT NULL,
+	changed_at INTEGER NOT NULL DEFAULT (CAST(strftime('%s', 'now') AS INTEGER))
+);
+
+CREATE TRIGGER IF NOT EXISTS video_changes_insert AFTER INSERT ON video_metadata BEGIN
+	INSERT INTO video_changes (video_id, change) VALUES (new.video_id, 'created');
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_changes_update AFTER UPDATE ON video_metadata BEGIN
+	INSERT INTO video_changes (video_id, change) VALUES (new.video_id, 'updated');
+END;
+
+CREATE TRIGGER IF NOT EXISTS video_changes_delete AFTER DELETE ON video_metadata BEGIN
+	INSERT INTO video_changes (video_id, change) VALUES (old.video_id, 'deleted');
+END;
+
+-- Watchers only need recent history, so keep the log bounded.
+CREATE TRIGGER IF NOT EXISTS video_changes_prune AFTER INSERT ON video_changes BEGIN
+	DELETE FROM video_changes WHERE seq <= new.seq - 10000;
+END;
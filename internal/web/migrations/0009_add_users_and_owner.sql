@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS users (
+	user_id TEXT PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+-- Videos uploaded before accounts existed keep an empty owner.
+ALTER TABLE video_metadata ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+
+-- "My videos" listings filter by owner.
+CREATE INDEX IF NOT EXISTS idx_video_metadata_owner_id ON video_metadata (owner_id);
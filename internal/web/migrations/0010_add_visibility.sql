@@ -0,0 +1,2 @@
+-- Videos uploaded before visibility existed stay public.
+ALTER TABLE video_metadata ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
@@ -0,0 +1,15 @@
+-- Who each video is shared with. Grants go when their video is deleted, not
+-- when it is moved to the trash.
+CREATE TABLE IF NOT EXISTS video_acl (
+	video_id TEXT NOT NULL,
+	grantee TEXT NOT NULL,
+	role TEXT NOT NULL,
+	PRIMARY KEY (video_id, grantee)
+);
+
+-- Listings look up the videos shared with a user and their groups.
+CREATE INDEX IF NOT EXISTS idx_video_acl_grantee ON video_acl (grantee);
+
+CREATE TRIGGER IF NOT EXISTS video_acl_delete AFTER DELETE ON video_metadata BEGIN
+	DELETE FROM video_acl WHERE video_id = old.video_id;
+END;
@@ -0,0 +1,4 @@
+-- Rewrite uploaded_at values stored in any format other than the fixed-width
+-- UTC one, so that comparing the text compares the times. The driver used to
+-- write time.String() values, which SQL cannot parse, so the rewrite is done
+-- in Go by normalizeUploadTimes.
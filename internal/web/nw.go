@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"log/slog"
 	"sort"
 	"sync"
 	"time"
@@ -14,9 +15,23 @@ import (
 	"tritontube/internal/proto"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
+// defaultRPCTimeout bounds each storage node RPC unless SetRPCTimeout
+// changes it.
+const defaultRPCTimeout = 5 * time.Second
+
+// defaultReplicas is how many nodes each file is written to unless
+// SetReplicas changes it.
+const defaultReplicas = 2
+
+// readOnlyRetryAfter is how long a node that reported ResourceExhausted is
+// skipped for writes before it is tried again.
+const readOnlyRetryAfter = 30 * time.Second
+
 // NetworkVideoContentService implements VideoContentService using a network of nodes.
 type NetworkVideoContentService struct {
 	proto.UnimplementedVideoContentAdminServiceServer
@@ -26,6 +41,24 @@ type NetworkVideoContentService struct {
 	nodeHashes   []uint64
 	nodeMap      map[uint64]string
 	fileRegistry map[string][]string
+
+	// placements records files that were written to a node other than their
+	// ring owner because the owner was out of space. Keyed by "videoId/filename".
+	placements map[string]string
+	// readOnly holds nodes that rejected writes, mapped to when they did so.
+	readOnly map[string]time.Time
+
+	// rpcTimeout bounds each RPC to a storage node, on top of the deadline
+	// of the caller's context.
+	rpcTimeout time.Duration
+	// replicas is how many nodes each file is written to, see
+	// nw_replication.go.
+	replicas int
+
+	// Self-registration state, see nw_membership.go.
+	approval   NodeApprovalPolicy
+	pending    map[string]*nodeHeartbeat
+	heartbeats map[string]*nodeHeartbeat
 }
 
 // Uncomment the following line to ensure NetworkVideoContentService implements VideoContentService
@@ -65,15 +98,33 @@ func NewNetworkVideoContentService(nodeAddrs []string) (*NetworkVideoContentServ
 		nodeHashes:   nodeHashes,
 		nodeMap:      nodeMap,
 		fileRegistry: make(map[string][]string),
+		placements:   make(map[string]string),
+		readOnly:     make(map[string]time.Time),
+		rpcTimeout:   defaultRPCTimeout,
+		replicas:     defaultReplicas,
+		approval:     NodeApprovalPolicy{Mode: ApprovalManual},
+		pending:      make(map[string]*nodeHeartbeat),
+		heartbeats:   make(map[string]*nodeHeartbeat),
 	}, nil
 }
 
-func (n *NetworkVideoContentService) Write(videoId, filename string, data []byte) error {
+// SetRPCTimeout changes how long a single storage node RPC may take. It must
+// be called before the service is used.
+func (n *NetworkVideoContentService) SetRPCTimeout(timeout time.Duration) {
+	n.rpcTimeout = timeout
+}
+
+// rpcContext derives the context for one storage node RPC from ctx.
+func (n *NetworkVideoContentService) rpcContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, n.rpcTimeout)
+}
+
+func (n *NetworkVideoContentService) Write(ctx context.Context, videoId, filename string, data []byte) error {
 	key := fmt.Sprintf("%s/%s", videoId, filename)
-	nodeID := n.getNodeForKey(key)
-	client := n.clients[nodeID]
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	candidates := n.writeCandidates(key)
+	if len(candidates) == 0 {
+		return fmt.Errorf("no storage nodes available")
+	}
 
 	req := &proto.WriteFileRequest{
 		VideoId:  videoId,
@@ -81,13 +132,107 @@ func (n *NetworkVideoContentService) Write(videoId, filename string, data []byte
 		Data:     data,
 	}
 
-	_, err := client.WriteFile(ctx, req)
-	if err != nil {
-		return err
+	// Write a copy to each of the first replicas nodes, starting at the ring
+	// owner and falling through to its successors when a node reports that
+	// it is out of space. Once one copy is stored, a failed extra copy only
+	// leaves the file under-replicated until the next repair.
+	var lastErr error
+	written := 0
+	for _, nodeID := range candidates {
+		if written == n.replicas {
+			break
+		}
+		n.mu.RLock()
+		client := n.clients[nodeID]
+		n.mu.RUnlock()
+
+		rpcCtx, cancel := n.rpcContext(ctx)
+		_, err := client.WriteFile(rpcCtx, req)
+		cancel()
+
+		if status.Code(err) == codes.ResourceExhausted {
+			slog.Warn("storage node is out of space, trying next node", "node", nodeID, "video_id", videoId, "filename", filename, "error", err)
+			n.markReadOnly(nodeID)
+			lastErr = err
+			continue
+		}
+		if err != nil && written == 0 {
+			return err
+		}
+		if err != nil {
+			lastErr = err
+			break
+		}
+
+		if written == 0 {
+			n.recordWrite(videoId, filename, nodeID, candidates[0])
+		}
+		written++
 	}
 
+	if written == 0 {
+		return fmt.Errorf("no writable storage node for %s: %w", key, lastErr)
+	}
+	if written < min(n.replicas, len(candidates)) {
+		slog.Warn("file stored with fewer copies than configured", "video_id", videoId, "filename", filename, "copies", written, "replicas", n.replicas, "error", lastErr)
+	}
+	return nil
+}
+
+// writeCandidates returns the nodes to try for key in ring order, starting at
+// the key's owner. Nodes recently marked read-only are moved to the end so
+// they are only retried when every other node is full as well. Nodes whose
+// heartbeats have lapsed are treated the same way.
+func (n *NetworkVideoContentService) writeCandidates(key string) []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if len(n.nodeHashes) == 0 {
+		return nil
+	}
+
+	hash := hashStringToUint64(key)
+	start := sort.Search(len(n.nodeHashes), func(i int) bool {
+		return n.nodeHashes[i] >= hash
+	})
+
+	var writable, full []string
+	for i := range n.nodeHashes {
+		node := n.nodeMap[n.nodeHashes[(start+i)%len(n.nodeHashes)]]
+		if since, ok := n.readOnly[node]; ok && time.Since(since) < readOnlyRetryAfter {
+			full = append(full, node)
+			continue
+		}
+		if hb, ok := n.heartbeats[node]; ok && hb.stale {
+			full = append(full, node)
+			continue
+		}
+		writable = append(writable, node)
+	}
+
+	return append(writable, full...)
+}
+
+func (n *NetworkVideoContentService) markReadOnly(node string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.readOnly[node] = time.Now()
+}
+
+// recordWrite remembers that filename was stored on node, noting a placement
+// override when node is not the ring owner.
+func (n *NetworkVideoContentService) recordWrite(videoId, filename, node, owner string) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
+
+	key := fmt.Sprintf("%s/%s", videoId, filename)
+	if node == owner {
+		delete(n.placements, key)
+		delete(n.readOnly, node)
+	} else {
+		n.placements[key] = node
+	}
+
 	found := false
 	for _, item := range n.fileRegistry[videoId] {
 		if item == filename {
@@ -98,43 +243,80 @@ func (n *NetworkVideoContentService) Write(videoId, filename string, data []byte
 	if !found {
 		n.fileRegistry[videoId] = append(n.fileRegistry[videoId], filename)
 	}
-	return nil
 }
 
-func (n *NetworkVideoContentService) Read(videoId, filename string) ([]byte, error) {
+// Read asks the node the file was written to. Placement overrides are only
+// known to the instance that made them and are lost on restart, so when a
+// node does not have the file the ring successors are asked in turn, which
+// is where Write puts files whose owner was full.
+func (n *NetworkVideoContentService) Read(ctx context.Context, videoId, filename string) ([]byte, error) {
 	key := fmt.Sprintf("%s/%s", videoId, filename)
-	nodeID := n.getNodeForKey(key)
-	client := n.clients[nodeID]
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	req := &proto.ReadFileRequest{
 		VideoId:  videoId,
 		Filename: filename,
 	}
 
-	res, err := client.ReadFile(ctx, req)
-	if err != nil {
-		return nil, err
+	for _, nodeID := range n.readCandidates(key) {
+		n.mu.RLock()
+		client := n.clients[nodeID]
+		n.mu.RUnlock()
+
+		rpcCtx, cancel := n.rpcContext(ctx)
+		res, err := client.ReadFile(rpcCtx, req)
+		cancel()
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.rememberPlacement(key, nodeID)
+		return res.Data, nil
 	}
 
-	return res.Data, nil
+	return nil, fmt.Errorf("%w: %s", ErrContentNotFound, key)
 }
 
-func (n *NetworkVideoContentService) getNodeForKey(key string) string {
+// readCandidates returns the nodes that may hold key: the recorded
+// placement, if any, and then every node in ring order from the owner.
+func (n *NetworkVideoContentService) readCandidates(key string) []string {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
+	if len(n.nodeHashes) == 0 {
+		return nil
+	}
+
 	hash := hashStringToUint64(key)
-	index := sort.Search(len(n.nodeHashes), func(i int) bool {
+	start := sort.Search(len(n.nodeHashes), func(i int) bool {
 		return n.nodeHashes[i] >= hash
 	})
 
-	if index == len(n.nodeHashes) {
-		index = 0
+	placed, hasPlacement := n.placements[key]
+	candidates := make([]string, 0, len(n.nodeHashes))
+	if hasPlacement {
+		candidates = append(candidates, placed)
+	}
+	for i := range n.nodeHashes {
+		node := n.nodeMap[n.nodeHashes[(start+i)%len(n.nodeHashes)]]
+		if !hasPlacement || node != placed {
+			candidates = append(candidates, node)
+		}
 	}
+	return candidates
+}
 
-	return n.nodeMap[n.nodeHashes[index]]
+// rememberPlacement records where a read found key, so later reads and
+// migrations go straight there.
+func (n *NetworkVideoContentService) rememberPlacement(key, node string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if node == n.getNodeAddRemove(key) {
+		delete(n.placements, key)
+	} else {
+		n.placements[key] = node
+	}
 }
 
 func (n *NetworkVideoContentService) getNodeAddRemove(key string) string {
@@ -153,11 +335,31 @@ func (n *NetworkVideoContentService) getNodeAddRemove(key string) string {
 func (n *NetworkVideoContentService) AddNode(ctx context.Context, req *proto.AddNodeRequest) (*proto.AddNodeResponse, error) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	node := req.NodeAddress
+
+	if _, exists := n.clients[req.NodeAddress]; exists {
+		return nil, fmt.Errorf("node %s is already in the cluster", req.NodeAddress)
+	}
+
+	migrated, err := n.addNodeLocked(ctx, req.NodeAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.AddNodeResponse{MigratedFileCount: int32(migrated)}, nil
+}
+
+// addNodeLocked joins node to the ring and migrates the files it now owns.
+// n.mu must be held.
+//
+// The ring changes before any file moves, so migration carries on even if
+// ctx is cancelled; files left behind would be unreachable otherwise. Each
+// RPC is still bounded by the RPC timeout.
+func (n *NetworkVideoContentService) addNodeLocked(ctx context.Context, node string) (int, error) {
+	ctx = context.WithoutCancel(ctx)
 	conn, err := grpc.NewClient(node, grpc.WithTransportCredentials(insecure.NewCredentials()))
 
 	if err != nil {
-		return nil, fmt.Errorf("[AddNode] failed to connect to new node %s: %v", node, err)
+		return 0, fmt.Errorf("[AddNode] failed to connect to new node %s: %v", node, err)
 	}
 
 	n.clients[node] = proto.NewVideoContentClient(conn)
@@ -172,10 +374,13 @@ func (n *NetworkVideoContentService) AddNode(ctx context.Context, req *proto.Add
 		for _, filename := range filenames {
 			key := fmt.Sprintf("%s/%s", videoId, filename)
 			newNode := n.getNodeAddRemove(key)
-			oldNode := n.findNodeBeforeAdding(node, key)
+			oldNode, placed := n.placements[key]
+			if !placed {
+				oldNode = n.findNodeBeforeAdding(node, key)
+			}
 
 			if newNode != oldNode {
-				ctxRead, cancelRead := context.WithTimeout(context.Background(), 5*time.Second)
+				ctxRead, cancelRead := n.rpcContext(ctx)
 				data, err := n.clients[oldNode].ReadFile(ctxRead, &proto.ReadFileRequest{
 					VideoId:  videoId,
 					Filename: filename,
@@ -185,7 +390,7 @@ func (n *NetworkVideoContentService) AddNode(ctx context.Context, req *proto.Add
 					continue
 				}
 
-				ctxWrite, cancelWrite := context.WithTimeout(context.Background(), 5*time.Second)
+				ctxWrite, cancelWrite := n.rpcContext(ctx)
 				_, err = n.clients[newNode].WriteFile(ctxWrite, &proto.WriteFileRequest{
 					VideoId:  videoId,
 					Filename: filename,
@@ -197,12 +402,13 @@ func (n *NetworkVideoContentService) AddNode(ctx context.Context, req *proto.Add
 					continue
 				}
 
+				delete(n.placements, key)
 				migrated++
 			}
 		}
 	}
 
-	return &proto.AddNodeResponse{MigratedFileCount: int32(migrated)}, nil
+	return migrated, nil
 }
 
 func (n *NetworkVideoContentService) findNodeBeforeAdding(addedNode string, key string) string {
@@ -258,18 +464,25 @@ func (n *NetworkVideoContentService) RemoveNode(ctx context.Context, req *proto.
 
 	delete(n.clients, node)
 	delete(n.nodeMap, removedHash)
+	delete(n.readOnly, node)
+	delete(n.heartbeats, node)
 
+	// As in addNodeLocked, finish migrating even if the caller goes away.
+	ctx = context.WithoutCancel(ctx)
 	migrated := 0
 	for videoId, filenames := range n.fileRegistry {
 		for _, filename := range filenames {
 			key := fmt.Sprintf("%s/%s", videoId, filename)
 			oldNode := node
+			if placedOn, ok := n.placements[key]; ok && placedOn != oldNode {
+				continue
+			}
 			newNode := n.getNodeAddRemove(key)
 			if newNode == oldNode {
 				continue
 			}
 
-			ctxRead, cancelRead := context.WithTimeout(context.Background(), 5*time.Second)
+			ctxRead, cancelRead := n.rpcContext(ctx)
 			data, err := oldClient.ReadFile(ctxRead, &proto.ReadFileRequest{
 				VideoId:  videoId,
 				Filename: filename,
@@ -279,7 +492,7 @@ func (n *NetworkVideoContentService) RemoveNode(ctx context.Context, req *proto.
 				continue
 			}
 
-			ctxWrite, cancelWrite := context.WithTimeout(context.Background(), 5*time.Second)
+			ctxWrite, cancelWrite := n.rpcContext(ctx)
 			_, err = n.clients[newNode].WriteFile(ctxWrite, &proto.WriteFileRequest{
 				VideoId:  videoId,
 				Filename: filename,
@@ -291,10 +504,18 @@ func (n *NetworkVideoContentService) RemoveNode(ctx context.Context, req *proto.
 				continue
 			}
 
+			delete(n.placements, key)
 			migrated++
 		}
 	}
 
+	// Anything still pinned to the removed node falls back to its ring owner.
+	for key, placedOn := range n.placements {
+		if placedOn == node {
+			delete(n.placements, key)
+		}
+	}
+
 	return &proto.RemoveNodeResponse{MigratedFileCount: int32(migrated)}, nil
 }
 
@@ -306,7 +527,19 @@ func (n *NetworkVideoContentService) ListNodes(ctx context.Context, req *proto.L
 	copy(nodes, n.nodes)
 	sort.Strings(nodes)
 
-	return &proto.ListNodesResponse{Nodes: nodes}, nil
+	var pending, stale []string
+	for node := range n.pending {
+		pending = append(pending, node)
+	}
+	for node, hb := range n.heartbeats {
+		if hb.stale {
+			stale = append(stale, node)
+		}
+	}
+	sort.Strings(pending)
+	sort.Strings(stale)
+
+	return &proto.ListNodesResponse{Nodes: nodes, PendingNodes: pending, StaleNodes: stale}, nil
 }
 
 func hashStringToUint64(s string) uint64 {
@@ -314,7 +547,7 @@ func hashStringToUint64(s string) uint64 {
 	return binary.BigEndian.Uint64(sum[:8])
 }
 
-func (n *NetworkVideoContentService) DeleteAll(videoId string) error {
+func (n *NetworkVideoContentService) DeleteAll(ctx context.Context, videoId string) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
@@ -324,10 +557,10 @@ func (n *NetworkVideoContentService) DeleteAll(videoId string) error {
 	deletedCount := 0
 
 	for nodeAddr, client := range n.clients {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		rpcCtx, cancel := n.rpcContext(ctx)
 
 		// Use special filename ".DELETE_ALL" to trigger directory deletion
-		resp, err := client.WriteFile(ctx, &proto.WriteFileRequest{
+		resp, err := client.WriteFile(rpcCtx, &proto.WriteFileRequest{
 			VideoId:  videoId,
 			Filename: ".DELETE_ALL",
 			Data:     []byte{}, // Empty data
@@ -344,6 +577,9 @@ func (n *NetworkVideoContentService) DeleteAll(videoId string) error {
 	}
 
 	// Remove from file registry
+	for _, filename := range n.fileRegistry[videoId] {
+		delete(n.placements, fmt.Sprintf("%s/%s", videoId, filename))
+	}
 	delete(n.fileRegistry, videoId)
 
 	if deletedCount > 0 {
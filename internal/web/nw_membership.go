@@ -0,0 +1,219 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"tritontube/internal/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ApprovalMode decides what happens when a storage node registers itself.
+type ApprovalMode string
+
+const (
+	// ApprovalAuto admits every node that registers.
+	ApprovalAuto ApprovalMode = "auto"
+	// ApprovalManual parks new nodes as pending until an operator runs
+	// "admin approve".
+	ApprovalManual ApprovalMode = "manual"
+	// ApprovalAllowlist admits nodes whose address is on the allowlist and
+	// rejects all others.
+	ApprovalAllowlist ApprovalMode = "allowlist"
+)
+
+// NodeApprovalPolicy controls admission of self-registering storage nodes.
+type NodeApprovalPolicy struct {
+	Mode      ApprovalMode
+	Allowlist []string
+}
+
+// ParseApprovalMode validates a mode given on the command line.
+func ParseApprovalMode(s string) (ApprovalMode, error) {
+	switch mode := ApprovalMode(s); mode {
+	case ApprovalAuto, ApprovalManual, ApprovalAllowlist:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown node approval mode %q (want auto, manual or allowlist)", s)
+	}
+}
+
+// nodeHeartbeat is the latest report received from a storage node.
+type nodeHeartbeat struct {
+	lastSeen time.Time
+	report   *proto.NodeReport
+	stale    bool
+}
+
+// SetNodeApprovalPolicy replaces the policy used for RegisterNode.
+func (n *NetworkVideoContentService) SetNodeApprovalPolicy(policy NodeApprovalPolicy) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.approval = policy
+}
+
+// RegisterNode is called by a storage node on startup. Nodes already in the
+// ring are simply marked alive; new nodes are admitted according to the
+// approval policy.
+func (n *NetworkVideoContentService) RegisterNode(ctx context.Context, req *proto.RegisterNodeRequest) (*proto.RegisterNodeResponse, error) {
+	node := req.NodeAddress
+	if node == "" {
+		return nil, status.Error(codes.InvalidArgument, "node address is required")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hb := &nodeHeartbeat{lastSeen: time.Now(), report: req.Report}
+
+	if _, exists := n.clients[node]; exists {
+		n.recordHeartbeatLocked(node, hb)
+		return &proto.RegisterNodeResponse{State: proto.NodeState_NODE_STATE_ACTIVE}, nil
+	}
+
+	switch n.approval.Mode {
+	case ApprovalAuto:
+	case ApprovalAllowlist:
+		if !n.allowlistedLocked(node) {
+			slog.Warn("rejected storage node registration", "node", node, "reason", "not on allowlist")
+			return &proto.RegisterNodeResponse{State: proto.NodeState_NODE_STATE_REJECTED}, nil
+		}
+	default:
+		if _, waiting := n.pending[node]; !waiting {
+			slog.Info("storage node registration pending approval", "node", node)
+		}
+		n.pending[node] = hb
+		return &proto.RegisterNodeResponse{State: proto.NodeState_NODE_STATE_PENDING}, nil
+	}
+
+	migrated, err := n.addNodeLocked(ctx, node)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to add node: %v", err)
+	}
+	n.recordHeartbeatLocked(node, hb)
+	slog.Info("storage node admitted", "node", node, "migrated_files", migrated)
+
+	return &proto.RegisterNodeResponse{
+		State:             proto.NodeState_NODE_STATE_ACTIVE,
+		MigratedFileCount: int32(migrated),
+	}, nil
+}
+
+// Heartbeat records liveness and capacity for a registered node. Nodes that
+// are not known (for example after the web server restarted) get UNKNOWN back
+// and are expected to register again.
+func (n *NetworkVideoContentService) Heartbeat(ctx context.Context, req *proto.HeartbeatRequest) (*proto.HeartbeatResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hb := &nodeHeartbeat{lastSeen: time.Now(), report: req.Report}
+
+	if _, exists := n.clients[req.NodeAddress]; exists {
+		n.recordHeartbeatLocked(req.NodeAddress, hb)
+		return &proto.HeartbeatResponse{State: proto.NodeState_NODE_STATE_ACTIVE}, nil
+	}
+	if _, waiting := n.pending[req.NodeAddress]; waiting {
+		n.pending[req.NodeAddress] = hb
+		return &proto.HeartbeatResponse{State: proto.NodeState_NODE_STATE_PENDING}, nil
+	}
+
+	return &proto.HeartbeatResponse{State: proto.NodeState_NODE_STATE_UNKNOWN}, nil
+}
+
+// ApproveNode admits a node that is waiting for manual approval.
+func (n *NetworkVideoContentService) ApproveNode(ctx context.Context, req *proto.ApproveNodeRequest) (*proto.ApproveNodeResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hb, waiting := n.pending[req.NodeAddress]
+	if !waiting {
+		return nil, status.Errorf(codes.NotFound, "node %s is not pending approval", req.NodeAddress)
+	}
+
+	migrated, err := n.addNodeLocked(ctx, req.NodeAddress)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to add node: %v", err)
+	}
+	delete(n.pending, req.NodeAddress)
+	n.recordHeartbeatLocked(req.NodeAddress, hb)
+	slog.Info("storage node approved", "node", req.NodeAddress, "migrated_files", migrated)
+
+	return &proto.ApproveNodeResponse{MigratedFileCount: int32(migrated)}, nil
+}
+
+// StartHeartbeatMonitor flags nodes whose heartbeats are older than timeout
+// as stale. Stale nodes stay in the ring for reads but are tried last for
+// writes. Only nodes that have sent at least one heartbeat are tracked, so
+// statically configured nodes without the agent are unaffected.
+func (n *NetworkVideoContentService) StartHeartbeatMonitor(ctx context.Context, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(timeout / 2)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n.checkHeartbeats(timeout)
+			}
+		}
+	}()
+}
+
+func (n *NetworkVideoContentService) checkHeartbeats(timeout time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for node, hb := range n.heartbeats {
+		if !hb.stale && time.Since(hb.lastSeen) > timeout {
+			hb.stale = true
+			slog.Warn("storage node heartbeat lapsed", "node", node, "last_seen", hb.lastSeen)
+		}
+	}
+	for node, hb := range n.pending {
+		if time.Since(hb.lastSeen) > timeout {
+			delete(n.pending, node)
+			slog.Info("dropping pending storage node that stopped heartbeating", "node", node)
+		}
+	}
+}
+
+// recordHeartbeatLocked stores hb for an active node and applies its report.
+// Newly failed disks start a re-replication of the node's files from the
+// other nodes. n.mu must be held.
+func (n *NetworkVideoContentService) recordHeartbeatLocked(node string, hb *nodeHeartbeat) {
+	var prevFailed int32
+	if prev, ok := n.heartbeats[node]; ok {
+		if prev.stale {
+			slog.Info("storage node heartbeat resumed", "node", node)
+		}
+		prevFailed = prev.report.GetFailedDisks()
+	}
+	if failed := hb.report.GetFailedDisks(); failed > prevFailed {
+		slog.Error("storage node reports failed disks, re-replicating its files", "node", node, "failed_disks", failed)
+		go n.rereplicateAfterFailure(node)
+	}
+	n.heartbeats[node] = hb
+
+	if hb.report.GetReadOnly() {
+		n.readOnly[node] = time.Now()
+	} else {
+		delete(n.readOnly, node)
+	}
+}
+
+func (n *NetworkVideoContentService) allowlistedLocked(node string) bool {
+	for _, allowed := range n.approval.Allowlist {
+		if allowed == node {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"tritontube/internal/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SetReplicas changes how many nodes each file is written to: the ring owner
+// and its successors. With one replica a failed storage disk loses the files
+// on it for good; with more they are copied back from the other replicas.
+// It must be called before the service is used.
+func (n *NetworkVideoContentService) SetReplicas(replicas int) {
+	n.replicas = max(1, replicas)
+}
+
+// replicaNodes returns the nodes that should hold key: its ring owner and
+// the successors after it, replicas in all.
+func (n *NetworkVideoContentService) replicaNodes(key string) []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if len(n.nodeHashes) == 0 {
+		return nil
+	}
+	hash := hashStringToUint64(key)
+	start := sort.Search(len(n.nodeHashes), func(i int) bool {
+		return n.nodeHashes[i] >= hash
+	})
+
+	count := min(n.replicas, len(n.nodeHashes))
+	nodes := make([]string, 0, count)
+	for i := range count {
+		nodes = append(nodes, n.nodeMap[n.nodeHashes[(start+i)%len(n.nodeHashes)]])
+	}
+	return nodes
+}
+
+// rereplicateAfterFailure runs Rereplicate for a node that reported a newly
+// failed disk.
+func (n *NetworkVideoContentService) rereplicateAfterFailure(node string) {
+	if n.replicas < 2 {
+		slog.Error("files on the failed disk are lost, each file is stored once", "node", node)
+		return
+	}
+	copied, err := n.Rereplicate(context.Background(), node)
+	if err != nil {
+		slog.Error("re-replication after disk failure was incomplete", "node", node, "copied", copied, "error", err)
+		return
+	}
+	slog.Info("re-replicated files after disk failure", "node", node, "copied", copied)
+}
+
+// Rereplicate copies back to node every file it should hold as one of its
+// replicas but no longer does, reading each from another node that has it.
+// Storage nodes write the copies to their healthy disks. It returns how many
+// files were copied; files that could not be copied are reported in the
+// error and left for the next run.
+func (n *NetworkVideoContentService) Rereplicate(ctx context.Context, node string) (int, error) {
+	n.mu.RLock()
+	target, ok := n.clients[node]
+	var sources []string
+	for addr := range n.clients {
+		if addr != node {
+			sources = append(sources, addr)
+		}
+	}
+	n.mu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("node %s not found", node)
+	}
+	sort.Strings(sources)
+
+	held, err := n.listFiles(ctx, target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list files on %s: %w", node, err)
+	}
+	have := make(map[string]bool, len(held))
+	for _, key := range held {
+		have[key] = true
+	}
+
+	copied := 0
+	var errs []error
+	for _, source := range sources {
+		n.mu.RLock()
+		client, ok := n.clients[source]
+		n.mu.RUnlock()
+		if !ok {
+			continue // removed meanwhile
+		}
+		keys, err := n.listFiles(ctx, client)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list files on %s: %w", source, err))
+			continue
+		}
+
+		for _, key := range keys {
+			if have[key] || !slices.Contains(n.replicaNodes(key), node) {
+				continue
+			}
+			videoId, filename, _ := strings.Cut(key, "/")
+
+			rpcCtx, cancel := n.rpcContext(ctx)
+			res, err := client.ReadFile(rpcCtx, &proto.ReadFileRequest{VideoId: videoId, Filename: filename})
+			cancel()
+			if status.Code(err) == codes.NotFound {
+				continue // deleted since it was listed
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to read %s from %s: %w", key, source, err))
+				continue
+			}
+
+			rpcCtx, cancel = n.rpcContext(ctx)
+			_, err = target.WriteFile(rpcCtx, &proto.WriteFileRequest{VideoId: videoId, Filename: filename, Data: res.Data})
+			cancel()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to copy %s to %s: %w", key, node, err))
+				continue
+			}
+			have[key] = true
+			copied++
+		}
+	}
+	return copied, errors.Join(errs...)
+}
+
+func (n *NetworkVideoContentService) listFiles(ctx context.Context, client proto.VideoContentClient) ([]string, error) {
+	rpcCtx, cancel := n.rpcContext(ctx)
+	defer cancel()
+	res, err := client.ListFiles(rpcCtx, &proto.ListFilesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return res.Paths, nil
+}
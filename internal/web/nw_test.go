@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tritontube/internal/storage"
+)
+
+func TestNetworkReadFindsFilesOffTheirOwner(t *testing.T) {
+	ctx := context.Background()
+	var nodes []string
+	for range 3 {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		go storage.Serve(lis, &storage.Server{Dirs: []string{t.TempDir()}})
+		t.Cleanup(func() { lis.Close() })
+		nodes = append(nodes, lis.Addr().String())
+	}
+
+	svc, err := NewNetworkVideoContentService(nodes)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	// Store the file on a node other than its ring owner, as a write that
+	// overflowed a full owner would, from an instance that has since gone.
+	owner := svc.getNodeAddRemove("a/manifest.mpd")
+	other := nodes[0]
+	if other == owner {
+		other = nodes[1]
+	}
+	single, err := NewNetworkVideoContentService([]string{other})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	if err := single.Write(ctx, "a", "manifest.mpd", []byte("manifest")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	data, err := svc.Read(ctx, "a", "manifest.mpd")
+	if err != nil || string(data) != "manifest" {
+		t.Fatalf("read: got %q, %v; want the file from its successor", data, err)
+	}
+	if placed := svc.placements["a/manifest.mpd"]; placed != other {
+		t.Errorf("placement: got %q, want %q remembered", placed, other)
+	}
+}
+
+func TestNetworkRereplicateRestoresLostFiles(t *testing.T) {
+	ctx := context.Background()
+	var nodes []string
+	dirs := make(map[string]string)
+	for range 3 {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		dir := t.TempDir()
+		go storage.Serve(lis, &storage.Server{Dirs: []string{dir}})
+		t.Cleanup(func() { lis.Close() })
+		nodes = append(nodes, lis.Addr().String())
+		dirs[lis.Addr().String()] = dir
+	}
+
+	svc, err := NewNetworkVideoContentService(nodes)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	if err := svc.Write(ctx, "a", "manifest.mpd", []byte("manifest")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	replicas := svc.replicaNodes("a/manifest.mpd")
+	if len(replicas) != defaultReplicas {
+		t.Fatalf("replica nodes: got %v, want %d", replicas, defaultReplicas)
+	}
+
+	// Lose the second copy, as a failed disk on that node would.
+	lost := replicas[1]
+	if err := os.RemoveAll(filepath.Join(dirs[lost], "a")); err != nil {
+		t.Fatalf("failed to remove copy: %v", err)
+	}
+
+	copied, err := svc.Rereplicate(ctx, lost)
+	if err != nil || copied != 1 {
+		t.Fatalf("rereplicate: got %d, %v; want 1 file copied", copied, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dirs[lost], "a", "manifest.mpd"))
+	if err != nil || string(data) != "manifest" {
+		t.Fatalf("restored copy: got %q, %v", data, err)
+	}
+}
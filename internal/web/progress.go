@@ -0,0 +1,72 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// progressStep is the smallest change in percent that is reported, so a long
+// transcode writes metadata at most a few dozen times.
+const progressStep = 5
+
+// RunFFmpegWithProgress runs an ffmpeg command, calling report with the
+// percent of duration (in seconds) transcoded so far. It returns ffmpeg's
+// log output, which callers include when reporting a failure. With an
+// unknown duration the command simply runs without reports.
+func RunFFmpegWithProgress(cmd *exec.Cmd, duration float64, report func(percent int)) ([]byte, error) {
+	// Progress goes to stdout as key=value lines; logs stay on stderr.
+	args := append([]string{cmd.Args[0], "-progress", "pipe:1", "-nostats"}, cmd.Args[1:]...)
+	cmd.Args = args
+
+	var logs bytes.Buffer
+	cmd.Stderr = &logs
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	parseFFmpegProgress(stdout, duration, report)
+	err = cmd.Wait()
+	return logs.Bytes(), err
+}
+
+// parseFFmpegProgress reads the output of ffmpeg -progress until EOF and
+// reports progress in steps of progressStep, plus 100 when ffmpeg finishes.
+func parseFFmpegProgress(r io.Reader, duration float64, report func(percent int)) {
+	last := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || duration <= 0 {
+			continue
+		}
+
+		percent := -1
+		switch key {
+		// out_time_ms is also in microseconds, despite its name.
+		case "out_time_us", "out_time_ms":
+			us, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || us < 0 {
+				continue
+			}
+			percent = min(int(float64(us)/1e6/duration*100), 99)
+		case "progress":
+			if value == "end" {
+				percent = 100
+			}
+		}
+
+		if percent >= last+progressStep || (percent == 100 && last < 100) {
+			last = percent
+			report(percent)
+		}
+	}
+	// Drain anything left so ffmpeg never blocks on a full pipe.
+	io.Copy(io.Discard, r)
+}
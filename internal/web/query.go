@@ -0,0 +1,285 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sort keys accepted in ListOptions.SortBy.
+const (
+	SortByUploadedAt = "uploadedAt"
+	SortByTitle      = "title"
+	SortByDuration   = "duration"
+)
+
+// Sort orders accepted in ListOptions.SortOrder.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// ErrInvalidCursor is returned by Query when the cursor is malformed or was
+// issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions selects one page of videos for VideoMetadataService.Query.
+type ListOptions struct {
+	Limit     int         // page size; 0 means the default, capped at maxListLimit
+	Cursor    string      // opaque NextCursor from the previous page, empty for the first
+	SortBy    string      // SortByUploadedAt (default), SortByTitle or SortByDuration
+	SortOrder string      // SortDesc (default) or SortAsc
+	Status    VideoStatus // only videos with this status; if unset, all but StatusDeleted
+	Search    string      // case-insensitive substring of id, title or description, if set
+	Owner     string      // only videos with this OwnerId, if set
+
+	// IncludeTrash lists trashed videos along with the rest when Status is
+	// unset.
+	IncludeTrash bool
+
+	// Listed leaves out unlisted and private videos, except Viewer's own and
+	// those in Shared.
+	Listed bool
+	Viewer string   // user ID of whoever is listing, for Listed
+	Shared []string // IDs of videos shared with Viewer, for Listed
+}
+
+// TotalUnknown is the ListResult.Total of backends that cannot count the
+// matches without reading them all.
+const TotalUnknown = -1
+
+// ListResult is one page of a Query.
+type ListResult struct {
+	Videos     []VideoMetadata
+	NextCursor string // empty on the last page
+	Total      int    // number of videos matching the filters across all pages, or TotalUnknown
+}
+
+// normalize fills in defaults and validates the sort fields.
+func (o ListOptions) normalize() (ListOptions, error) {
+	if o.Limit <= 0 {
+		o.Limit = defaultListLimit
+	}
+	if o.Limit > maxListLimit {
+		o.Limit = maxListLimit
+	}
+	switch o.SortBy {
+	case "":
+		o.SortBy = SortByUploadedAt
+	case SortByUploadedAt, SortByTitle, SortByDuration:
+	default:
+		return o, fmt.Errorf("unsupported sort field %q", o.SortBy)
+	}
+	switch o.SortOrder {
+	case "":
+		o.SortOrder = SortDesc
+	case SortAsc, SortDesc:
+	default:
+		return o, fmt.Errorf("unsupported sort order %q", o.SortOrder)
+	}
+	o.Search = strings.TrimSpace(o.Search)
+	return o, nil
+}
+
+// listCursor marks the last video of a page. Pages continue strictly after
+// (Value, Id) in the requested order, so inserts and deletes between requests
+// never cause skipped or repeated entries.
+type listCursor struct {
+	SortBy    string          `json:"s"`
+	SortOrder string          `json:"o"`
+	Value     json.RawMessage `json:"v"`
+	Id        string          `json:"id"`
+}
+
+// sortValue returns the value a video is ordered by for sortBy.
+func sortValue(v VideoMetadata, sortBy string) any {
+	switch sortBy {
+	case SortByTitle:
+		return foldTitle(v.Title)
+	case SortByDuration:
+		return v.Duration
+	default:
+		return v.UploadedAt
+	}
+}
+
+func encodeCursor(last VideoMetadata, opts ListOptions) string {
+	value, _ := json.Marshal(sortValue(last, opts.SortBy))
+	data, _ := json.Marshal(listCursor{
+		SortBy:    opts.SortBy,
+		SortOrder: opts.SortOrder,
+		Value:     value,
+		Id:        last.Id,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses opts.Cursor and returns the typed sort value and id of
+// the last video on the previous page.
+func decodeCursor(opts ListOptions) (any, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	if c.SortBy != opts.SortBy || c.SortOrder != opts.SortOrder {
+		return nil, "", ErrInvalidCursor
+	}
+
+	var value any
+	switch opts.SortBy {
+	case SortByTitle:
+		var s string
+		err = json.Unmarshal(c.Value, &s)
+		value = s
+	case SortByDuration:
+		var f float64
+		err = json.Unmarshal(c.Value, &f)
+		value = f
+	default:
+		var t time.Time
+		err = json.Unmarshal(c.Value, &t)
+		value = t
+	}
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	return value, c.Id, nil
+}
+
+// foldTitle lower-cases the ASCII letters of title, and only those, to match
+// SQLite's lower() so that title cursors compare the same way in Go and SQL.
+func foldTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, title)
+}
+
+// compareVideos orders a and b by sortBy ascending, breaking ties by id.
+func compareVideos(a, b VideoMetadata, sortBy string) int {
+	var c int
+	switch sortBy {
+	case SortByTitle:
+		c = strings.Compare(foldTitle(a.Title), foldTitle(b.Title))
+	case SortByDuration:
+		switch {
+		case a.Duration < b.Duration:
+			c = -1
+		case a.Duration > b.Duration:
+			c = 1
+		}
+	default:
+		c = a.UploadedAt.Compare(b.UploadedAt)
+	}
+	if c == 0 {
+		c = strings.Compare(a.Id, b.Id)
+	}
+	return c
+}
+
+// matchesFilters reports whether v passes the Status, Owner, Listed and
+// Search filters.
+func matchesFilters(v VideoMetadata, opts ListOptions) bool {
+	if opts.Owner != "" && v.OwnerId != opts.Owner {
+		return false
+	}
+	if opts.Listed && v.EffectiveVisibility() != VisibilityPublic && (opts.Viewer == "" || v.OwnerId != opts.Viewer) && !slices.Contains(opts.Shared, v.Id) {
+		return false
+	}
+	if opts.Status != "" && v.Status != opts.Status {
+		return false
+	}
+	if opts.Status == "" && !opts.IncludeTrash && v.Status == StatusDeleted {
+		return false
+	}
+	if opts.Search != "" {
+		needle := strings.ToLower(opts.Search)
+		if !strings.Contains(strings.ToLower(v.Id), needle) &&
+			!strings.Contains(strings.ToLower(v.Title), needle) &&
+			!strings.Contains(strings.ToLower(v.Description), needle) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryInMemory answers a Query over a full list of videos. It is used by
+// backends that have no secondary indexes to sort or filter on.
+func queryInMemory(videos []VideoMetadata, opts ListOptions) (*ListResult, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]VideoMetadata, 0, len(videos))
+	for _, v := range videos {
+		if matchesFilters(v, opts) {
+			matched = append(matched, v)
+		}
+	}
+
+	less := func(a, b VideoMetadata) bool {
+		c := compareVideos(a, b, opts.SortBy)
+		if opts.SortOrder == SortDesc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	start := 0
+	if opts.Cursor != "" {
+		// The cursor encodes the last video of the previous page; continue
+		// with the first video ordered after it.
+		last, err := cursorVideo(opts)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(matched), func(i int) bool { return less(last, matched[i]) })
+	}
+
+	end := min(start+opts.Limit, len(matched))
+	result := &ListResult{
+		Videos: matched[start:end],
+		Total:  len(matched),
+	}
+	if end < len(matched) && end > start {
+		result.NextCursor = encodeCursor(matched[end-1], opts)
+	}
+	return result, nil
+}
+
+// cursorVideo rebuilds a VideoMetadata carrying just the fields the cursor
+// orders by, so it can be compared with compareVideos.
+func cursorVideo(opts ListOptions) (VideoMetadata, error) {
+	value, id, err := decodeCursor(opts)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+	v := VideoMetadata{Id: id}
+	switch val := value.(type) {
+	case string:
+		v.Title = val
+	case float64:
+		v.Duration = val
+	case time.Time:
+		v.UploadedAt = val
+	}
+	return v, nil
+}
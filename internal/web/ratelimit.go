@@ -0,0 +1,270 @@
+package web
+
+import (
+	"expvar"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limiting counters, published at /debug/vars.
+var (
+	rateLimitedRequests = expvar.NewMap("rate_limited_requests") // by budget
+	transcodesRunning   = expvar.NewInt("transcodes_running")
+	transcodesRefused   = expvar.NewInt("transcodes_refused")
+)
+
+// RateLimit allows Requests per Per, in bursts of up to Requests. The zero
+// RateLimit allows everything.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseRateLimit parses "N/DURATION", such as "300/1m" or "10/h". "" and
+// "0" mean no limit.
+func ParseRateLimit(s string) (RateLimit, error) {
+	if s == "" || s == "0" {
+		return RateLimit{}, nil
+	}
+	count, per, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, want N/DURATION such as 300/1m", s)
+	}
+	if per != "" && strings.IndexFunc(per, func(r rune) bool { return r >= '0' && r <= '9' }) < 0 {
+		per = "1" + per
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, want N/DURATION such as 300/1m", s)
+	}
+	return RateLimit{Requests: n, Per: d}, nil
+}
+
+func (l RateLimit) String() string {
+	if l.Requests == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// tokenBuckets rate limits many clients with one token bucket each.
+type tokenBuckets struct {
+	limit RateLimit
+	rate  float64 // tokens per second
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBuckets(limit RateLimit) *tokenBuckets {
+	return &tokenBuckets{
+		limit:   limit,
+		rate:    float64(limit.Requests) / limit.Per.Seconds(),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// take spends a token from key's bucket. If none is left it returns false
+// and how long until one will be.
+func (b *tokenBuckets) take(key string, now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(now)
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(b.limit.Requests), last: now}
+		b.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(b.limit.Requests), bucket.tokens+now.Sub(bucket.last).Seconds()*b.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / b.rate * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled completely, which behave the same
+// as no bucket, so idle clients do not use memory. It runs at most once per
+// refill period.
+func (b *tokenBuckets) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < b.limit.Per {
+		return
+	}
+	b.lastSweep = now
+	for key, bucket := range b.buckets {
+		if now.Sub(bucket.last) >= b.limit.Per {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+// Rate limit budgets. Each client has a separate bucket in each.
+const (
+	budgetRead   = "read"
+	budgetUpload = "upload"
+	budgetDelete = "delete"
+	budgetAuth   = "auth"
+)
+
+// RateLimitOptions configures RateLimits.
+type RateLimitOptions struct {
+	Read   RateLimit // everything that is not an upload or a delete
+	Upload RateLimit // uploads, including presigning and processing
+	Delete RateLimit // moving to the trash and purging
+	// Auth covers signing in, registering and presenting credentials that
+	// are rejected. It is kept per IP address whoever the client claims to
+	// be, since each sign-in costs a deliberately slow password hash.
+	Auth RateLimit
+
+	// TrustForwardedFor keys anonymous clients by the last address in
+	// X-Forwarded-For, as added by a load balancer in front of the server.
+	// Only set it when there is one, since clients can send the header.
+	TrustForwardedFor bool
+}
+
+// RateLimits limits how often each client may read, upload, delete and
+// sign in. Clients are told apart by their API key or user ID when they have
+// authenticated, and by IP address otherwise. Sign-ins and rejected
+// credentials are always counted by IP address.
+type RateLimits struct {
+	budgets           map[string]*tokenBuckets
+	trustForwardedFor bool
+}
+
+func NewRateLimits(opts RateLimitOptions) *RateLimits {
+	l := &RateLimits{budgets: make(map[string]*tokenBuckets), trustForwardedFor: opts.TrustForwardedFor}
+	for budget, limit := range map[string]RateLimit{
+		budgetRead:   opts.Read,
+		budgetUpload: opts.Upload,
+		budgetDelete: opts.Delete,
+		budgetAuth:   opts.Auth,
+	} {
+		if limit.Requests > 0 {
+			l.budgets[budget] = newTokenBuckets(limit)
+		}
+	}
+	return l
+}
+
+// budgetOf returns the budget a request is charged to.
+func budgetOf(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && (path == "/api/auth/login" || path == "/api/auth/register"):
+		return budgetAuth
+	case r.Method == http.MethodPost && (path == "/upload" || path == "/api/upload" || path == "/api/presign-upload" || path == "/api/process"):
+		return budgetUpload
+	case strings.HasPrefix(path, "/api/delete/"), strings.HasPrefix(path, "/api/admin/videos/"):
+		return budgetDelete
+	default:
+		return budgetRead
+	}
+}
+
+// clientKey identifies who to charge for r.
+func (l *RateLimits) clientKey(r *http.Request) string {
+	if p := PrincipalFrom(r.Context()); p != nil {
+		if p.Method == AuthMethodAPIKey {
+			return "key:" + p.Username
+		}
+		return "user:" + p.UserId
+	}
+	return l.ipKey(r)
+}
+
+// ipKey identifies the address r came from.
+func (l *RateLimits) ipKey(r *http.Request) string {
+	if l.trustForwardedFor {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return "ip:" + ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// allow charges r to its budget. If the client has run out it returns false
+// and how long until it may try again.
+func (l *RateLimits) allow(r *http.Request) (bool, string, time.Duration) {
+	budget := budgetOf(r)
+	buckets, ok := l.budgets[budget]
+	if !ok {
+		return true, budget, 0
+	}
+	key := l.clientKey(r)
+	if budget == budgetAuth {
+		key = l.ipKey(r)
+	}
+	allowed, wait := buckets.take(key, time.Now())
+	return allowed, budget, wait
+}
+
+// allowRejected charges a request whose credentials were rejected to the
+// auth budget of its address. If the address has run out it returns false
+// and how long until it may try again.
+func (l *RateLimits) allowRejected(r *http.Request) (bool, time.Duration) {
+	buckets, ok := l.budgets[budgetAuth]
+	if !ok {
+		return true, 0
+	}
+	return buckets.take(l.ipKey(r), time.Now())
+}
+
+// TranscodeLimiter caps how many videos this process transcodes at once.
+type TranscodeLimiter struct {
+	slots      chan struct{}
+	retryAfter time.Duration
+}
+
+// NewTranscodeLimiter allows limit transcodes at once. retryAfter is what
+// clients turned away are told to wait, a guess at how long one takes.
+func NewTranscodeLimiter(limit int, retryAfter time.Duration) *TranscodeLimiter {
+	return &TranscodeLimiter{slots: make(chan struct{}, limit), retryAfter: retryAfter}
+}
+
+// TryAcquire takes a slot without waiting. The caller must call release
+// once the transcode is over.
+func (l *TranscodeLimiter) TryAcquire() (release func(), ok bool) {
+	select {
+	case l.slots <- struct{}{}:
+		transcodesRunning.Add(1)
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				<-l.slots
+				transcodesRunning.Add(-1)
+			})
+		}, true
+	default:
+		transcodesRefused.Add(1)
+		return nil, false
+	}
+}
+
+// setRetryAfter sets the Retry-After header to wait, in whole seconds.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+}
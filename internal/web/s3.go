@@ -3,13 +3,16 @@ package web
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3VideoContentService implements VideoContentService using AWS S3
@@ -18,6 +21,8 @@ type S3VideoContentService struct {
 	bucketName string
 }
 
+var _ ContentURLPresigner = (*S3VideoContentService)(nil)
+
 // NewS3VideoContentService creates a new S3-backed video content service
 func NewS3VideoContentService(bucketName string) (*S3VideoContentService, error) {
 	// Load AWS configuration from environment
@@ -26,8 +31,14 @@ func NewS3VideoContentService(bucketName string) (*S3VideoContentService, error)
 		return nil, fmt.Errorf("unable to load SDK config: %w", err)
 	}
 
-	// Create S3 client
-	client := s3.NewFromConfig(cfg)
+	// Create S3 client. Set S3_ENDPOINT (e.g. http://localhost:9000) to use
+	// an S3-compatible server such as MinIO instead of AWS.
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
 
 	return &S3VideoContentService{
 		client:     client,
@@ -36,7 +47,7 @@ func NewS3VideoContentService(bucketName string) (*S3VideoContentService, error)
 }
 
 // Write uploads a file to S3
-func (s *S3VideoContentService) Write(videoId, filename string, data []byte) error {
+func (s *S3VideoContentService) Write(ctx context.Context, videoId, filename string, data []byte) error {
 	key := fmt.Sprintf("%s/%s", videoId, filename)
 
 	// Determine content type
@@ -49,7 +60,7 @@ func (s *S3VideoContentService) Write(videoId, filename string, data []byte) err
 		contentType = "video/iso.segment"
 	}
 
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucketName),
 		Key:         aws.String(key),
 		Body:        bytes.NewReader(data),
@@ -65,14 +76,18 @@ func (s *S3VideoContentService) Write(videoId, filename string, data []byte) err
 }
 
 // Read downloads a file from S3
-func (s *S3VideoContentService) Read(videoId, filename string) ([]byte, error) {
+func (s *S3VideoContentService) Read(ctx context.Context, videoId, filename string) ([]byte, error) {
 	key := fmt.Sprintf("%s/%s", videoId, filename)
 
-	result, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(key),
 	})
 
+	var noSuchKey *s3types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("%w: %s", ErrContentNotFound, key)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to download from S3: %w", err)
 	}
@@ -88,32 +103,66 @@ func (s *S3VideoContentService) Read(videoId, filename string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// DeleteAll removes a video and all its files from S3
-func (s *S3VideoContentService) DeleteAll(videoId string) error {
-	// List all objects with the videoId prefix
-	listResult, err := s.client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+// PresignRead returns a GET URL for one of a video's files that works
+// without credentials until ttl passes.
+func (s *S3VideoContentService) PresignRead(ctx context.Context, videoId, filename string, ttl time.Duration) (string, error) {
+	req, err := s3.NewPresignClient(s.client).PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
-		Prefix: aws.String(videoId + "/"),
-	})
-
+		Key:    aws.String(fmt.Sprintf("%s/%s", videoId, filename)),
+	}, s3.WithPresignExpires(ttl))
 	if err != nil {
-		return fmt.Errorf("failed to list objects for deletion: %w", err)
+		return "", fmt.Errorf("failed to presign S3 read: %w", err)
+	}
+	return req.URL, nil
+}
+
+// DeleteAll removes a video and all its files from S3
+func (s *S3VideoContentService) DeleteAll(ctx context.Context, videoId string) error {
+	return s.deletePrefix(ctx, s.bucketName, videoId+"/")
+}
+
+// DeleteUploads removes the original upload of a video from the uploads bucket
+func (s *S3VideoContentService) DeleteUploads(ctx context.Context, videoId string) error {
+	uploadBucket := os.Getenv("S3_UPLOAD_BUCKET")
+	if uploadBucket == "" {
+		uploadBucket = "tritontube-uploads"
 	}
+	return s.deletePrefix(ctx, uploadBucket, fmt.Sprintf("uploads/%s/", videoId))
+}
 
-	// Delete each object
-	for _, obj := range listResult.Contents {
-		_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-			Bucket: aws.String(s.bucketName),
-			Key:    obj.Key,
-		})
+// deletePrefix deletes every object under prefix, page by page
+func (s *S3VideoContentService) deletePrefix(ctx context.Context, bucket, prefix string) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
 
+	failed := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			slog.Warn("failed to delete S3 object", "bucket", s.bucketName, "key", *obj.Key, "error", err)
-		} else {
-			slog.Info("deleted from S3", "bucket", s.bucketName, "key", *obj.Key)
+			return fmt.Errorf("failed to list objects for deletion: %w", err)
+		}
+
+		// Delete each object
+		for _, obj := range page.Contents {
+			_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    obj.Key,
+			})
+
+			if err != nil {
+				slog.Warn("failed to delete S3 object", "bucket", bucket, "key", *obj.Key, "error", err)
+				failed++
+			} else {
+				slog.Info("deleted from S3", "bucket", bucket, "key", *obj.Key)
+			}
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d objects under s3://%s/%s", failed, bucket, prefix)
+	}
 	return nil
 }
 
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrEmptySearch is returned by Search when the query has no searchable terms.
+var ErrEmptySearch = errors.New("search query has no searchable terms")
+
+// VideoSearcher is implemented by metadata services that maintain a full-text
+// index over titles and descriptions. It is optional; callers check for it
+// with a type assertion.
+type VideoSearcher interface {
+	// Search returns videos matching every term of query, best match first.
+	// Terms match as prefixes. Only opts.Limit, opts.Cursor, opts.Status,
+	// opts.Listed and opts.Viewer are used; results are always ordered by
+	// relevance.
+	Search(ctx context.Context, query string, opts ListOptions) (*SearchResult, error)
+}
+
+// SearchResult is one page of a Search.
+type SearchResult struct {
+	Hits       []SearchHit
+	NextCursor string // empty on the last page
+	Total      int    // number of matching videos across all pages
+}
+
+// SearchHit is a matching video with its relevance and highlighted text.
+// Title and Snippet are HTML-escaped, with matched terms wrapped in <mark>.
+type SearchHit struct {
+	Video   VideoMetadata
+	Score   float64 // higher is more relevant
+	Title   string
+	Snippet string // excerpt of the description around the matches
+}
+
+// Markers placed around matched terms by the index. They cannot occur in
+// escaped text, so they are swapped for <mark> after escaping.
+const (
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+// renderHighlight escapes s for HTML and turns highlight markers into <mark>.
+func renderHighlight(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(highlightStart, "<mark>", highlightEnd, "</mark>").Replace(s)
+}
+
+// searchTerms splits a user query into words, dropping punctuation and
+// operators so user input can never form an invalid index query.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchCursor resumes a ranked result list. Relevance scores are not stable
+// keys, so the position is an offset into the ranking for the same query.
+type searchCursor struct {
+	Query  string `json:"q"`
+	Status string `json:"st,omitempty"`
+	Offset int    `json:"off"`
+}
+
+func encodeSearchCursor(c searchCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSearchCursor returns the offset encoded in cursor, checking that it
+// was issued for the same query and filter.
+func decodeSearchCursor(cursor, query, status string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	var c searchCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	if c.Query != query || c.Status != status {
+		return 0, ErrInvalidCursor
+	}
+	return c.Offset, nil
+}
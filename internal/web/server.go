@@ -4,6 +4,8 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"html/template"
 	"io"
@@ -14,6 +16,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,6 +34,17 @@ type server struct {
 
 	metadataService VideoMetadataService
 	contentService  VideoContentService
+	changes         *ChangeHub // nil if the metadata service cannot be watched
+	users           UserStore  // nil if accounts are disabled
+	sessions        *SessionStore
+	auth            *Authenticator // nil if authentication is disabled
+	routes          *RoutePolicy
+	cors            *CORSPolicy
+	rateLimits      *RateLimits       // nil if requests are not rate limited
+	transcodes      *TranscodeLimiter // nil if transcodes are not capped
+	signer          *ContentSigner
+	presigner       ContentURLPresigner // nil to serve private content directly
+	acl             ACLStore            // nil if videos cannot be shared
 
 	mux *http.ServeMux
 }
@@ -38,6 +52,7 @@ type server struct {
 type indexPageVideo struct {
 	Id         string
 	EscapedId  string
+	Title      string
 	UploadTime string
 }
 
@@ -51,16 +66,29 @@ func NewServer(
 	}
 }
 
+// SetChangeHub enables /api/events, which streams the hub's changes to
+// clients. Call it before Start.
+func (s *server) SetChangeHub(hub *ChangeHub) {
+	s.changes = hub
+}
+
 func (s *server) Start(lis net.Listener) error {
 	s.mux = http.NewServeMux()
 
 	// API endpoints (JSON responses)
 	s.mux.HandleFunc("/api/videos", s.handleAPIVideos)
 	s.mux.HandleFunc("/api/videos/", s.handleAPIVideoDetail)
+	s.mux.HandleFunc("/api/search", s.handleAPISearch)
+	s.mux.HandleFunc("/api/events", s.handleAPIEvents)
+	s.mux.HandleFunc("/api/auth/register", s.handleAPIRegister)
+	s.mux.HandleFunc("/api/auth/login", s.handleAPILogin)
+	s.mux.HandleFunc("/api/auth/logout", s.handleAPILogout)
+	s.mux.HandleFunc("/api/auth/me", s.handleAPIMe)
 	s.mux.HandleFunc("/api/presign-upload", s.handleAPIPresignUpload)
 	s.mux.HandleFunc("/api/upload", s.handleAPIUpload)
 	s.mux.HandleFunc("/api/process", s.handleAPIProcess)
 	s.mux.HandleFunc("/api/delete/", s.handleAPIDelete)
+	s.mux.HandleFunc("/api/admin/videos/", s.handleAPIAdminVideo)
 
 	// Content endpoints (binary responses)
 	s.mux.HandleFunc("/content/", s.handleVideoContent)
@@ -71,8 +99,25 @@ func (s *server) Start(lis net.Listener) error {
 	s.mux.HandleFunc("/videos/", s.handleVideo)
 	s.mux.HandleFunc("/", s.handleIndex)
 
-	// Wrap with CORS middleware
-	handler := s.corsMiddleware(s.mux)
+	// Runtime and cache counters
+	s.mux.Handle("/debug/vars", expvar.Handler())
+
+	// Sessions on their own still authenticate, as before API keys and
+	// tokens were accepted.
+	if s.auth == nil && s.sessions != nil {
+		s.auth = NewAuthenticator(AuthOptions{Sessions: s.sessions})
+	}
+	if s.auth == nil {
+		slog.Warn("authentication is disabled, anyone may upload, change and delete videos")
+	}
+	if s.signer == nil {
+		s.signer, _ = NewContentSigner(nil, DefaultSignedURLTTL)
+	}
+
+	// Wrap with rate limiting, auth and CORS middleware. CORS goes outside
+	// so that preflight requests, which carry no credentials, get answered,
+	// and rate limiting inside so that it knows who is asking.
+	handler := s.corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(s.mux)))
 	return http.Serve(lis, handler)
 }
 
@@ -82,17 +127,22 @@ func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metas, err := s.metadataService.List()
+	metas, err := s.metadataService.List(r.Context())
 	if err != nil {
 		http.Error(w, "failed to list videos", http.StatusInternalServerError)
 		return
 	}
 
+	listed := s.listedFor(r.Context(), s.currentUser(r))
 	var pageData []indexPageVideo
 	for _, m := range metas {
+		if !matchesFilters(m, listed) {
+			continue
+		}
 		pageData = append(pageData, indexPageVideo{
 			Id:         m.Id,
 			EscapedId:  url.PathEscape(m.Id),
+			Title:      m.Title,
 			UploadTime: m.UploadedAt.Format(time.RFC1123),
 		})
 	}
@@ -109,6 +159,18 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := s.currentUser(r)
+	if s.auth != nil && user == nil {
+		http.Error(w, "sign in required", http.StatusUnauthorized)
+		return
+	}
+
+	release, ok := s.acquireTranscode(w, true)
+	if !ok {
+		return
+	}
+	defer release()
+
 	err := r.ParseMultipartForm(100 << 20) // 100 MB limit for video uploads
 	if err != nil {
 		http.Error(w, "invalid form data", http.StatusBadRequest)
@@ -128,9 +190,15 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	videoId := strings.TrimSuffix(header.Filename, ".mp4")
+	title := r.FormValue("title")
+	description := r.FormValue("description")
+	visibility, ok := s.parseVisibilityField(w, r.FormValue("visibility"), true)
+	if !ok {
+		return
+	}
 
-	if meta, _ := s.metadataService.Read(videoId); meta != nil {
-		http.Error(w, "video ID already exists", http.StatusBadRequest)
+	if meta, _ := s.metadataService.Read(r.Context(), videoId); meta != nil {
+		http.Error(w, "video ID already exists", http.StatusConflict)
 		return
 	}
 
@@ -150,8 +218,13 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	defer outFile.Close()
 	io.Copy(outFile, file)
 
+	mediaInfo, err := ProbeMediaInfo(r.Context(), videoPath)
+	if err != nil {
+		slog.Warn("failed to probe uploaded video", "video_id", videoId, "error", err)
+	}
+
 	manifestPath := filepath.Join(tempDir, "manifest.mpd")
-	cmd := exec.Command("ffmpeg",
+	cmd := exec.CommandContext(r.Context(), "ffmpeg",
 		"-i", videoPath,
 		"-c:v", "libx264",
 		"-c:a", "aac",
@@ -202,7 +275,7 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = s.contentService.Write(videoId, f.Name(), data)
+		err = s.contentService.Write(r.Context(), videoId, f.Name(), data)
 		if err != nil {
 			slog.Error("failed to write segment file", "video_id", videoId, "file", f.Name(), "error", err)
 			http.Error(w, "failed to write segment file", http.StatusInternalServerError)
@@ -210,11 +283,16 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = s.metadataService.Create(videoId, time.Now())
+	err = s.metadataService.Create(r.Context(), videoId, time.Now(), ownerOf(user), visibility)
+	if errors.Is(err, ErrAlreadyExists) {
+		http.Error(w, "video ID already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "failed to save video metadata", http.StatusInternalServerError)
 		return
 	}
+	s.saveVideoInfo(r.Context(), videoId, title, description, mediaInfo)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -227,23 +305,30 @@ func (s *server) handleVideo(w http.ResponseWriter, r *http.Request) {
 	videoId := r.URL.Path[len("/videos/"):]
 	slog.Debug("video page request", "video_id", videoId)
 
-	meta, err := s.metadataService.Read(videoId)
+	meta, err := s.metadataService.Read(r.Context(), videoId)
 	if err != nil {
 		http.Error(w, "Failed to read video metadata", http.StatusInternalServerError)
 		return
 	}
 
-	if meta == nil {
+	if meta == nil || meta.Status == StatusDeleted || !s.canView(r.Context(), s.currentUser(r), meta) {
 		http.NotFound(w, r)
 		return
 	}
 
+	manifestUrl, _ := contentURLs(meta, s.signer, time.Now())
 	data := struct {
-		Id         string
-		UploadedAt string
+		Id          string
+		Title       string
+		Description string
+		UploadedAt  string
+		ManifestUrl string
 	}{
-		Id:         meta.Id,
-		UploadedAt: meta.UploadedAt.Format(time.RFC1123),
+		Id:          meta.Id,
+		Title:       meta.Title,
+		Description: meta.Description,
+		UploadedAt:  meta.UploadedAt.Format(time.RFC1123),
+		ManifestUrl: manifestUrl,
 	}
 
 	tmpl := template.Must(template.New("video").Parse(videoHTML))
@@ -253,23 +338,32 @@ func (s *server) handleVideo(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) handleVideoContent(w http.ResponseWriter, r *http.Request) {
-	// parse /content/<videoId>/<filename>
+	// parse /content/<videoId>/<filename> or /content/s/<token>/<videoId>/<filename>
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	videoId := r.URL.Path[len("/content/"):]
-	parts := strings.Split(videoId, "/")
-	if len(parts) != 2 {
-		http.Error(w, "Invalid content path", http.StatusBadRequest)
+	req, ok := s.parseContentPath(w, r.URL.Path[len("/content/"):], true)
+	if !ok {
 		return
 	}
-	videoId = parts[0]
-	filename := parts[1]
-	slog.Debug("video content request", "video_id", videoId, "filename", filename)
+	videoId, filename := req.videoId, req.filename
+	slog.Debug("video content request", "video_id", videoId, "filename", filename, "signed", req.signed)
 
-	data, err := s.contentService.Read(videoId, filename)
+	meta := s.checkContentAccess(w, r, req)
+	if meta == nil {
+		return
+	}
+	if filename != "manifest.mpd" && s.redirectToStorage(w, r, req) {
+		return
+	}
+
+	data, err := s.contentService.Read(r.Context(), videoId, filename)
+	if errors.Is(err, ErrContentNotFound) {
+		http.Error(w, "video content not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "failed to read video content", http.StatusInternalServerError)
 		return
@@ -281,27 +375,39 @@ func (s *server) handleVideoContent(w http.ResponseWriter, r *http.Request) {
 	} else if strings.HasSuffix(filename, ".m4s") {
 		w.Header().Set("Content-Type", "video/mp4")
 	}
+	if meta.EffectiveVisibility() == VisibilityPrivate {
+		w.Header().Set("Cache-Control", "private")
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
 
 func (s *server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
-	// parse /thumbnail/<videoId>
+	// parse /thumbnail/<videoId> or /thumbnail/s/<token>/<videoId>
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	videoId := strings.TrimPrefix(r.URL.Path, "/thumbnail/")
-	if videoId == "" {
-		http.Error(w, "video ID required", http.StatusBadRequest)
+	req, ok := s.parseContentPath(w, strings.TrimPrefix(r.URL.Path, "/thumbnail/"), false)
+	if !ok {
 		return
 	}
+	videoId := req.videoId
+	req.filename = "thumbnail.jpg"
 
-	slog.Debug("thumbnail request", "video_id", videoId)
+	slog.Debug("thumbnail request", "video_id", videoId, "signed", req.signed)
 
-	data, err := s.contentService.Read(videoId, "thumbnail.jpg")
+	meta := s.checkContentAccess(w, r, req)
+	if meta == nil {
+		return
+	}
+	if s.redirectToStorage(w, r, req) {
+		return
+	}
+
+	data, err := s.contentService.Read(r.Context(), videoId, req.filename)
 	if err != nil {
 		slog.Warn("failed to read thumbnail", "video_id", videoId, "error", err)
 		http.Error(w, "thumbnail not found", http.StatusNotFound)
@@ -309,52 +415,193 @@ func (s *server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "image/jpeg")
-	w.Header().Set("Cache-Control", "public, max-age=86400") // Cache for 24 hours
+	if meta.EffectiveVisibility() == VisibilityPrivate {
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400") // Cache for 24 hours
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
 
-// CORS middleware to allow frontend requests
+// checkPlayable responds with 404 and returns false if the video does not
+// exist or is in the trash.
+func (s *server) checkPlayable(w http.ResponseWriter, r *http.Request, videoId string) (*VideoMetadata, bool) {
+	meta, err := s.metadataService.Read(r.Context(), videoId)
+	if err != nil {
+		slog.Error("failed to read video metadata", "video_id", videoId, "error", err)
+		http.Error(w, "failed to read video metadata", http.StatusInternalServerError)
+		return nil, false
+	}
+	if meta == nil || meta.Status == StatusDeleted {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return meta, true
+}
+
+// SetCORSPolicy sets which cross-origin requests are allowed. Without it
+// only DefaultCORSOrigins are. Call it before Start.
+func (s *server) SetCORSPolicy(policy *CORSPolicy) {
+	s.cors = policy
+}
+
+// corsMiddleware answers preflight requests and adds CORS headers for
+// allowed origins. Cross-origin requests from other origins, or for methods
+// and headers their route does not allow, are refused with 403, so a
+// simple request cannot cause side effects either.
 func (s *server) corsMiddleware(next http.Handler) http.Handler {
+	policy := s.cors
+	if policy == nil {
+		policy, _ = NewCORSPolicy(CORSOptions{AllowedOrigins: DefaultCORSOrigins})
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Allow requests from React dev server and production
 		origin := r.Header.Get("Origin")
-		if origin == "" {
-			origin = "*"
+		if origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
 		}
+		w.Header().Add("Vary", "Origin")
 
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		reject := func(reason string) {
+			slog.Warn("cross-origin request refused", "origin", origin, "method", r.Method, "path", r.URL.Path, "reason", reason)
+			s.sendJSONError(w, "cross-origin request not allowed", http.StatusForbidden)
+		}
 
-		// Handle preflight requests
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
+		allowed, credentials := policy.allowOrigin(origin)
+		if !allowed {
+			reject("origin not allowed")
+			return
+		}
+		rule := policy.rule(r.URL.Path)
+		if rule == nil || len(rule.Methods) == 0 {
+			reject("path not available cross-origin")
 			return
 		}
 
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && requestedMethod != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if !rule.allowsMethod(requestedMethod) {
+				reject("method not allowed")
+				return
+			}
+			requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+			if !rule.allowsHeaders(requestedHeaders) {
+				reject("headers not allowed: " + requestedHeaders)
+				return
+			}
+			setCORSOrigin(w, origin, credentials)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(rule.Methods, ", "))
+			if len(rule.Headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(rule.Headers, ", "))
+			}
+			w.Header().Set("Access-Control-Max-Age", policy.maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if !rule.allowsMethod(r.Method) {
+			reject("method not allowed")
+			return
+		}
+		setCORSOrigin(w, origin, credentials)
+		// Let the frontend see how long to back off when rate limited.
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After")
 		next.ServeHTTP(w, r)
 	})
 }
 
+func setCORSOrigin(w http.ResponseWriter, origin string, credentials bool) {
+	if !credentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+}
+
 // API Response structures
 type apiVideoResponse struct {
-	Id           string `json:"id"`
-	EscapedId    string `json:"escapedId"`
-	UploadTime   string `json:"uploadTime"`
-	UploadedAt   string `json:"uploadedAt"`
-	ManifestUrl  string `json:"manifestUrl"`
-	ThumbnailUrl string `json:"thumbnailUrl"`
-	Status       string `json:"status"` // "processing", "ready", "error"
+	Id           string      `json:"id"`
+	EscapedId    string      `json:"escapedId"`
+	UploadTime   string      `json:"uploadTime"`
+	UploadedAt   string      `json:"uploadedAt"`
+	ManifestUrl  string      `json:"manifestUrl"`
+	ThumbnailUrl string      `json:"thumbnailUrl"`
+	Status       VideoStatus `json:"status"`
+	Title        string      `json:"title,omitempty"`
+	Description  string      `json:"description,omitempty"`
+
+	FailureReason string     `json:"failureReason,omitempty"`
+	Progress      int        `json:"progress"` // percent of transcoding done
+	DeletedAt     string     `json:"deletedAt,omitempty"`
+	OwnerId       string     `json:"ownerId,omitempty"`
+	Visibility    Visibility `json:"visibility"`
+
+	Duration   float64 `json:"duration,omitempty"` // seconds
+	FileSize   int64   `json:"fileSize,omitempty"` // bytes
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Bitrate    int64   `json:"bitrate,omitempty"` // bits per second
+	VideoCodec string  `json:"videoCodec,omitempty"`
+	AudioCodec string  `json:"audioCodec,omitempty"`
+
+	// Version must be sent back on PATCH to update only if nobody else
+	// changed the video in between.
+	Version int64 `json:"version"`
+
+	// Set on /api/search results only. Highlights are HTML with matched
+	// terms wrapped in <mark>.
+	Score          float64 `json:"score,omitempty"`
+	TitleHighlight string  `json:"titleHighlight,omitempty"`
+	Snippet        string  `json:"snippet,omitempty"`
+}
+
+// newAPIVideoResponse describes a video. The content URLs of private videos
+// are signed, so only send it to principals who may view the video.
+func (s *server) newAPIVideoResponse(meta VideoMetadata) apiVideoResponse {
+	var deletedAt string
+	if !meta.DeletedAt.IsZero() {
+		deletedAt = meta.DeletedAt.Format(time.RFC3339)
+	}
+	manifestUrl, thumbnailUrl := contentURLs(&meta, s.signer, time.Now())
+	return apiVideoResponse{
+		Id:           meta.Id,
+		EscapedId:    url.PathEscape(meta.Id),
+		UploadTime:   meta.UploadedAt.Format(time.RFC3339),
+		UploadedAt:   meta.UploadedAt.Format(time.RFC3339),
+		ManifestUrl:  manifestUrl,
+		ThumbnailUrl: thumbnailUrl,
+		Status:       meta.Status,
+		Title:        meta.Title,
+		Description:  meta.Description,
+		Duration:     meta.Duration,
+		FileSize:     meta.FileSize,
+		Width:        meta.Width,
+		Height:       meta.Height,
+		Bitrate:      meta.Bitrate,
+		VideoCodec:   meta.VideoCodec,
+		AudioCodec:   meta.AudioCodec,
+
+		FailureReason: meta.FailureReason,
+		Progress:      meta.Progress,
+		DeletedAt:     deletedAt,
+		OwnerId:       meta.OwnerId,
+		Visibility:    meta.EffectiveVisibility(),
+		Version:       meta.Version,
+	}
 }
 
 type apiVideosListResponse struct {
-	Data    []apiVideoResponse `json:"data"`
-	Total   int                `json:"total"`
-	Page    int                `json:"page"`
-	Limit   int                `json:"limit"`
-	HasMore bool               `json:"hasMore"`
+	Data       []apiVideoResponse `json:"data"`
+	Total      *int               `json:"total,omitempty"` // unset if the backend cannot count
+	Page       int                `json:"page"`
+	Limit      int                `json:"limit"`
+	HasMore    bool               `json:"hasMore"`
+	NextCursor string             `json:"nextCursor,omitempty"`
 }
 
 type apiErrorResponse struct {
@@ -362,80 +609,342 @@ type apiErrorResponse struct {
 	Message string `json:"message"`
 }
 
-// handleAPIVideos handles GET /api/videos - list all videos
+// handleAPIVideos handles GET /api/videos - list videos one page at a time.
+// Query parameters: limit, cursor (from nextCursor) or page, search, status,
+// sortBy (uploadTime, title, duration), sortOrder (asc, desc) and mine=true
+// for only the signed-in user's videos. Other users' unlisted and private
+// videos are left out, unless they are shared with the signed-in user.
 func (s *server) handleAPIVideos(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	metas, err := s.metadataService.List()
+	q := r.URL.Query()
+	user := s.currentUser(r)
+	opts := s.listedFor(r.Context(), user)
+	opts.Cursor = q.Get("cursor")
+	opts.SortBy = q.Get("sortBy")
+	opts.SortOrder = q.Get("sortOrder")
+	opts.Search = q.Get("search")
+	if opts.SortBy == "uploadTime" {
+		opts.SortBy = SortByUploadedAt
+	}
+	if mine, _ := strconv.ParseBool(q.Get("mine")); mine {
+		if user == nil {
+			s.sendJSONError(w, "sign in to list your videos", http.StatusUnauthorized)
+			return
+		}
+		// Their own unlisted and private videos are included.
+		opts.Owner, opts.Listed = user.UserId, false
+	}
+
+	var err error
+	if opts.Status, err = parseStatusFilter(q.Get("status")); err != nil {
+		s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Limit, err = parsePositiveInt(q.Get("limit"), 0); err != nil {
+		s.sendJSONError(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	page, err := parsePositiveInt(q.Get("page"), 1)
+	if err != nil {
+		s.sendJSONError(w, "invalid page", http.StatusBadRequest)
+		return
+	}
+	if opts, err = opts.normalize(); err != nil {
+		s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.queryPage(r.Context(), opts, page)
+	if errors.Is(err, ErrInvalidCursor) {
+		s.sendJSONError(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		slog.Error("failed to list videos", "error", err)
 		s.sendJSONError(w, "failed to list videos", http.StatusInternalServerError)
 		return
 	}
 
-	videos := make([]apiVideoResponse, 0, len(metas))
-	for _, m := range metas {
-		videos = append(videos, apiVideoResponse{
-			Id:           m.Id,
-			EscapedId:    url.PathEscape(m.Id),
-			UploadTime:   m.UploadedAt.Format(time.RFC3339),
-			UploadedAt:   m.UploadedAt.Format(time.RFC3339),
-			ManifestUrl:  "/content/" + url.PathEscape(m.Id) + "/manifest.mpd",
-			ThumbnailUrl: "/thumbnail/" + url.PathEscape(m.Id),
-			Status:       m.Status,
-		})
+	videos := make([]apiVideoResponse, 0, len(result.Videos))
+	for _, m := range result.Videos {
+		videos = append(videos, s.newAPIVideoResponse(m))
 	}
 
 	response := apiVideosListResponse{
-		Data:    videos,
-		Total:   len(videos),
-		Page:    1,
-		Limit:   len(videos),
-		HasMore: false,
+		Data:       videos,
+		Total:      knownTotal(result.Total),
+		Page:       page,
+		Limit:      opts.Limit,
+		HasMore:    result.NextCursor != "",
+		NextCursor: result.NextCursor,
 	}
 
 	s.sendJSON(w, response, http.StatusOK)
 }
 
-// handleAPIVideoDetail handles GET /api/videos/{id} - get single video
-func (s *server) handleAPIVideoDetail(w http.ResponseWriter, r *http.Request) {
+// handleAPISearch handles GET /api/search?q=... - ranked full-text search
+// over titles and descriptions. It takes the same limit, cursor, page and
+// status parameters as /api/videos and returns the same response shape, and
+// likewise leaves out other users' unlisted and private videos that are not
+// shared with the signed-in user.
+func (s *server) handleAPISearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	videoId := strings.TrimPrefix(r.URL.Path, "/api/videos/")
+	searcher, ok := s.metadataService.(VideoSearcher)
+	if !ok {
+		s.sendJSONError(w, "search is not supported by this metadata backend", http.StatusNotImplemented)
+		return
+	}
+
+	q := r.URL.Query()
+	query := q.Get("q")
+	opts := s.listedFor(r.Context(), s.currentUser(r))
+	opts.Cursor = q.Get("cursor")
+
+	var err error
+	if opts.Status, err = parseStatusFilter(q.Get("status")); err != nil {
+		s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Limit, err = parsePositiveInt(q.Get("limit"), 0); err != nil {
+		s.sendJSONError(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	page, err := parsePositiveInt(q.Get("page"), 1)
+	if err != nil {
+		s.sendJSONError(w, "invalid page", http.StatusBadRequest)
+		return
+	}
+	if opts, err = opts.normalize(); err != nil {
+		s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Cursor == "" && page > 1 {
+		// Search cursors are offsets, so a page number maps onto one directly.
+		opts.Cursor = encodeSearchCursor(searchCursor{Query: query, Status: string(opts.Status), Offset: (page - 1) * opts.Limit})
+	}
+
+	result, err := searcher.Search(r.Context(), query, opts)
+	switch {
+	case errors.Is(err, ErrEmptySearch):
+		s.sendJSONError(w, "search query is required", http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrInvalidCursor):
+		s.sendJSONError(w, "invalid cursor", http.StatusBadRequest)
+		return
+	case err != nil:
+		slog.Error("failed to search videos", "query", query, "error", err)
+		s.sendJSONError(w, "failed to search videos", http.StatusInternalServerError)
+		return
+	}
+
+	videos := make([]apiVideoResponse, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		v := s.newAPIVideoResponse(hit.Video)
+		v.Score = hit.Score
+		v.TitleHighlight = hit.Title
+		v.Snippet = hit.Snippet
+		videos = append(videos, v)
+	}
+
+	s.sendJSON(w, apiVideosListResponse{
+		Data:       videos,
+		Total:      knownTotal(result.Total),
+		Page:       page,
+		Limit:      opts.Limit,
+		HasMore:    result.NextCursor != "",
+		NextCursor: result.NextCursor,
+	}, http.StatusOK)
+}
+
+// knownTotal returns a pointer to total, or nil if it is TotalUnknown.
+func knownTotal(total int) *int {
+	if total == TotalUnknown {
+		return nil
+	}
+	return &total
+}
+
+// queryPage runs opts against the metadata service. Clients that page by
+// number rather than by cursor get there by following cursors from the start.
+func (s *server) queryPage(ctx context.Context, opts ListOptions, page int) (*ListResult, error) {
+	result, err := s.metadataService.Query(ctx, opts)
+	if err != nil || opts.Cursor != "" {
+		return result, err
+	}
+	for ; page > 1; page-- {
+		if result.NextCursor == "" {
+			return &ListResult{Total: result.Total}, nil
+		}
+		opts.Cursor = result.NextCursor
+		if result, err = s.metadataService.Query(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// parsePositiveInt parses an optional positive integer query parameter.
+func parsePositiveInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return n, nil
+}
+
+// parseStatusFilter parses an optional status query parameter.
+func parseStatusFilter(value string) (VideoStatus, error) {
+	if value == "" {
+		return "", nil
+	}
+	return ParseVideoStatus(value)
+}
+
+// handleAPIVideoDetail handles GET /api/videos/{id} - get single video,
+// PATCH /api/videos/{id} - edit title, description and visibility,
+// POST /api/videos/{id}/restore - take a video out of the trash, and the
+// sharing endpoints under /api/videos/{id}/acl. Editors may change the title
+// and description; only those who may manage the video its visibility.
+func (s *server) handleAPIVideoDetail(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/videos/")
+	if videoId, ok := strings.CutSuffix(rest, "/restore"); ok {
+		s.handleAPIRestore(w, r, videoId)
+		return
+	}
+	if videoId, grantee, ok := aclPath(rest); ok {
+		s.handleAPIACL(w, r, videoId, grantee)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	videoId := rest
 	if videoId == "" {
 		s.sendJSONError(w, "video ID required", http.StatusBadRequest)
 		return
 	}
 
-	meta, err := s.metadataService.Read(videoId)
+	meta, err := s.metadataService.Read(r.Context(), videoId)
 	if err != nil {
 		slog.Error("failed to read video metadata", "video_id", videoId, "error", err)
 		s.sendJSONError(w, "failed to read video metadata", http.StatusInternalServerError)
 		return
 	}
 
-	if meta == nil {
+	// Private videos look missing to those who may not see them.
+	if meta == nil || meta.Status == StatusDeleted || !s.canView(r.Context(), s.currentUser(r), meta) {
 		s.sendJSONError(w, "video not found", http.StatusNotFound)
 		return
 	}
 
-	response := apiVideoResponse{
-		Id:           meta.Id,
-		EscapedId:    url.PathEscape(meta.Id),
-		UploadTime:   meta.UploadedAt.Format(time.RFC3339),
-		UploadedAt:   meta.UploadedAt.Format(time.RFC3339),
-		ManifestUrl:  "/content/" + url.PathEscape(meta.Id) + "/manifest.mpd",
-		ThumbnailUrl: "/thumbnail/" + url.PathEscape(meta.Id),
-		Status:       meta.Status,
+	if r.Method == http.MethodPatch {
+		user, ok := s.requireUser(w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Title       *string `json:"title"`
+			Description *string `json:"description"`
+			Visibility  *string `json:"visibility"`
+			Version     *int64  `json:"version"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.sendJSONError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		need := accessEdit
+		if body.Visibility != nil {
+			need = accessManage
+		}
+		if !s.checkAccess(w, r, user, meta, need) {
+			return
+		}
+		if body.Title != nil {
+			meta.Title = *body.Title
+		}
+		if body.Description != nil {
+			meta.Description = *body.Description
+		}
+		if body.Visibility != nil {
+			if meta.Visibility, ok = s.parseVisibilityField(w, *body.Visibility, false); !ok {
+				return
+			}
+		}
+		// Without a version from the client, the update still only applies
+		// to the version just read.
+		if body.Version != nil {
+			meta.Version = *body.Version
+		}
+		err := s.metadataService.Update(r.Context(), meta)
+		switch {
+		case errors.Is(err, ErrConflict):
+			s.sendJSONError(w, "video was modified by someone else, reload and try again", http.StatusConflict)
+			return
+		case errors.Is(err, ErrNotFound):
+			s.sendJSONError(w, "video not found", http.StatusNotFound)
+			return
+		case err != nil:
+			slog.Error("failed to update video details", "video_id", videoId, "error", err)
+			s.sendJSONError(w, "failed to update video details", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	s.sendJSON(w, response, http.StatusOK)
+	s.sendJSON(w, s.newAPIVideoResponse(*meta), http.StatusOK)
+}
+
+func (s *server) handleAPIRestore(w http.ResponseWriter, r *http.Request, videoId string) {
+	if r.Method != http.MethodPost {
+		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if videoId == "" {
+		s.sendJSONError(w, "video ID required", http.StatusBadRequest)
+		return
+	}
+	if !s.authorizeChange(w, r, videoId) {
+		return
+	}
+
+	_, err := RestoreVideo(r.Context(), s.metadataService, videoId)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		s.sendJSONError(w, "video not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrPurging):
+		s.sendJSONError(w, "video is being permanently deleted and cannot be restored", http.StatusConflict)
+		return
+	case errors.Is(err, ErrInvalidTransition):
+		s.sendJSONError(w, "video is not in the trash", http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("failed to restore video", "video_id", videoId, "error", err)
+		s.sendJSONError(w, "failed to restore video", http.StatusInternalServerError)
+		return
+	}
+
+	meta, err := s.metadataService.Read(r.Context(), videoId)
+	if err != nil || meta == nil {
+		slog.Error("failed to read restored video", "video_id", videoId, "error", err)
+		s.sendJSONError(w, "failed to read video metadata", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("video restored from trash", "video_id", videoId, "status", meta.Status)
+	s.sendJSON(w, s.newAPIVideoResponse(*meta), http.StatusOK)
 }
 
 // handleAPIUpload handles POST /api/upload - upload a new video
@@ -445,6 +954,17 @@ func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	release, ok := s.acquireTranscode(w, false)
+	if !ok {
+		return
+	}
+	defer release()
+
 	err := r.ParseMultipartForm(100 << 20) // 100 MB limit for video uploads
 	if err != nil {
 		s.sendJSONError(w, "invalid form data", http.StatusBadRequest)
@@ -464,9 +984,15 @@ func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	videoId := strings.TrimSuffix(header.Filename, ".mp4")
+	title := r.FormValue("title")
+	description := r.FormValue("description")
+	visibility, ok := s.parseVisibilityField(w, r.FormValue("visibility"), false)
+	if !ok {
+		return
+	}
 
-	if meta, _ := s.metadataService.Read(videoId); meta != nil {
-		s.sendJSONError(w, "video ID already exists", http.StatusBadRequest)
+	if meta, _ := s.metadataService.Read(r.Context(), videoId); meta != nil {
+		s.sendJSONError(w, "video ID already exists", http.StatusConflict)
 		return
 	}
 
@@ -488,8 +1014,13 @@ func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 	defer outFile.Close()
 	io.Copy(outFile, file)
 
+	mediaInfo, err := ProbeMediaInfo(r.Context(), videoPath)
+	if err != nil {
+		slog.Warn("failed to probe uploaded video", "video_id", videoId, "error", err)
+	}
+
 	manifestPath := filepath.Join(tempDir, "manifest.mpd")
-	cmd := exec.Command("ffmpeg",
+	cmd := exec.CommandContext(r.Context(), "ffmpeg",
 		"-i", videoPath,
 		"-c:v", "libx264",
 		"-c:a", "aac",
@@ -518,7 +1049,7 @@ func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 
 	// Generate thumbnail from first frame
 	thumbnailPath := filepath.Join(tempDir, "thumbnail.jpg")
-	thumbnailCmd := exec.Command("ffmpeg",
+	thumbnailCmd := exec.CommandContext(r.Context(), "ffmpeg",
 		"-i", videoPath,
 		"-vframes", "1", // Extract only 1 frame
 		"-ss", "00:00:00", // At 0 seconds (first frame)
@@ -561,7 +1092,7 @@ func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = s.contentService.Write(videoId, f.Name(), data)
+		err = s.contentService.Write(r.Context(), videoId, f.Name(), data)
 		if err != nil {
 			slog.Error("failed to write segment file", "video_id", videoId, "file", f.Name(), "error", err)
 			s.sendJSONError(w, "failed to write segment file", http.StatusInternalServerError)
@@ -569,26 +1100,34 @@ func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = s.metadataService.Create(videoId, time.Now())
+	uploadedAt := time.Now()
+	err = s.metadataService.Create(r.Context(), videoId, uploadedAt, ownerOf(user), visibility)
+	if errors.Is(err, ErrAlreadyExists) {
+		s.sendJSONError(w, "video ID already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		slog.Error("failed to save metadata", "video_id", videoId, "error", err)
 		s.sendJSONError(w, "failed to save video metadata", http.StatusInternalServerError)
 		return
 	}
-
-	response := apiVideoResponse{
-		Id:           videoId,
-		EscapedId:    url.PathEscape(videoId),
-		UploadTime:   time.Now().Format(time.RFC3339),
-		UploadedAt:   time.Now().Format(time.RFC3339),
-		ManifestUrl:  "/content/" + url.PathEscape(videoId) + "/manifest.mpd",
-		ThumbnailUrl: "/thumbnail/" + url.PathEscape(videoId),
-	}
+	s.saveVideoInfo(r.Context(), videoId, title, description, mediaInfo)
+
+	response := s.newAPIVideoResponse(VideoMetadata{
+		Id:          videoId,
+		UploadedAt:  uploadedAt,
+		Status:      StatusReady,
+		Title:       title,
+		Description: description,
+		MediaInfo:   mediaInfo,
+		OwnerId:     ownerOf(user),
+		Visibility:  visibility,
+	})
 
 	s.sendJSON(w, response, http.StatusCreated)
 }
 
-// handleAPIDelete handles DELETE /api/delete/{id} - delete a video
+// handleAPIDelete handles DELETE /api/delete/{id} - move a video to the trash
 func (s *server) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
 		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -600,80 +1139,49 @@ func (s *server) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
 		s.sendJSONError(w, "video ID required", http.StatusBadRequest)
 		return
 	}
-
-	// Check if video exists
-	meta, err := s.metadataService.Read(videoId)
-	if err != nil {
-		slog.Error("failed to read video metadata", "video_id", videoId, "error", err)
-		s.sendJSONError(w, "failed to read video metadata", http.StatusInternalServerError)
+	if !s.authorizeChange(w, r, videoId) {
 		return
 	}
 
-	if meta == nil {
+	// Move the video to the trash; the purger removes its content and
+	// metadata once the retention window has passed.
+	err := TrashVideo(r.Context(), s.metadataService, videoId)
+	if errors.Is(err, ErrNotFound) {
 		s.sendJSONError(w, "video not found", http.StatusNotFound)
 		return
 	}
-
-	// Delete content files from storage nodes
-	err = s.contentService.DeleteAll(videoId)
-	if err != nil {
-		slog.Warn("failed to delete video content from storage", "video_id", videoId, "error", err)
-		// Continue anyway to delete metadata
-	}
-
-	// Delete original upload file from uploads bucket if using S3
-	if s3svc, ok := s.contentService.(*S3VideoContentService); ok {
-		uploadBucket := os.Getenv("S3_UPLOAD_BUCKET")
-		if uploadBucket == "" {
-			uploadBucket = "tritontube-uploads"
-		}
-
-		// Delete the entire folder in uploads bucket
-		uploadPrefix := fmt.Sprintf("uploads/%s/", videoId)
-		slog.Info("deleting upload files", "video_id", videoId, "bucket", uploadBucket, "prefix", uploadPrefix)
-
-		listInput := &s3.ListObjectsV2Input{
-			Bucket: aws.String(uploadBucket),
-			Prefix: aws.String(uploadPrefix),
-		}
-
-		listOutput, err := s3svc.client.ListObjectsV2(context.TODO(), listInput)
-		if err != nil {
-			slog.Warn("failed to list upload files for deletion", "video_id", videoId, "prefix", uploadPrefix, "error", err)
-		} else if len(listOutput.Contents) > 0 {
-			for _, obj := range listOutput.Contents {
-				_, err := s3svc.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-					Bucket: aws.String(uploadBucket),
-					Key:    obj.Key,
-				})
-				if err != nil {
-					slog.Warn("failed to delete upload file", "video_id", videoId, "key", *obj.Key, "error", err)
-				} else {
-					slog.Info("deleted upload file", "video_id", videoId, "key", *obj.Key)
-				}
-			}
-		}
-	}
-
-	// Delete from metadata database
-	err = s.metadataService.Delete(videoId)
 	if err != nil {
-		slog.Error("failed to delete video metadata", "video_id", videoId, "error", err)
-		s.sendJSONError(w, "failed to delete video metadata", http.StatusInternalServerError)
+		slog.Error("failed to trash video", "video_id", videoId, "error", err)
+		s.sendJSONError(w, "failed to delete video", http.StatusInternalServerError)
 		return
 	}
 
-	slog.Info("video deleted", "video_id", videoId)
+	slog.Info("video moved to trash", "video_id", videoId)
 
 	response := map[string]interface{}{
 		"success": true,
-		"message": "video deleted successfully (metadata and content)",
+		"message": "video moved to trash, restore it with POST /api/videos/" + url.PathEscape(videoId) + "/restore",
 		"id":      videoId,
 	}
 
 	s.sendJSON(w, response, http.StatusOK)
 }
 
+// saveVideoInfo stores the title, description and probed media info of a
+// freshly created video. Failures are logged but do not fail the upload.
+func (s *server) saveVideoInfo(ctx context.Context, videoId, title, description string, info MediaInfo) {
+	if title != "" || description != "" {
+		if err := s.metadataService.UpdateDetails(ctx, videoId, title, description); err != nil {
+			slog.Warn("failed to save video details", "video_id", videoId, "error", err)
+		}
+	}
+	if info != (MediaInfo{}) {
+		if err := s.metadataService.UpdateMediaInfo(ctx, videoId, info); err != nil {
+			slog.Warn("failed to save media info", "video_id", videoId, "error", err)
+		}
+	}
+}
+
 // Helper functions for JSON responses
 func (s *server) sendJSON(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -701,6 +1209,10 @@ func (s *server) handleAPIPresignUpload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if _, ok := s.requireUser(w, r); !ok {
+		return
+	}
+
 	var body struct {
 		VideoId  string `json:"videoId"`
 		Filename string `json:"filename"`
@@ -715,7 +1227,7 @@ func (s *server) handleAPIPresignUpload(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Check if video already exists to prevent race conditions
-	existingMeta, err := s.metadataService.Read(body.VideoId)
+	existingMeta, err := s.metadataService.Read(r.Context(), body.VideoId)
 	if err != nil {
 		slog.Warn("failed to check existing video metadata", "video_id", body.VideoId, "error", err)
 		// Continue anyway - better to allow upload than block on metadata check failure
@@ -729,7 +1241,7 @@ func (s *server) handleAPIPresignUpload(w http.ResponseWriter, r *http.Request)
 	key := filepath.Join("uploads", body.VideoId, body.Filename)
 
 	// Use AWS SDK v2 to create a presigned PUT URL
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := config.LoadDefaultConfig(r.Context())
 	if err != nil {
 		slog.Error("failed to load AWS config for presign", "video_id", body.VideoId, "error", err)
 		s.sendJSONError(w, "failed to create presigned url", http.StatusInternalServerError)
@@ -755,7 +1267,7 @@ func (s *server) handleAPIPresignUpload(w http.ResponseWriter, r *http.Request)
 		ContentType: aws.String(contentType),
 	}
 
-	presignResp, err := presigner.PresignPutObject(context.TODO(), putInput)
+	presignResp, err := presigner.PresignPutObject(r.Context(), putInput)
 	if err != nil {
 		slog.Error("failed to presign PUT object", "video_id", body.VideoId, "key", key, "error", err)
 		s.sendJSONError(w, "failed to create presigned url", http.StatusInternalServerError)
@@ -779,9 +1291,17 @@ func (s *server) handleAPIProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	var body struct {
-		VideoId  string `json:"videoId"`
-		Filename string `json:"filename"`
+		VideoId     string `json:"videoId"`
+		Filename    string `json:"filename"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		s.sendJSONError(w, "invalid request body", http.StatusBadRequest)
@@ -791,26 +1311,49 @@ func (s *server) handleAPIProcess(w http.ResponseWriter, r *http.Request) {
 		s.sendJSONError(w, "videoId and filename are required", http.StatusBadRequest)
 		return
 	}
+	visibility, ok := s.parseVisibilityField(w, body.Visibility, false)
+	if !ok {
+		return
+	}
 
-	// Create metadata entry immediately with "processing" status
-	if err := s.metadataService.CreateWithStatus(body.VideoId, time.Now(), "processing"); err != nil {
-		slog.Error("failed to create metadata with processing status", "video_id", body.VideoId, "error", err)
-		// Check if it already exists
-		existingMeta, readErr := s.metadataService.Read(body.VideoId)
-		if readErr == nil && existingMeta != nil {
-			slog.Warn("video already exists", "video_id", body.VideoId, "status", existingMeta.Status, "uploaded_at", existingMeta.UploadedAt)
+	// Without a queue the video is transcoded here, so make sure there is
+	// room before creating anything.
+	queueURL := os.Getenv("SQS_QUEUE_URL")
+	release := func() {}
+	if queueURL == "" {
+		if release, ok = s.acquireTranscode(w, false); !ok {
+			return
+		}
+	}
+
+	// Create metadata entry immediately; the source file is already in the uploads bucket
+	if err := s.metadataService.CreateWithStatus(r.Context(), body.VideoId, time.Now(), StatusUploaded, ownerOf(user), visibility); err != nil {
+		if errors.Is(err, ErrAlreadyExists) {
+			slog.Warn("video already exists", "video_id", body.VideoId)
 			s.sendJSONError(w, fmt.Sprintf("video '%s' already exists or is being processed", body.VideoId), http.StatusConflict)
+			release()
 			return
 		}
-		// If we can't read it either, there's a bigger problem - fail the request
-		slog.Error("cannot create or read metadata", "video_id", body.VideoId, "create_error", err, "read_error", readErr)
+		slog.Error("failed to create metadata with uploaded status", "video_id", body.VideoId, "error", err)
 		s.sendJSONError(w, "failed to initialize video processing - please try again or use a different video ID", http.StatusInternalServerError)
+		release()
 		return
 	}
+	if body.Title != "" || body.Description != "" {
+		if err := s.metadataService.UpdateDetails(r.Context(), body.VideoId, body.Title, body.Description); err != nil {
+			slog.Warn("failed to save video details", "video_id", body.VideoId, "error", err)
+		}
+	}
 
 	// If SQS queue URL is configured, enqueue a message and return immediately
-	queueURL := os.Getenv("SQS_QUEUE_URL")
 	if queueURL != "" {
+		// Mark the video queued before sending, since a worker may pick the
+		// message up at once and move it on to transcoding. If the send
+		// fails, the fallback below goes from queued to transcoding or
+		// failed, which are both allowed.
+		if err := TransitionStatus(r.Context(), s.metadataService, body.VideoId, StatusQueued, ""); err != nil {
+			slog.Warn("failed to mark video queued", "video_id", body.VideoId, "error", err)
+		}
 		// Build message body
 		msgBody, _ := json.Marshal(map[string]string{"videoId": body.VideoId, "filename": body.Filename})
 		// Load AWS config with explicit region
@@ -818,10 +1361,10 @@ func (s *server) handleAPIProcess(w http.ResponseWriter, r *http.Request) {
 		if awsRegion == "" {
 			awsRegion = "us-west-1"
 		}
-		cfg, cfgErr := config.LoadDefaultConfig(context.TODO(), config.WithRegion(awsRegion))
+		cfg, cfgErr := config.LoadDefaultConfig(r.Context(), config.WithRegion(awsRegion))
 		if cfgErr == nil {
 			sqsClient := sqs.NewFromConfig(cfg)
-			_, sendErr := sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
+			_, sendErr := sqsClient.SendMessage(r.Context(), &sqs.SendMessageInput{
 				QueueUrl:    aws.String(queueURL),
 				MessageBody: aws.String(string(msgBody)),
 			})
@@ -839,16 +1382,40 @@ func (s *server) handleAPIProcess(w http.ResponseWriter, r *http.Request) {
 			slog.Error("failed to load AWS config for SQS send", "error", cfgErr)
 		}
 		// If SQS send failed, fall back to in-process worker
+		if release, ok = s.acquireTranscode(w, false); !ok {
+			if err := TransitionStatus(r.Context(), s.metadataService, body.VideoId, StatusFailed, "server busy, upload again later"); err != nil {
+				slog.Warn("failed to mark video failed", "video_id", body.VideoId, "error", err)
+			}
+			return
+		}
 	}
 
 	// Launch background goroutine to download the uploaded file from uploads/ and run processing
+	// Processing outlives the request, so keep its values but not its
+	// cancellation.
+	ctx := context.WithoutCancel(r.Context())
 	go func(videoId, filename string) {
+		defer release()
 		bgLog := slog.With("video_id", videoId, "filename", filename, "worker", "background")
 
+		// fail records why processing stopped so the video does not stay
+		// in transcoding forever.
+		fail := func(reason string, err error, args ...any) {
+			bgLog.Error(reason, append([]any{"error", err}, args...)...)
+			if err := TransitionStatus(ctx, s.metadataService, videoId, StatusFailed, reason); err != nil {
+				bgLog.Error("failed to mark video failed", "error", err)
+			}
+		}
+
+		if err := TransitionStatus(ctx, s.metadataService, videoId, StatusTranscoding, ""); err != nil {
+			bgLog.Error("cannot start processing", "error", err)
+			return
+		}
+
 		// Create temp dir for processing
 		tmp, err := os.MkdirTemp("", "proc-*")
 		if err != nil {
-			bgLog.Error("failed to create temp dir", "error", err)
+			fail("failed to create temp dir", err)
 			return
 		}
 		defer os.RemoveAll(tmp)
@@ -856,20 +1423,20 @@ func (s *server) handleAPIProcess(w http.ResponseWriter, r *http.Request) {
 		// Download the uploaded file from S3 (uploads/<videoId>/<filename>) into tmp
 		srcKey := filepath.Join("uploads", videoId, filename)
 
-		cfg, err := config.LoadDefaultConfig(context.TODO())
+		cfg, err := config.LoadDefaultConfig(ctx)
 		if err != nil {
-			bgLog.Error("failed to load AWS config", "error", err)
+			fail("failed to load AWS config", err)
 			return
 		}
 		s3client := s3.NewFromConfig(cfg)
 
 		bucketName := GetS3UploadsBucketFromEnv()
-		getResp, err := s3client.GetObject(context.TODO(), &s3.GetObjectInput{
+		getResp, err := s3client.GetObject(ctx, &s3.GetObjectInput{
 			Bucket: aws.String(bucketName),
 			Key:    aws.String(srcKey),
 		})
 		if err != nil {
-			bgLog.Error("failed to download uploaded file", "key", srcKey, "error", err)
+			fail("failed to download uploaded file", err, "key", srcKey)
 			return
 		}
 		defer getResp.Body.Close()
@@ -877,19 +1444,26 @@ func (s *server) handleAPIProcess(w http.ResponseWriter, r *http.Request) {
 		localPath := filepath.Join(tmp, filename)
 		out, err := os.Create(localPath)
 		if err != nil {
-			bgLog.Error("failed to create local file", "path", localPath, "error", err)
+			fail("failed to create local file", err, "path", localPath)
 			return
 		}
 		_, err = io.Copy(out, getResp.Body)
 		out.Close()
 		if err != nil {
-			bgLog.Error("failed to write local file", "error", err)
+			fail("failed to write local file", err)
 			return
 		}
 
+		info, err := ProbeMediaInfo(ctx, localPath)
+		if err != nil {
+			bgLog.Warn("failed to probe uploaded video", "error", err)
+		} else if err := s.metadataService.UpdateMediaInfo(ctx, videoId, info); err != nil {
+			bgLog.Warn("failed to save media info", "error", err)
+		}
+
 		// Run FFmpeg to produce DASH segments into tmp
 		manifestPath := filepath.Join(tmp, "manifest.mpd")
-		cmd := exec.Command("ffmpeg",
+		cmd := exec.CommandContext(ctx, "ffmpeg",
 			"-i", localPath,
 			"-c:v", "libx264",
 			"-c:a", "aac",
@@ -908,16 +1482,25 @@ func (s *server) handleAPIProcess(w http.ResponseWriter, r *http.Request) {
 			manifestPath,
 		)
 		cmd.Dir = tmp
-		outb, err := cmd.CombinedOutput()
+		outb, err := RunFFmpegWithProgress(cmd, info.Duration, func(percent int) {
+			if err := SetProgress(ctx, s.metadataService, videoId, percent); err != nil {
+				bgLog.Warn("failed to save progress", "percent", percent, "error", err)
+			}
+		})
 		if err != nil {
-			bgLog.Error("ffmpeg failed", "error", err, "output", string(outb))
+			fail("ffmpeg failed", err, "output", string(outb))
+			return
+		}
+
+		if err := TransitionStatus(ctx, s.metadataService, videoId, StatusPublishing, ""); err != nil {
+			bgLog.Error("cannot publish video", "error", err)
 			return
 		}
 
 		// Upload generated files to final video location using s.contentService.Write
 		files, err := os.ReadDir(tmp)
 		if err != nil {
-			bgLog.Error("readdir failed", "error", err)
+			fail("readdir failed", err)
 			return
 		}
 		for _, f := range files {
@@ -929,17 +1512,16 @@ func (s *server) handleAPIProcess(w http.ResponseWriter, r *http.Request) {
 			}
 			data, err := os.ReadFile(filepath.Join(tmp, f.Name()))
 			if err != nil {
-				bgLog.Error("read file failed", "file", f.Name(), "error", err)
+				fail("read file failed", err, "file", f.Name())
 				return
 			}
-			if err := s.contentService.Write(videoId, f.Name(), data); err != nil {
-				bgLog.Error("write to content service failed", "file", f.Name(), "error", err)
+			if err := s.contentService.Write(ctx, videoId, f.Name(), data); err != nil {
+				fail("write to content service failed", err, "file", f.Name())
 				return
 			}
 		}
 
-		// Update metadata status to ready
-		if err := s.metadataService.UpdateStatus(videoId, "ready"); err != nil {
+		if err := TransitionStatus(ctx, s.metadataService, videoId, StatusReady, ""); err != nil {
 			bgLog.Error("failed to update metadata status", "error", err)
 			// Still log completion even if status update fails
 		}
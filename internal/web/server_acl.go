@@ -0,0 +1,271 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// SetACLStore enables sharing videos with users and groups through
+// /api/videos/{id}/acl, and lets grants open private videos to those they
+// are shared with. Call it before Start.
+func (s *server) SetACLStore(store ACLStore) {
+	s.acl = store
+}
+
+// access is what a principal may do with a video. Each level includes the
+// ones before it.
+type access int
+
+const (
+	accessNone   access = iota
+	accessView          // find and watch it
+	accessEdit          // change its title and description
+	accessManage        // also delete it, change its visibility and share it
+)
+
+// can reports whether user has at least the access need to the video. The
+// owner and admins may manage it, grants give viewer or editor access, and
+// anyone may view a video that is not private. With authentication disabled
+// there is nobody to keep out. Grants are only read when they could matter.
+func (s *server) can(ctx context.Context, user *Principal, meta *VideoMetadata, need access) (bool, error) {
+	if s.auth == nil || user.IsAdmin() || CanManage(user, meta) {
+		return true, nil
+	}
+	if need == accessView && meta.EffectiveVisibility() != VisibilityPrivate {
+		return true, nil
+	}
+	if need == accessManage || user == nil || s.acl == nil {
+		return false, nil
+	}
+	grants, err := s.acl.ReadACL(ctx, meta.Id)
+	if err != nil {
+		return false, err
+	}
+	switch grantedRole(grants, user) {
+	case RoleEditor:
+		return true, nil
+	case RoleViewer:
+		return need == accessView, nil
+	default:
+		return false, nil
+	}
+}
+
+// canView reports whether user may watch the video. If the grants cannot be
+// read it logs the error and errs on the side of keeping the video hidden.
+func (s *server) canView(ctx context.Context, user *Principal, meta *VideoMetadata) bool {
+	ok, err := s.can(ctx, user, meta, accessView)
+	if err != nil {
+		slog.Error("failed to read video grants", "video_id", meta.Id, "error", err)
+	}
+	return ok
+}
+
+// checkAccess is can for JSON handlers. It responds with 403 and returns
+// false if user lacks need, or with 500 if the grants cannot be read.
+func (s *server) checkAccess(w http.ResponseWriter, r *http.Request, user *Principal, meta *VideoMetadata, need access) bool {
+	ok, err := s.can(r.Context(), user, meta, need)
+	if err != nil {
+		slog.Error("failed to read video grants", "video_id", meta.Id, "error", err)
+		s.sendJSONError(w, "failed to read video permissions", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		message := "only the owner can change this video"
+		if need == accessEdit {
+			message = "you may not edit this video"
+		}
+		s.sendJSONError(w, message, http.StatusForbidden)
+	}
+	return ok
+}
+
+// listedFor returns the listing filter for user: public videos, their own
+// and those shared with them. If the videos shared with them cannot be read
+// it logs the error and leaves those out.
+func (s *server) listedFor(ctx context.Context, user *Principal) ListOptions {
+	opts := ListOptions{Listed: true}
+	if user == nil {
+		return opts
+	}
+	opts.Viewer = user.UserId
+	if s.acl != nil {
+		shared, err := s.acl.SharedWith(ctx, user.grantees())
+		if err != nil {
+			slog.Error("failed to list videos shared with user", "user_id", user.UserId, "error", err)
+		}
+		opts.Shared = shared
+	}
+	return opts
+}
+
+type apiGrantResponse struct {
+	Grantee Grantee `json:"grantee"`
+	Role    Role    `json:"role"`
+}
+
+type apiGrantsResponse struct {
+	Data []apiGrantResponse `json:"data"`
+}
+
+// handleAPIACL handles GET /api/videos/{id}/acl - list who the video is
+// shared with, POST /api/videos/{id}/acl - share it, and
+// DELETE /api/videos/{id}/acl/{grantee} - stop sharing it. Only those who
+// may manage the video may see or change its grants. A grant is to
+// {"username": ...}, {"userId": ...} or {"group": ...} with a "role" of
+// viewer or editor, and replaces any earlier grant to the same grantee.
+// Revoking a grant does not cut off signed content URLs already handed out,
+// which keep working until they expire.
+func (s *server) handleAPIACL(w http.ResponseWriter, r *http.Request, videoId, grantee string) {
+	if s.acl == nil || s.auth == nil {
+		s.sendJSONError(w, "sharing is not supported by this server", http.StatusNotImplemented)
+		return
+	}
+	switch {
+	case grantee == "" && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+	case grantee != "" && r.Method == http.MethodDelete:
+	default:
+		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if videoId == "" {
+		s.sendJSONError(w, "video ID required", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	meta, err := s.metadataService.Read(r.Context(), videoId)
+	if err != nil {
+		slog.Error("failed to read video metadata", "video_id", videoId, "error", err)
+		s.sendJSONError(w, "failed to read video metadata", http.StatusInternalServerError)
+		return
+	}
+	if meta == nil || meta.Status == StatusDeleted || !s.canView(r.Context(), user, meta) {
+		s.sendJSONError(w, "video not found", http.StatusNotFound)
+		return
+	}
+	if !s.checkAccess(w, r, user, meta, accessManage) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		grant, ok := s.readGrant(w, r)
+		if !ok {
+			return
+		}
+		if err := s.acl.PutGrant(r.Context(), videoId, grant); err != nil {
+			slog.Error("failed to share video", "video_id", videoId, "grantee", grant.Grantee, "error", err)
+			s.sendJSONError(w, "failed to share video", http.StatusInternalServerError)
+			return
+		}
+		slog.Info("video shared", "video_id", videoId, "grantee", grant.Grantee, "role", grant.Role)
+	case http.MethodDelete:
+		parsed, err := ParseGrantee(grantee)
+		if err != nil {
+			s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.acl.RevokeGrant(r.Context(), videoId, parsed)
+		if errors.Is(err, ErrNotFound) {
+			s.sendJSONError(w, "video is not shared with "+string(parsed), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to revoke video grant", "video_id", videoId, "grantee", parsed, "error", err)
+			s.sendJSONError(w, "failed to revoke grant", http.StatusInternalServerError)
+			return
+		}
+		slog.Info("video grant revoked", "video_id", videoId, "grantee", parsed)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	grants, err := s.acl.ReadACL(r.Context(), videoId)
+	if err != nil {
+		slog.Error("failed to read video grants", "video_id", videoId, "error", err)
+		s.sendJSONError(w, "failed to read video grants", http.StatusInternalServerError)
+		return
+	}
+	response := apiGrantsResponse{Data: make([]apiGrantResponse, 0, len(grants))}
+	for _, grant := range grants {
+		response.Data = append(response.Data, apiGrantResponse{Grantee: grant.Grantee, Role: grant.Role})
+	}
+	s.sendJSON(w, response, http.StatusOK)
+}
+
+// readGrant decodes the body of a grant request, looking usernames up in
+// the user store, and responds with 400 if it is invalid.
+func (s *server) readGrant(w http.ResponseWriter, r *http.Request) (Grant, bool) {
+	var body struct {
+		Username string `json:"username"`
+		UserId   string `json:"userId"`
+		Group    string `json:"group"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.sendJSONError(w, "invalid request body", http.StatusBadRequest)
+		return Grant{}, false
+	}
+	role, err := ParseRole(body.Role)
+	if err != nil {
+		s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return Grant{}, false
+	}
+
+	var grantee string
+	switch {
+	case body.Username != "" && body.UserId == "" && body.Group == "":
+		if s.users == nil {
+			s.sendJSONError(w, "accounts are disabled, share by userId instead", http.StatusBadRequest)
+			return Grant{}, false
+		}
+		username, err := NormalizeUsername(body.Username)
+		if err != nil {
+			s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+			return Grant{}, false
+		}
+		user, err := s.users.ReadUser(r.Context(), username)
+		if err != nil {
+			slog.Error("failed to read user", "username", username, "error", err)
+			s.sendJSONError(w, "failed to look up user", http.StatusInternalServerError)
+			return Grant{}, false
+		}
+		if user == nil {
+			s.sendJSONError(w, "no user named "+username, http.StatusBadRequest)
+			return Grant{}, false
+		}
+		grantee = string(UserGrantee(user.Id))
+	case body.UserId != "" && body.Username == "" && body.Group == "":
+		grantee = string(UserGrantee(body.UserId))
+	case body.Group != "" && body.Username == "" && body.UserId == "":
+		grantee = string(GroupGrantee(body.Group))
+	default:
+		s.sendJSONError(w, "give exactly one of username, userId or group", http.StatusBadRequest)
+		return Grant{}, false
+	}
+
+	parsed, err := ParseGrantee(grantee)
+	if err != nil {
+		s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return Grant{}, false
+	}
+	return Grant{Grantee: parsed, Role: role}, true
+}
+
+// aclPath splits rest, the path after /api/videos/, into the video ID and
+// grantee of an ACL request, and reports whether it is one.
+func aclPath(rest string) (videoId, grantee string, ok bool) {
+	if videoId, ok := strings.CutSuffix(rest, "/acl"); ok {
+		return videoId, "", true
+	}
+	videoId, grantee, ok = strings.Cut(rest, "/acl/")
+	return videoId, grantee, ok && grantee != ""
+}
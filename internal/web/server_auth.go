@@ -0,0 +1,112 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// SetAuthenticator enables authentication of API keys and tokens, and the
+// per-route access rules of routes, or DefaultRouteRules if routes is nil.
+// Without it, and without SetUsers, every endpoint is open. Call it before
+// Start.
+func (s *server) SetAuthenticator(auth *Authenticator, routes *RoutePolicy) {
+	s.auth = auth
+	s.routes = routes
+}
+
+// authMiddleware attaches the principal of each request to its context and
+// turns away requests that do not meet their route's access rule: with 401
+// if they are anonymous or their credentials are bad, and with 403 if they
+// lack the admin scope.
+func (s *server) authMiddleware(next http.Handler) http.Handler {
+	if s.auth == nil {
+		return next
+	}
+	routes := s.routes
+	if routes == nil {
+		routes = NewRoutePolicy(DefaultRouteRules)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := s.auth.Authenticate(r)
+		if err != nil {
+			slog.Info("rejected credentials", "path", r.URL.Path, "remote_addr", r.RemoteAddr, "error", err)
+			if !s.chargeRejectedCredentials(w, r) {
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			s.sendJSONError(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		switch routes.Access(r.Method, r.URL.Path) {
+		case AccessAuthenticated:
+			if principal == nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				s.sendJSONError(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+		case AccessAdmin:
+			if principal == nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				s.sendJSONError(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !principal.IsAdmin() {
+				slog.Warn("admin route refused", "path", r.URL.Path, "user_id", principal.UserId, "method", principal.Method)
+				s.sendJSONError(w, "admin scope required", http.StatusForbidden)
+				return
+			}
+		}
+
+		if principal != nil {
+			r = r.WithContext(withPrincipal(r.Context(), principal))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAPIAdminVideo handles DELETE /api/admin/videos/{id}, which purges a
+// video at once, skipping the trash. The route policy keeps it to admins.
+func (s *server) handleAPIAdminVideo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	videoId := strings.TrimPrefix(r.URL.Path, "/api/admin/videos/")
+	if videoId == "" {
+		s.sendJSONError(w, "video ID required", http.StatusBadRequest)
+		return
+	}
+	// Guard against a policy file that opens the route up.
+	user := s.currentUser(r)
+	if s.auth != nil && !user.IsAdmin() {
+		s.sendJSONError(w, "admin scope required", http.StatusForbidden)
+		return
+	}
+
+	meta, err := s.metadataService.Read(r.Context(), videoId)
+	if err != nil {
+		slog.Error("failed to read video metadata", "video_id", videoId, "error", err)
+		s.sendJSONError(w, "failed to read video metadata", http.StatusInternalServerError)
+		return
+	}
+	if meta == nil {
+		s.sendJSONError(w, "video not found", http.StatusNotFound)
+		return
+	}
+
+	if err := PurgeVideo(r.Context(), s.metadataService, s.contentService, videoId); err != nil {
+		slog.Error("failed to purge video", "video_id", videoId, "error", err)
+		s.sendJSONError(w, "failed to purge video", http.StatusInternalServerError)
+		return
+	}
+
+	var by string
+	if user != nil {
+		by = user.UserId
+	}
+	slog.Warn("video purged by admin", "video_id", videoId, "by", by)
+	w.WriteHeader(http.StatusNoContent)
+}
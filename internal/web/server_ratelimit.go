@@ -0,0 +1,79 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// SetRateLimits enables per-client rate limiting. Call it before Start.
+func (s *server) SetRateLimits(limits *RateLimits) {
+	s.rateLimits = limits
+}
+
+// SetTranscodeLimiter caps the transcodes run by this server, which are
+// otherwise unlimited. Call it before Start.
+func (s *server) SetTranscodeLimiter(limiter *TranscodeLimiter) {
+	s.transcodes = limiter
+}
+
+// rateLimitMiddleware refuses requests from clients that have used up their
+// budget with 429. It runs after authentication so that authenticated
+// clients are limited by who they are rather than where they connect from.
+func (s *server) rateLimitMiddleware(next http.Handler) http.Handler {
+	if s.rateLimits == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, budget, wait := s.rateLimits.allow(r)
+		if !allowed {
+			s.sendRateLimited(w, r, budget, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chargeRejectedCredentials charges a request whose credentials were
+// rejected to the auth budget of its address, so that guessing keys and
+// tokens is limited like guessing passwords. Once the address has run out
+// it responds with 429 and returns false.
+func (s *server) chargeRejectedCredentials(w http.ResponseWriter, r *http.Request) bool {
+	if s.rateLimits == nil {
+		return true
+	}
+	allowed, wait := s.rateLimits.allowRejected(r)
+	if !allowed {
+		s.sendRateLimited(w, r, budgetAuth, wait)
+	}
+	return allowed
+}
+
+func (s *server) sendRateLimited(w http.ResponseWriter, r *http.Request, budget string, wait time.Duration) {
+	rateLimitedRequests.Add(budget, 1)
+	slog.Info("rate limited", "budget", budget, "client", s.rateLimits.clientKey(r), "path", r.URL.Path, "retry_after", wait)
+	setRetryAfter(w, wait)
+	s.sendJSONError(w, "too many requests, slow down", http.StatusTooManyRequests)
+}
+
+// acquireTranscode takes a transcode slot. If all are busy it responds with
+// 503 and returns false; the caller must call release otherwise. html picks
+// a plain text error for the HTML form.
+func (s *server) acquireTranscode(w http.ResponseWriter, html bool) (release func(), ok bool) {
+	if s.transcodes == nil {
+		return func() {}, true
+	}
+	release, ok = s.transcodes.TryAcquire()
+	if ok {
+		return release, true
+	}
+	slog.Warn("transcode refused, all slots busy", "slots", cap(s.transcodes.slots))
+	setRetryAfter(w, s.transcodes.retryAfter)
+	const message = "the server is busy processing other videos, try again later"
+	if html {
+		http.Error(w, message, http.StatusServiceUnavailable)
+	} else {
+		s.sendJSONError(w, message, http.StatusServiceUnavailable)
+	}
+	return nil, false
+}
@@ -0,0 +1,230 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// sessionCookie holds the session token of a signed-in user.
+const sessionCookie = "tritontube_session"
+
+// SetUsers enables accounts: registration and login under /api/auth/.
+// Signed-in users are authenticated by their session cookie, in addition to
+// whatever the Authenticator given to SetAuthenticator accepts. Call it
+// before Start.
+func (s *server) SetUsers(store UserStore, sessions *SessionStore) {
+	s.users = store
+	s.sessions = sessions
+}
+
+type apiUserResponse struct {
+	Id        string   `json:"id"`
+	Username  string   `json:"username,omitempty"`
+	CreatedAt string   `json:"createdAt,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Method    string   `json:"method,omitempty"`
+}
+
+func newAPIUserResponse(user *User) apiUserResponse {
+	return apiUserResponse{
+		Id:        user.Id,
+		Username:  user.Username,
+		CreatedAt: user.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func newAPIPrincipalResponse(p *Principal) apiUserResponse {
+	response := apiUserResponse{Id: p.UserId, Username: p.Username}
+	if p.user != nil {
+		response = newAPIUserResponse(p.user)
+	}
+	response.Scopes = p.Scopes
+	response.Method = p.Method
+	return response
+}
+
+// currentUser returns the principal of r, or nil if it is anonymous.
+func (s *server) currentUser(r *http.Request) *Principal {
+	return PrincipalFrom(r.Context())
+}
+
+// requireUser returns the principal of r. If it is anonymous it responds
+// with 401 and returns false. With authentication disabled it returns
+// (nil, true).
+func (s *server) requireUser(w http.ResponseWriter, r *http.Request) (*Principal, bool) {
+	if s.auth == nil {
+		return nil, true
+	}
+	user := s.currentUser(r)
+	if user == nil {
+		s.sendJSONError(w, "sign in required", http.StatusUnauthorized)
+		return nil, false
+	}
+	return user, true
+}
+
+// authorizeChange checks that the principal of r may manage the video,
+// which may be in the trash, and responds with an error if not. Private
+// videos they may not even view look missing.
+func (s *server) authorizeChange(w http.ResponseWriter, r *http.Request, videoId string) bool {
+	if s.auth == nil {
+		return true
+	}
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return false
+	}
+	meta, err := s.metadataService.Read(r.Context(), videoId)
+	if err != nil {
+		slog.Error("failed to read video metadata", "video_id", videoId, "error", err)
+		s.sendJSONError(w, "failed to read video metadata", http.StatusInternalServerError)
+		return false
+	}
+	if meta == nil || !s.canView(r.Context(), user, meta) {
+		s.sendJSONError(w, "video not found", http.StatusNotFound)
+		return false
+	}
+	return s.checkAccess(w, r, user, meta, accessManage)
+}
+
+// ownerOf returns the owner to record for a video user creates, which is
+// nobody when authentication is disabled.
+func ownerOf(user *Principal) string {
+	if user == nil {
+		return ""
+	}
+	return user.UserId
+}
+
+// handleAPIRegister handles POST /api/auth/register with
+// {"username": "...", "password": "..."}. It creates the account, signs it in
+// and responds with the user.
+func (s *server) handleAPIRegister(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := s.readCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := RegisterUser(r.Context(), s.users, username, password)
+	switch {
+	case errors.Is(err, ErrInvalidUsername), errors.Is(err, ErrWeakPassword):
+		s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrUserExists):
+		s.sendJSONError(w, "username already taken", http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("failed to register user", "username", username, "error", err)
+		s.sendJSONError(w, "failed to register user", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("user registered", "user_id", user.Id, "username", user.Username)
+	s.startSession(w, r, user)
+	s.sendJSON(w, newAPIUserResponse(user), http.StatusCreated)
+}
+
+// handleAPILogin handles POST /api/auth/login with
+// {"username": "...", "password": "..."} and sets the session cookie.
+func (s *server) handleAPILogin(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := s.readCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := AuthenticateUser(r.Context(), s.users, username, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		slog.Info("failed login", "username", username, "remote_addr", r.RemoteAddr)
+		s.sendJSONError(w, "invalid username or password", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to authenticate user", "username", username, "error", err)
+		s.sendJSONError(w, "failed to sign in", http.StatusInternalServerError)
+		return
+	}
+
+	s.startSession(w, r, user)
+	s.sendJSON(w, newAPIUserResponse(user), http.StatusOK)
+}
+
+// handleAPILogout handles POST /api/auth/logout.
+func (s *server) handleAPILogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.sessions == nil {
+		s.sendJSONError(w, "accounts are not enabled on this server", http.StatusNotImplemented)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		s.sessions.Delete(cookie.Value)
+	}
+	http.SetCookie(w, s.sessionCookie(r, "", -1))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAPIMe handles GET /api/auth/me, returning the signed-in user or
+// whoever the request's API key or token belongs to.
+func (s *server) handleAPIMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.auth == nil {
+		s.sendJSONError(w, "authentication is not enabled on this server", http.StatusNotImplemented)
+		return
+	}
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.sendJSON(w, newAPIPrincipalResponse(user), http.StatusOK)
+}
+
+// readCredentials decodes the body of a register or login request.
+func (s *server) readCredentials(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	if r.Method != http.MethodPost {
+		s.sendJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return "", "", false
+	}
+	if s.users == nil {
+		s.sendJSONError(w, "accounts are not enabled on this server", http.StatusNotImplemented)
+		return "", "", false
+	}
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+		s.sendJSONError(w, "invalid request body", http.StatusBadRequest)
+		return "", "", false
+	}
+	if body.Username == "" || body.Password == "" {
+		s.sendJSONError(w, "username and password are required", http.StatusBadRequest)
+		return "", "", false
+	}
+	return body.Username, body.Password, true
+}
+
+func (s *server) startSession(w http.ResponseWriter, r *http.Request, user *User) {
+	token := s.sessions.Create(*user)
+	http.SetCookie(w, s.sessionCookie(r, token, int(s.sessions.ttl.Seconds())))
+}
+
+func (s *server) sessionCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		// Behind the load balancer TLS ends before the request reaches us.
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// presignedReadTTL is how long the storage URLs that signed content
+// requests are redirected to stay valid. Players follow the redirect at
+// once, so it only needs to cover slow starts.
+const presignedReadTTL = 5 * time.Minute
+
+// SetContentSigner sets the key private videos' content URLs are signed
+// with. Without it a random key is used, so URLs stop working when the
+// server restarts and do not work on other instances. Call it before Start.
+func (s *server) SetContentSigner(signer *ContentSigner) {
+	s.signer = signer
+}
+
+// SetContentPresigner makes signed content requests for private videos
+// redirect to presigned storage URLs rather than passing the data through
+// this server. The manifest is still served here so that its relative
+// segment URLs keep the token. Call it before Start.
+func (s *server) SetContentPresigner(presigner ContentURLPresigner) {
+	s.presigner = presigner
+}
+
+// parseVisibilityField parses an optional visibility form or JSON field and
+// responds with 400 if it is invalid.
+func (s *server) parseVisibilityField(w http.ResponseWriter, value string, html bool) (Visibility, bool) {
+	visibility, err := ParseVisibility(value)
+	if err != nil {
+		if html {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			s.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		}
+		return "", false
+	}
+	return visibility, true
+}
+
+// contentRequest is a parsed /content/ or /thumbnail/ request.
+type contentRequest struct {
+	videoId  string
+	filename string
+	signed   bool // the path carried a valid token
+}
+
+// parseContentPath parses rest, the path after /content/ or /thumbnail/,
+// which is "<id>[/<file>]" or "s/<token>/<id>[/<file>]" for signed URLs.
+// withFile says whether a filename is expected. It responds with an error
+// and returns false if the path is malformed or its token is not valid for
+// the video.
+func (s *server) parseContentPath(w http.ResponseWriter, rest string, withFile bool) (contentRequest, bool) {
+	var req contentRequest
+	var token string
+	if signed, ok := strings.CutPrefix(rest, "s/"); ok {
+		token, rest, _ = strings.Cut(signed, "/")
+		req.signed = true
+	}
+
+	parts := strings.Split(rest, "/")
+	if withFile && len(parts) == 2 {
+		req.videoId, req.filename = parts[0], parts[1]
+	} else if !withFile && len(parts) == 1 {
+		req.videoId = parts[0]
+	}
+	if req.videoId == "" || (withFile && req.filename == "") {
+		http.Error(w, "Invalid content path", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.signed && !s.signer.Verify(token, req.videoId, time.Now()) {
+		http.Error(w, "link expired or invalid, reload the video", http.StatusForbidden)
+		return req, false
+	}
+	return req, true
+}
+
+// checkContentAccess responds with 404 and returns nil unless the video can
+// be played through req. Private videos need a signed URL, or a principal
+// who may view them; asking for one without either gets the same answer as
+// a missing video, so it does not reveal that the video exists.
+func (s *server) checkContentAccess(w http.ResponseWriter, r *http.Request, req contentRequest) *VideoMetadata {
+	meta, ok := s.checkPlayable(w, r, req.videoId)
+	if !ok {
+		return nil
+	}
+	if meta.EffectiveVisibility() == VisibilityPrivate && !req.signed && !s.canView(r.Context(), s.currentUser(r), meta) {
+		http.NotFound(w, r)
+		return nil
+	}
+	return meta
+}
+
+// redirectToStorage redirects a signed request to a presigned URL for the
+// file, and returns false if there is no presigner or presigning failed, in
+// which case the caller serves the file itself.
+func (s *server) redirectToStorage(w http.ResponseWriter, r *http.Request, req contentRequest) bool {
+	if s.presigner == nil || !req.signed {
+		return false
+	}
+	target, err := s.presigner.PresignRead(r.Context(), req.videoId, req.filename, presignedReadTTL)
+	if err != nil {
+		slog.Warn("failed to presign content read, serving it directly", "video_id", req.videoId, "filename", req.filename, "error", err)
+		return false
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+	return true
+}
@@ -3,8 +3,10 @@
 package web
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -24,34 +26,104 @@ func NewSQLiteVideoMetadataService(dbPath string) (*SQLiteVideoMetadataService,
 		return nil, err
 	}
 
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS video_metadata (
-			video_id TEXT PRIMARY KEY,
-			uploaded_at DATETIME,
-			status TEXT DEFAULT 'ready'
-		)
-	`)
-
-	if err != nil {
+	if err := migrateSQLite(db); err != nil {
 		return nil, err
 	}
 
 	return &SQLiteVideoMetadataService{db: db}, nil
 }
 
-func (s *SQLiteVideoMetadataService) Create(videoId string, uploadedAt time.Time) error {
-	return s.CreateWithStatus(videoId, uploadedAt, "ready")
+// sqliteTimeFormat is how uploaded_at is stored: UTC and fixed width, so that
+// comparing the text compares the times. The driver's default (time.String)
+// includes a monotonic clock reading and trims trailing zeros, which breaks
+// ordering and keyset pagination.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
 }
 
-func (s *SQLiteVideoMetadataService) CreateWithStatus(videoId string, uploadedAt time.Time, status string) error {
-	_, err := s.db.Exec(
-		"INSERT INTO video_metadata (video_id, uploaded_at, status) VALUES (?, ?, ?)",
-		videoId, uploadedAt, status,
+// normalizeUploadTimes rewrites uploaded_at values stored in any other format
+// into sqliteTimeFormat. It is the Go step of migration 0012, since SQL
+// cannot parse the formats the driver used to write.
+func normalizeUploadTimes(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT video_id, uploaded_at FROM video_metadata WHERE length(uploaded_at) != ?", len(sqliteTimeFormat))
+	if err != nil {
+		return err
+	}
+	fixed := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var t time.Time
+		if err := rows.Scan(&id, &t); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to parse upload time: %w", err)
+		}
+		fixed[id] = t
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, t := range fixed {
+		if _, err := tx.Exec("UPDATE video_metadata SET uploaded_at = ? WHERE video_id = ?", sqliteTime(t), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// videoMetadataSelect lists the columns scanned by scanVideoMetadata.
+const videoMetadataSelect = `SELECT video_id, uploaded_at, COALESCE(status, 'ready'), title, description,
+	duration, file_size, width, height, bitrate, video_codec, audio_codec, version,
+	failure_reason, progress, deleted_at, restore_status, owner_id, visibility FROM video_metadata`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideoMetadata(row rowScanner) (VideoMetadata, error) {
+	var v VideoMetadata
+	var deletedAt sql.NullTime
+	err := row.Scan(&v.Id, &v.UploadedAt, &v.Status, &v.Title, &v.Description,
+		&v.Duration, &v.FileSize, &v.Width, &v.Height, &v.Bitrate, &v.VideoCodec, &v.AudioCodec, &v.Version,
+		&v.FailureReason, &v.Progress, &deletedAt, &v.RestoreStatus, &v.OwnerId, &v.Visibility)
+	v.DeletedAt = deletedAt.Time
+	return v, err
+}
+
+// sqliteNullTime stores a zero time as NULL.
+func sqliteNullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return sqliteTime(t)
+}
+
+// SchemaVersion returns the version of the last applied migration.
+func (s *SQLiteVideoMetadataService) SchemaVersion() (int, error) {
+	return schemaVersion(s.db)
+}
+
+// Close closes the underlying database.
+func (s *SQLiteVideoMetadataService) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteVideoMetadataService) Create(ctx context.Context, videoId string, uploadedAt time.Time, ownerId string, visibility Visibility) error {
+	return s.CreateWithStatus(ctx, videoId, uploadedAt, StatusReady, ownerId, visibility)
+}
+
+func (s *SQLiteVideoMetadataService) CreateWithStatus(ctx context.Context, videoId string, uploadedAt time.Time, status VideoStatus, ownerId string, visibility Visibility) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO video_metadata (video_id, uploaded_at, status, owner_id, visibility) VALUES (?, ?, ?, ?, ?)",
+		videoId, sqliteTime(uploadedAt), status, ownerId, visibility.orPublic(),
 	)
 
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return errors.New("video ID already exists")
+			return ErrAlreadyExists
 		}
 
 		return err
@@ -60,16 +132,86 @@ func (s *SQLiteVideoMetadataService) CreateWithStatus(videoId string, uploadedAt
 	return nil
 }
 
-func (s *SQLiteVideoMetadataService) UpdateStatus(videoId string, status string) error {
-	_, err := s.db.Exec(
-		"UPDATE video_metadata SET status = ? WHERE video_id = ?",
+func (s *SQLiteVideoMetadataService) UpdateStatus(ctx context.Context, videoId string, status VideoStatus) error {
+	return s.updateRow(ctx,
+		"UPDATE video_metadata SET status = ?, version = version + 1 WHERE video_id = ?",
 		status, videoId,
 	)
-	return err
 }
 
-func (s *SQLiteVideoMetadataService) List() ([]VideoMetadata, error) {
-	rows, err := s.db.Query("SELECT video_id, uploaded_at, COALESCE(status, 'ready') FROM video_metadata ORDER BY uploaded_at DESC")
+func (s *SQLiteVideoMetadataService) UpdateDetails(ctx context.Context, videoId string, title string, description string) error {
+	return s.updateRow(ctx,
+		"UPDATE video_metadata SET title = ?, description = ?, version = version + 1 WHERE video_id = ?",
+		title, description, videoId,
+	)
+}
+
+func (s *SQLiteVideoMetadataService) UpdateMediaInfo(ctx context.Context, videoId string, info MediaInfo) error {
+	return s.updateRow(ctx,
+		`UPDATE video_metadata SET duration = ?, file_size = ?, width = ?, height = ?, bitrate = ?,
+			video_codec = ?, audio_codec = ?, version = version + 1 WHERE video_id = ?`,
+		info.Duration, info.FileSize, info.Width, info.Height, info.Bitrate,
+		info.VideoCodec, info.AudioCodec, videoId,
+	)
+}
+
+// Update writes meta only if its version is still the stored one.
+func (s *SQLiteVideoMetadataService) Update(ctx context.Context, meta *VideoMetadata) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE video_metadata SET status = ?, title = ?, description = ?, duration = ?, file_size = ?,
+			width = ?, height = ?, bitrate = ?, video_codec = ?, audio_codec = ?, failure_reason = ?,
+			progress = ?, deleted_at = ?, restore_status = ?, owner_id = ?, visibility = ?, version = version + 1
+			WHERE video_id = ? AND version = ?`,
+		meta.Status, meta.Title, meta.Description, meta.Duration, meta.FileSize,
+		meta.Width, meta.Height, meta.Bitrate, meta.VideoCodec, meta.AudioCodec, meta.FailureReason,
+		meta.Progress, sqliteNullTime(meta.DeletedAt), meta.RestoreStatus, meta.OwnerId, meta.EffectiveVisibility(), meta.Id, meta.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		var exists bool
+		err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM video_metadata WHERE video_id = ?)", meta.Id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+
+	meta.Version++
+	return nil
+}
+
+// updateRow runs an UPDATE and reports a missing video as an error.
+func (s *SQLiteVideoMetadataService) updateRow(ctx context.Context, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SQLiteVideoMetadataService) List(ctx context.Context) ([]VideoMetadata, error) {
+	rows, err := s.db.QueryContext(ctx, videoMetadataSelect+" WHERE COALESCE(status, 'ready') != ? ORDER BY uploaded_at DESC", StatusDeleted)
 
 	if err != nil {
 		return nil, err
@@ -78,8 +220,8 @@ func (s *SQLiteVideoMetadataService) List() ([]VideoMetadata, error) {
 
 	var result []VideoMetadata
 	for rows.Next() {
-		var v VideoMetadata
-		if err := rows.Scan(&v.Id, &v.UploadedAt, &v.Status); err != nil {
+		v, err := scanVideoMetadata(rows)
+		if err != nil {
 			return nil, err
 		}
 		result = append(result, v)
@@ -88,11 +230,118 @@ func (s *SQLiteVideoMetadataService) List() ([]VideoMetadata, error) {
 	return result, nil
 }
 
-func (s *SQLiteVideoMetadataService) Read(videoId string) (*VideoMetadata, error) {
-	row := s.db.QueryRow("SELECT video_id, uploaded_at, COALESCE(status, 'ready') FROM video_metadata WHERE video_id = ?", videoId)
+// sqliteSortColumns maps ListOptions.SortBy to the expression ordered on. It
+// must agree with sortValue so cursors compare correctly; lower() only folds
+// ASCII, like foldTitle.
+var sqliteSortColumns = map[string]string{
+	SortByUploadedAt: "uploaded_at",
+	SortByTitle:      "lower(title)",
+	SortByDuration:   "duration",
+}
 
-	var v VideoMetadata
-	if err := row.Scan(&v.Id, &v.UploadedAt, &v.Status); err != nil {
+// Query returns one page of videos using keyset pagination, so each page
+// costs the same regardless of how deep into the list it is.
+func (s *SQLiteVideoMetadataService) Query(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+	if opts.Status != "" {
+		where = append(where, "COALESCE(status, 'ready') = ?")
+		args = append(args, opts.Status)
+	} else if !opts.IncludeTrash {
+		where = append(where, "COALESCE(status, 'ready') != ?")
+		args = append(args, StatusDeleted)
+	}
+	if opts.Owner != "" {
+		where = append(where, "owner_id = ?")
+		args = append(args, opts.Owner)
+	}
+	if opts.Listed {
+		cond, condArgs := listedCondition("", opts)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+	if opts.Search != "" {
+		pattern := "%" + escapeLike(opts.Search) + "%"
+		where = append(where, `(video_id LIKE ? ESCAPE '\' OR title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM video_metadata" + whereClause(where)
+	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	column := sqliteSortColumns[opts.SortBy]
+	cmp, dir := "<", "DESC"
+	if opts.SortOrder == SortAsc {
+		cmp, dir = ">", "ASC"
+	}
+	if opts.Cursor != "" {
+		value, id, err := decodeCursor(opts)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := value.(time.Time); ok {
+			value = sqliteTime(t)
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND video_id %[2]s ?))", column, cmp))
+		args = append(args, value, value, id)
+	}
+
+	query := fmt.Sprintf("%s%s ORDER BY %s %s, video_id %s LIMIT ?",
+		videoMetadataSelect, whereClause(where), column, dir, dir)
+	args = append(args, opts.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &ListResult{Total: total}
+	for rows.Next() {
+		v, err := scanVideoMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Videos = append(result.Videos, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Videos) > opts.Limit {
+		result.Videos = result.Videos[:opts.Limit]
+		result.NextCursor = encodeCursor(result.Videos[opts.Limit-1], opts)
+	}
+	return result, nil
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (s *SQLiteVideoMetadataService) Read(ctx context.Context, videoId string) (*VideoMetadata, error) {
+	row := s.db.QueryRowContext(ctx, videoMetadataSelect+" WHERE video_id = ?", videoId)
+
+	v, err := scanVideoMetadata(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -102,8 +351,8 @@ func (s *SQLiteVideoMetadataService) Read(videoId string) (*VideoMetadata, error
 	return &v, nil
 }
 
-func (s *SQLiteVideoMetadataService) Delete(videoId string) error {
-	result, err := s.db.Exec("DELETE FROM video_metadata WHERE video_id = ?", videoId)
+func (s *SQLiteVideoMetadataService) Delete(ctx context.Context, videoId string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM video_metadata WHERE video_id = ?", videoId)
 	if err != nil {
 		return err
 	}
@@ -114,8 +363,27 @@ func (s *SQLiteVideoMetadataService) Delete(videoId string) error {
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("video not found")
+		return ErrNotFound
 	}
 
 	return nil
 }
+
+// listedCondition returns the SQL condition for ListOptions.Listed on the
+// video_metadata columns, qualified with prefix: public videos, the viewer's
+// own and those shared with them.
+func listedCondition(prefix string, opts ListOptions) (string, []any) {
+	conds := []string{prefix + "visibility = ?"}
+	args := []any{VisibilityPublic}
+	if opts.Viewer != "" {
+		conds = append(conds, prefix+"owner_id = ?")
+		args = append(args, opts.Viewer)
+	}
+	if len(opts.Shared) > 0 {
+		conds = append(conds, prefix+"video_id IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(opts.Shared)), ", ")+")")
+		for _, id := range opts.Shared {
+			args = append(args, id)
+		}
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
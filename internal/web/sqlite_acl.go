@@ -0,0 +1,78 @@
+package web
+
+import (
+	"context"
+	"strings"
+)
+
+var _ ACLStore = (*SQLiteVideoMetadataService)(nil)
+
+func (s *SQLiteVideoMetadataService) ReadACL(ctx context.Context, videoId string) ([]Grant, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT grantee, role FROM video_acl WHERE video_id = ?", videoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []Grant
+	for rows.Next() {
+		var grant Grant
+		if err := rows.Scan(&grant.Grantee, &grant.Role); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+func (s *SQLiteVideoMetadataService) PutGrant(ctx context.Context, videoId string, grant Grant) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO video_acl (video_id, grantee, role) VALUES (?, ?, ?)
+			ON CONFLICT (video_id, grantee) DO UPDATE SET role = excluded.role`,
+		videoId, grant.Grantee, grant.Role,
+	)
+	return err
+}
+
+func (s *SQLiteVideoMetadataService) RevokeGrant(ctx context.Context, videoId string, grantee Grantee) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM video_acl WHERE video_id = ? AND grantee = ?", videoId, grantee)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteVideoMetadataService) SharedWith(ctx context.Context, grantees []Grantee) ([]string, error) {
+	if len(grantees) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(grantees))
+	for i, grantee := range grantees {
+		args[i] = grantee
+	}
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT DISTINCT video_id FROM video_acl WHERE grantee IN (?"+strings.Repeat(", ?", len(grantees)-1)+")",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+var _ VideoSearcher = (*SQLiteVideoMetadataService)(nil)
+
+// Relevance weights for bm25, in video_search column order.
+const (
+	searchWeightId          = 0.0
+	searchWeightTitle       = 10.0
+	searchWeightDescription = 1.0
+)
+
+// Search runs a ranked full-text query over titles and descriptions.
+func (s *SQLiteVideoMetadataService) Search(ctx context.Context, query string, opts ListOptions) (*SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := decodeSearchCursor(opts.Cursor, query, string(opts.Status))
+	if err != nil {
+		return nil, err
+	}
+
+	// Every term must match, each as a quoted prefix so it is never parsed
+	// as an FTS5 operator.
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"*`
+	}
+	match := "{title description} : " + strings.Join(quoted, " ")
+
+	where := "video_search MATCH ?"
+	args := []any{match}
+	if opts.Status != "" {
+		where += " AND COALESCE(m.status, 'ready') = ?"
+		args = append(args, opts.Status)
+	} else if !opts.IncludeTrash {
+		where += " AND COALESCE(m.status, 'ready') != ?"
+		args = append(args, StatusDeleted)
+	}
+	if opts.Listed {
+		cond, condArgs := listedCondition("m.", opts)
+		where += " AND " + cond
+		args = append(args, condArgs...)
+	}
+
+	result := &SearchResult{}
+	countQuery := "SELECT COUNT(*) FROM video_search JOIN video_metadata m ON m.video_id = video_search.video_id WHERE " + where
+	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&result.Total); err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT m.video_id, m.uploaded_at, COALESCE(m.status, 'ready'), m.title, m.description,
+			m.duration, m.file_size, m.width, m.height, m.bitrate, m.video_codec, m.audio_codec, m.version,
+			m.failure_reason, m.progress, m.deleted_at, m.restore_status, m.owner_id, m.visibility,
+			bm25(video_search, %g, %g, %g),
+			highlight(video_search, 1, ?, ?),
+			snippet(video_search, 2, ?, ?, '…', 16)
+		FROM video_search JOIN video_metadata m ON m.video_id = video_search.video_id
+		WHERE %s
+		ORDER BY bm25(video_search, %[1]g, %[2]g, %[3]g), m.video_id
+		LIMIT ? OFFSET ?`,
+		searchWeightId, searchWeightTitle, searchWeightDescription, where),
+		append(append([]any{highlightStart, highlightEnd, highlightStart, highlightEnd}, args...), opts.Limit+1, offset)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			hit       SearchHit
+			v         = &hit.Video
+			bm25      float64
+			title     sql.NullString
+			snippet   sql.NullString
+			deletedAt sql.NullTime
+		)
+		if err := rows.Scan(&v.Id, &v.UploadedAt, &v.Status, &v.Title, &v.Description,
+			&v.Duration, &v.FileSize, &v.Width, &v.Height, &v.Bitrate, &v.VideoCodec, &v.AudioCodec, &v.Version,
+			&v.FailureReason, &v.Progress, &deletedAt, &v.RestoreStatus, &v.OwnerId, &v.Visibility,
+			&bm25, &title, &snippet); err != nil {
+			return nil, err
+		}
+		v.DeletedAt = deletedAt.Time
+		// bm25 is lower for better matches; flip it so higher means better.
+		hit.Score = -bm25
+		hit.Title = renderHighlight(title.String)
+		hit.Snippet = renderHighlight(snippet.String)
+		result.Hits = append(result.Hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Hits) > opts.Limit {
+		result.Hits = result.Hits[:opts.Limit]
+		result.NextCursor = encodeSearchCursor(searchCursor{
+			Query:  query,
+			Status: string(opts.Status),
+			Offset: offset + opts.Limit,
+		})
+	}
+	return result, nil
+}
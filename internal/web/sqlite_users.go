@@ -0,0 +1,43 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var _ UserStore = (*SQLiteVideoMetadataService)(nil)
+
+func (s *SQLiteVideoMetadataService) CreateUser(ctx context.Context, user User) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO users (user_id, username, password_hash, created_at) VALUES (?, ?, ?, ?)",
+		user.Id, user.Username, user.PasswordHash, sqliteTime(user.CreatedAt),
+	)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: users.username") {
+		return ErrUserExists
+	}
+	return err
+}
+
+func (s *SQLiteVideoMetadataService) ReadUser(ctx context.Context, username string) (*User, error) {
+	var (
+		user      User
+		createdAt string
+	)
+	err := s.db.QueryRowContext(ctx,
+		"SELECT user_id, username, password_hash, created_at FROM users WHERE username = ?", username,
+	).Scan(&user.Id, &user.Username, &user.PasswordHash, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt, err = time.Parse(sqliteTimeFormat, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+var _ VideoMetadataWatcher = (*SQLiteVideoMetadataService)(nil)
+
+// SQLite has no change notifications across connections, so Watch polls the
+// trigger-maintained video_changes table.
+const (
+	sqliteWatchInterval = 500 * time.Millisecond
+	sqliteWatchBatch    = 500
+)
+
+// Watch reports changes recorded in the video_changes log from now on,
+// whichever process made them.
+func (s *SQLiteVideoMetadataService) Watch(ctx context.Context) (<-chan VideoChange, error) {
+	var last int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(seq), 0) FROM video_changes").Scan(&last); err != nil {
+		return nil, err
+	}
+
+	changes := make(chan VideoChange, watchBuffer)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(sqliteWatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			batch, err := s.readChanges(ctx, last)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("sqlite metadata watch failed", "error", err)
+				}
+				return
+			}
+			for _, row := range batch {
+				last = row.seq
+				change := VideoChange{Type: row.change, VideoId: row.videoId}
+				if change.Type != ChangeDeleted {
+					// The log only names the video; report its current state.
+					meta, err := s.Read(ctx, row.videoId)
+					if err != nil {
+						if ctx.Err() == nil {
+							slog.Warn("sqlite metadata watch failed", "error", err)
+						}
+						return
+					}
+					if meta == nil {
+						// Deleted since; its own log row follows.
+						continue
+					}
+					change.Video = meta
+				}
+
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+type sqliteChangeRow struct {
+	seq     int64
+	videoId string
+	change  ChangeType
+}
+
+func (s *SQLiteVideoMetadataService) readChanges(ctx context.Context, after int64) ([]sqliteChangeRow, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT seq, video_id, change FROM video_changes WHERE seq > ? ORDER BY seq LIMIT ?",
+		after, sqliteWatchBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []sqliteChangeRow
+	for rows.Next() {
+		var row sqliteChangeRow
+		if err := rows.Scan(&row.seq, &row.videoId, &row.change); err != nil {
+			return nil, err
+		}
+		batch = append(batch, row)
+	}
+	return batch, rows.Err()
+}
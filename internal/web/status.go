@@ -0,0 +1,152 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// VideoStatus is a stage in a video's lifecycle.
+type VideoStatus string
+
+const (
+	StatusUploaded    VideoStatus = "uploaded"    // source file stored, not yet scheduled
+	StatusQueued      VideoStatus = "queued"      // waiting for a transcoding worker
+	StatusTranscoding VideoStatus = "transcoding" // ffmpeg is running, see Progress
+	StatusPublishing  VideoStatus = "publishing"  // segments are being written to content storage
+	StatusReady       VideoStatus = "ready"
+	StatusFailed      VideoStatus = "failed" // see FailureReason
+	StatusDeleted     VideoStatus = "deleted"
+)
+
+// statusTransitions lists the statuses each status may move to. A failed
+// video can be retried. Deleted is reachable from everywhere and is left
+// only by RestoreVideo, which returns to ready or failed.
+var statusTransitions = map[VideoStatus][]VideoStatus{
+	StatusUploaded:    {StatusQueued, StatusTranscoding, StatusFailed, StatusDeleted},
+	StatusQueued:      {StatusTranscoding, StatusFailed, StatusDeleted},
+	StatusTranscoding: {StatusPublishing, StatusReady, StatusFailed, StatusDeleted},
+	StatusPublishing:  {StatusReady, StatusFailed, StatusDeleted},
+	StatusReady:       {StatusDeleted},
+	StatusFailed:      {StatusQueued, StatusTranscoding, StatusDeleted},
+	StatusDeleted:     {StatusReady, StatusFailed},
+}
+
+var (
+	ErrInvalidStatus     = errors.New("invalid video status")
+	ErrInvalidTransition = errors.New("invalid video status transition")
+)
+
+// statusMaxRetries bounds how often TransitionStatus and SetProgress retry
+// after losing a race with another writer.
+const statusMaxRetries = 10
+
+// ParseVideoStatus parses a status name. The names used before statuses were
+// typed ("processing" and "error") are accepted too.
+func ParseVideoStatus(s string) (VideoStatus, error) {
+	status := legacyStatus(s)
+	if _, ok := statusTransitions[status]; !ok || s == "" {
+		return "", fmt.Errorf("%w %q", ErrInvalidStatus, s)
+	}
+	return status, nil
+}
+
+// legacyStatus maps statuses stored by older versions onto the lifecycle.
+// Entries without a status predate statuses altogether and are ready.
+func legacyStatus(s string) VideoStatus {
+	switch s {
+	case "", "ready":
+		return StatusReady
+	case "processing":
+		return StatusTranscoding
+	case "error":
+		return StatusFailed
+	}
+	return VideoStatus(s)
+}
+
+// CanTransitionTo reports whether a video may move from s to next. Staying
+// in the same status is always allowed.
+func (s VideoStatus) CanTransitionTo(next VideoStatus) bool {
+	if s == next {
+		return true
+	}
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionStatus moves a video to next, checking the transition against
+// its current status. reason is kept as the FailureReason when next is
+// StatusFailed and cleared otherwise. Concurrent updates are retried.
+//
+// Moving into or out of StatusDeleted goes through TrashVideo and
+// RestoreVideo, which also track when and from where the video was deleted.
+func TransitionStatus(ctx context.Context, svc VideoMetadataService, videoId string, next VideoStatus, reason string) error {
+	return updateWithRetry(ctx, svc, videoId, func(meta *VideoMetadata) error {
+		if !meta.Status.CanTransitionTo(next) || (next == StatusDeleted) != (meta.Status == StatusDeleted) {
+			return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, meta.Status, next)
+		}
+		switch next {
+		case StatusUploaded, StatusQueued:
+			meta.Progress = 0
+		case StatusTranscoding:
+			if meta.Status != StatusTranscoding {
+				meta.Progress = 0
+			}
+		case StatusReady:
+			meta.Progress = 100
+		}
+		meta.FailureReason = ""
+		if next == StatusFailed {
+			meta.FailureReason = reason
+		}
+		meta.Status = next
+		return nil
+	})
+}
+
+// SetProgress records how far transcoding has got, in percent. It only
+// applies while the video is transcoding and never moves progress backwards,
+// so late or duplicate reports are ignored.
+func SetProgress(ctx context.Context, svc VideoMetadataService, videoId string, percent int) error {
+	percent = max(0, min(percent, 100))
+	return updateWithRetry(ctx, svc, videoId, func(meta *VideoMetadata) error {
+		if meta.Status != StatusTranscoding || percent <= meta.Progress {
+			return errSkipUpdate
+		}
+		meta.Progress = percent
+		return nil
+	})
+}
+
+// errSkipUpdate tells updateWithRetry that there is nothing to write.
+var errSkipUpdate = errors.New("skip update")
+
+// updateWithRetry reads a video, applies mutate and writes it back with
+// Update, starting over if someone else wrote in between.
+func updateWithRetry(ctx context.Context, svc VideoMetadataService, videoId string, mutate func(*VideoMetadata) error) error {
+	for attempt := 0; attempt < statusMaxRetries; attempt++ {
+		meta, err := svc.Read(ctx, videoId)
+		if err != nil {
+			return err
+		}
+		if meta == nil {
+			return ErrNotFound
+		}
+		if err := mutate(meta); err != nil {
+			if errors.Is(err, errSkipUpdate) {
+				return nil
+			}
+			return err
+		}
+		err = svc.Update(ctx, meta)
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update %s: %w", videoId, ErrConflict)
+}
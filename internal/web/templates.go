@@ -14,13 +14,20 @@ const indexHTML = `
     <h2>Upload an MP4 Video</h2>
     <form action="/upload" method="post" enctype="multipart/form-data">
       <input type="file" name="file" accept="video/mp4" required />
+      <input type="text" name="title" placeholder="Title" />
+      <textarea name="description" placeholder="Description"></textarea>
+      <select name="visibility">
+        <option value="public">Public</option>
+        <option value="unlisted">Unlisted</option>
+        <option value="private">Private</option>
+      </select>
       <input type="submit" value="Upload" />
     </form>
     <h2>Watchlist</h2>
     <ul>
       {{range .}}
       <li>
-        <a href="/videos/{{.EscapedId}}">{{.Id}} ({{.UploadTime}})</a>
+        <a href="/videos/{{.EscapedId}}">{{if .Title}}{{.Title}}{{else}}{{.Id}}{{end}} ({{.UploadTime}})</a>
       </li>
       {{else}}
       <li>No videos uploaded yet.</li>
@@ -39,12 +46,13 @@ const videoHTML = `
     <script src="https://cdn.dashjs.org/latest/dash.all.min.js"></script>
   </head>
   <body>
-    <h1>{{.Id}}</h1>
+    <h1>{{if .Title}}{{.Title}}{{else}}{{.Id}}{{end}}</h1>
 	  <p>Uploaded at: {{.UploadedAt}}</p>
+    {{if .Description}}<p>{{.Description}}</p>{{end}}
 
     <video id="dashPlayer" controls style="width: 640px; height: 360px"></video>
     <script>
-      var url = "/content/{{.Id}}/manifest.mpd";
+      var url = {{.ManifestUrl}};
       var player = dashjs.MediaPlayer().create();
       player.initialize(document.querySelector("#dashPlayer"), url, false);
     </script>
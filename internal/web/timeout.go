@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"time"
+)
+
+// WithMetadataTimeout wraps svc so that every call gets at most d to finish,
+// on top of any deadline the caller's context already carries. A d of zero or
+// less returns svc unchanged. The result is a VideoSearcher if svc is one.
+func WithMetadataTimeout(svc VideoMetadataService, d time.Duration) VideoMetadataService {
+	if d <= 0 {
+		return svc
+	}
+	t := &timeoutMetadataService{svc: svc, timeout: d}
+	if searcher, ok := svc.(VideoSearcher); ok {
+		return &timeoutSearchService{timeoutMetadataService: t, searcher: searcher}
+	}
+	return t
+}
+
+type timeoutMetadataService struct {
+	svc     VideoMetadataService
+	timeout time.Duration
+}
+
+func (t *timeoutMetadataService) Read(ctx context.Context, videoId string) (*VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.Read(ctx, videoId)
+}
+
+func (t *timeoutMetadataService) List(ctx context.Context) ([]VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.List(ctx)
+}
+
+func (t *timeoutMetadataService) Query(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.Query(ctx, opts)
+}
+
+func (t *timeoutMetadataService) Create(ctx context.Context, videoId string, uploadedAt time.Time, ownerId string, visibility Visibility) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.Create(ctx, videoId, uploadedAt, ownerId, visibility)
+}
+
+func (t *timeoutMetadataService) CreateWithStatus(ctx context.Context, videoId string, uploadedAt time.Time, status VideoStatus, ownerId string, visibility Visibility) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.CreateWithStatus(ctx, videoId, uploadedAt, status, ownerId, visibility)
+}
+
+func (t *timeoutMetadataService) UpdateStatus(ctx context.Context, videoId string, status VideoStatus) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.UpdateStatus(ctx, videoId, status)
+}
+
+func (t *timeoutMetadataService) UpdateDetails(ctx context.Context, videoId string, title string, description string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.UpdateDetails(ctx, videoId, title, description)
+}
+
+func (t *timeoutMetadataService) UpdateMediaInfo(ctx context.Context, videoId string, info MediaInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.UpdateMediaInfo(ctx, videoId, info)
+}
+
+func (t *timeoutMetadataService) Update(ctx context.Context, meta *VideoMetadata) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.Update(ctx, meta)
+}
+
+func (t *timeoutMetadataService) Delete(ctx context.Context, videoId string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.Delete(ctx, videoId)
+}
+
+type timeoutSearchService struct {
+	*timeoutMetadataService
+	searcher VideoSearcher
+}
+
+func (t *timeoutSearchService) Search(ctx context.Context, query string, opts ListOptions) (*SearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.searcher.Search(ctx, query, opts)
+}
+
+// WithContentTimeout wraps svc so that every call gets at most d to finish.
+// A d of zero or less returns svc unchanged. Purging uploads keeps working
+// through the wrapper if svc supports it.
+func WithContentTimeout(svc VideoContentService, d time.Duration) VideoContentService {
+	if d <= 0 {
+		return svc
+	}
+	t := &timeoutContentService{svc: svc, timeout: d}
+	if uploads, ok := svc.(uploadDeleter); ok {
+		return &timeoutUploadContentService{timeoutContentService: t, uploads: uploads}
+	}
+	return t
+}
+
+type timeoutContentService struct {
+	svc     VideoContentService
+	timeout time.Duration
+}
+
+func (t *timeoutContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.Read(ctx, videoId, filename)
+}
+
+func (t *timeoutContentService) Write(ctx context.Context, videoId string, filename string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.Write(ctx, videoId, filename, data)
+}
+
+func (t *timeoutContentService) DeleteAll(ctx context.Context, videoId string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.svc.DeleteAll(ctx, videoId)
+}
+
+type timeoutUploadContentService struct {
+	*timeoutContentService
+	uploads uploadDeleter
+}
+
+func (t *timeoutUploadContentService) DeleteUploads(ctx context.Context, videoId string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.uploads.DeleteUploads(ctx, videoId)
+}
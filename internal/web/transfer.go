@@ -0,0 +1,432 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Metadata export format: JSON Lines, starting with one exportHeader line
+// followed by one exportRecord per video. Records carry explicit field names
+// so the format does not change when VideoMetadata does. Version 2 added the
+// grants of shared videos; version 1 exports are read as having none.
+const (
+	exportFormat  = "tritontube-metadata"
+	exportVersion = 2
+)
+
+// ErrImportConflict is returned by ImportMetadata under ConflictFail when a
+// video in the export already exists with different metadata.
+var ErrImportConflict = errors.New("video already exists with different metadata")
+
+type exportHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+type exportRecord struct {
+	Id          string    `json:"id"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+	Status      string    `json:"status"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+
+	Duration   float64 `json:"duration,omitempty"`
+	FileSize   int64   `json:"fileSize,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Bitrate    int64   `json:"bitrate,omitempty"`
+	VideoCodec string  `json:"videoCodec,omitempty"`
+	AudioCodec string  `json:"audioCodec,omitempty"`
+
+	FailureReason string    `json:"failureReason,omitempty"`
+	Progress      int       `json:"progress,omitempty"`
+	DeletedAt     time.Time `json:"deletedAt,omitzero"`
+	RestoreStatus string    `json:"restoreStatus,omitempty"`
+
+	// OwnerId and user grantees refer to users in the source backend. User
+	// accounts are not part of the export.
+	OwnerId    string        `json:"ownerId,omitempty"`
+	Visibility string        `json:"visibility,omitempty"`
+	Grants     []exportGrant `json:"grants,omitempty"`
+}
+
+type exportGrant struct {
+	Grantee string `json:"grantee"`
+	Role    string `json:"role"`
+}
+
+func newExportGrants(grants []Grant) []exportGrant {
+	var out []exportGrant
+	for _, g := range sortedGrants(grants) {
+		out = append(out, exportGrant{Grantee: string(g.Grantee), Role: string(g.Role)})
+	}
+	return out
+}
+
+func newExportRecord(meta VideoMetadata) exportRecord {
+	return exportRecord{
+		Id:            meta.Id,
+		UploadedAt:    meta.UploadedAt.UTC(),
+		Status:        string(meta.Status),
+		Title:         meta.Title,
+		Description:   meta.Description,
+		Duration:      meta.Duration,
+		FileSize:      meta.FileSize,
+		Width:         meta.Width,
+		Height:        meta.Height,
+		Bitrate:       meta.Bitrate,
+		VideoCodec:    meta.VideoCodec,
+		AudioCodec:    meta.AudioCodec,
+		FailureReason: meta.FailureReason,
+		Progress:      meta.Progress,
+		DeletedAt:     meta.DeletedAt.UTC(),
+		RestoreStatus: string(meta.RestoreStatus),
+		OwnerId:       meta.OwnerId,
+		Visibility:    string(meta.Visibility),
+	}
+}
+
+func (rec exportRecord) toMetadata() VideoMetadata {
+	return VideoMetadata{
+		Id:          rec.Id,
+		UploadedAt:  rec.UploadedAt,
+		Status:      legacyStatus(rec.Status),
+		Title:       rec.Title,
+		Description: rec.Description,
+		MediaInfo: MediaInfo{
+			Duration:   rec.Duration,
+			FileSize:   rec.FileSize,
+			Width:      rec.Width,
+			Height:     rec.Height,
+			Bitrate:    rec.Bitrate,
+			VideoCodec: rec.VideoCodec,
+			AudioCodec: rec.AudioCodec,
+		},
+		FailureReason: rec.FailureReason,
+		Progress:      rec.Progress,
+		DeletedAt:     rec.DeletedAt,
+		RestoreStatus: VideoStatus(rec.RestoreStatus),
+		OwnerId:       rec.OwnerId,
+		Visibility:    Visibility(rec.Visibility),
+	}
+}
+
+// ExportMetadata writes every video in svc, including those in the trash, to
+// w in the export format and returns how many were written. If svc stores
+// grants, each video's grants are written with it. Videos are read a page at
+// a time, so exports of any size use constant memory.
+func ExportMetadata(ctx context.Context, svc VideoMetadataService, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(exportHeader{Format: exportFormat, Version: exportVersion, ExportedAt: time.Now().UTC()}); err != nil {
+		return 0, fmt.Errorf("failed to write export header: %w", err)
+	}
+
+	n := 0
+	// One pass over the trash and everything else together, so a video
+	// trashed or restored during the export is written exactly once.
+	opts := ListOptions{IncludeTrash: true, Limit: maxListLimit, SortBy: SortByUploadedAt, SortOrder: SortAsc}
+	for {
+		page, err := svc.Query(ctx, opts)
+		if err != nil {
+			return n, fmt.Errorf("failed to list videos: %w", err)
+		}
+		for _, meta := range page.Videos {
+			rec := newExportRecord(meta)
+			grants, err := readGrants(ctx, svc, meta.Id)
+			if err != nil {
+				return n, err
+			}
+			rec.Grants = newExportGrants(grants)
+			if err := enc.Encode(rec); err != nil {
+				return n, fmt.Errorf("failed to write %s: %w", meta.Id, err)
+			}
+			n++
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	if err := bw.Flush(); err != nil {
+		return n, fmt.Errorf("failed to write export: %w", err)
+	}
+	return n, nil
+}
+
+// ConflictPolicy says what ImportMetadata does with a video that already
+// exists in the destination with different metadata.
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"      // keep the existing video
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace it with the imported one
+	ConflictFail      ConflictPolicy = "fail"      // stop with ErrImportConflict
+)
+
+// ParseConflictPolicy parses the name of a ConflictPolicy.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid conflict policy %q (want skip, overwrite or fail)", s)
+}
+
+// ImportOptions configures ImportMetadata.
+type ImportOptions struct {
+	OnConflict ConflictPolicy // defaults to ConflictFail
+	DryRun     bool           // decide what would happen without writing
+}
+
+// ImportStats counts what ImportMetadata did, or would have done in a dry run.
+type ImportStats struct {
+	Created     int
+	Overwritten int
+	Skipped     int // existed with different metadata and were left alone
+	Unchanged   int // existed with identical metadata
+}
+
+// ImportMetadata reads an export from r and writes its videos and their
+// grants into svc. Videos that already exist with identical metadata and
+// grants are left alone, so an import can be re-run after a failure.
+// Versions are not carried over: the destination numbers its own versions.
+// An export with grants is refused if svc does not store them.
+//
+// Imported videos are created with their owner and visibility, so none is
+// ever more visible than in the export, and then filled in. A failure
+// between the steps leaves a video with only those fields, its upload time
+// and status. It no longer matches the export, so a re-run only completes it
+// with ConflictOverwrite; ConflictFail reports it and ConflictSkip leaves it
+// incomplete.
+func ImportMetadata(ctx context.Context, svc VideoMetadataService, r io.Reader, opts ImportOptions) (ImportStats, error) {
+	var stats ImportStats
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictFail
+	}
+
+	err := readExport(r, func(meta VideoMetadata, grants []Grant) error {
+		if _, ok := svc.(ACLStore); !ok && len(grants) > 0 {
+			return fmt.Errorf("%s is shared, but the destination does not store grants", meta.Id)
+		}
+		existing, err := svc.Read(ctx, meta.Id)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", meta.Id, err)
+		}
+		var existingGrants []Grant
+		if existing != nil {
+			if existingGrants, err = readGrants(ctx, svc, meta.Id); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case existing == nil:
+			stats.Created++
+			if opts.DryRun {
+				return nil
+			}
+			if err := createImported(ctx, svc, meta); err != nil {
+				return err
+			}
+			return replaceGrants(ctx, svc, meta.Id, nil, grants)
+		case sameImportedMetadata(*existing, meta) && sameGrants(existingGrants, grants):
+			stats.Unchanged++
+			return nil
+		case opts.OnConflict == ConflictSkip:
+			stats.Skipped++
+			return nil
+		case opts.OnConflict == ConflictFail:
+			return fmt.Errorf("%s: %w", meta.Id, ErrImportConflict)
+		}
+
+		stats.Overwritten++
+		if opts.DryRun {
+			return nil
+		}
+		meta.Version = existing.Version
+		if err := svc.Update(ctx, &meta); err != nil {
+			return fmt.Errorf("failed to overwrite %s: %w", meta.Id, err)
+		}
+		return replaceGrants(ctx, svc, meta.Id, existingGrants, grants)
+	})
+	return stats, err
+}
+
+// readGrants returns the grants on a video, or none if svc does not store
+// grants.
+func readGrants(ctx context.Context, svc VideoMetadataService, videoId string) ([]Grant, error) {
+	acl, ok := svc.(ACLStore)
+	if !ok {
+		return nil, nil
+	}
+	grants, err := acl.ReadACL(ctx, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grants of %s: %w", videoId, err)
+	}
+	return grants, nil
+}
+
+// replaceGrants changes a video's grants from have to want.
+func replaceGrants(ctx context.Context, svc VideoMetadataService, videoId string, have, want []Grant) error {
+	if sameGrants(have, want) {
+		return nil
+	}
+	acl := svc.(ACLStore) // only reached with grants on one side or the other
+	for _, g := range have {
+		if !slices.ContainsFunc(want, func(w Grant) bool { return w.Grantee == g.Grantee }) {
+			if err := acl.RevokeGrant(ctx, videoId, g.Grantee); err != nil && !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("failed to revoke grant on %s: %w", videoId, err)
+			}
+		}
+	}
+	for _, g := range want {
+		if err := acl.PutGrant(ctx, videoId, g); err != nil {
+			return fmt.Errorf("failed to grant %s on %s: %w", g.Grantee, videoId, err)
+		}
+	}
+	return nil
+}
+
+func sortedGrants(grants []Grant) []Grant {
+	sorted := slices.Clone(grants)
+	slices.SortFunc(sorted, func(a, b Grant) int { return strings.Compare(string(a.Grantee), string(b.Grantee)) })
+	return sorted
+}
+
+func sameGrants(a, b []Grant) bool {
+	return slices.Equal(sortedGrants(a), sortedGrants(b))
+}
+
+func createImported(ctx context.Context, svc VideoMetadataService, meta VideoMetadata) error {
+	if err := svc.CreateWithStatus(ctx, meta.Id, meta.UploadedAt, meta.Status, meta.OwnerId, meta.Visibility); err != nil {
+		return fmt.Errorf("failed to create %s: %w", meta.Id, err)
+	}
+	created, err := svc.Read(ctx, meta.Id)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", meta.Id, err)
+	}
+	if created == nil {
+		return fmt.Errorf("failed to read %s: %w", meta.Id, ErrNotFound)
+	}
+	if sameImportedMetadata(*created, meta) {
+		return nil
+	}
+	meta.Version = created.Version
+	if err := svc.Update(ctx, &meta); err != nil {
+		return fmt.Errorf("failed to fill in %s: %w", meta.Id, err)
+	}
+	return nil
+}
+
+// VerifyMismatch describes a video whose metadata in the destination does
+// not match the export.
+type VerifyMismatch struct {
+	Id     string
+	Reason string
+}
+
+// VerifyMetadata reads an export from r and checks that every video in it
+// exists in svc with the same metadata and grants, ignoring versions. It
+// returns the number of videos checked and every mismatch found.
+func VerifyMetadata(ctx context.Context, svc VideoMetadataService, r io.Reader) (int, []VerifyMismatch, error) {
+	n := 0
+	var mismatches []VerifyMismatch
+	err := readExport(r, func(meta VideoMetadata, grants []Grant) error {
+		n++
+		stored, err := svc.Read(ctx, meta.Id)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", meta.Id, err)
+		}
+		if stored == nil {
+			mismatches = append(mismatches, VerifyMismatch{Id: meta.Id, Reason: "missing"})
+			return nil
+		}
+		storedGrants, err := readGrants(ctx, svc, meta.Id)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !sameImportedMetadata(*stored, meta):
+			mismatches = append(mismatches, VerifyMismatch{Id: meta.Id, Reason: "metadata differs"})
+		case !sameGrants(storedGrants, grants):
+			mismatches = append(mismatches, VerifyMismatch{Id: meta.Id, Reason: "grants differ"})
+		}
+		return nil
+	})
+	return n, mismatches, err
+}
+
+// readExport checks the header of an export and calls fn for each record.
+func readExport(r io.Reader, fn func(VideoMetadata, []Grant) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var header exportHeader
+	if err := dec.Decode(&header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("export is empty")
+		}
+		return fmt.Errorf("failed to read export header: %w", err)
+	}
+	if header.Format != exportFormat {
+		return fmt.Errorf("not a metadata export (format %q)", header.Format)
+	}
+	if header.Version < 1 || header.Version > exportVersion {
+		return fmt.Errorf("unsupported export version %d (this build reads up to %d)", header.Version, exportVersion)
+	}
+
+	for line := 2; ; line++ {
+		var rec exportRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read record %d: %w", line-1, err)
+		}
+		if rec.Id == "" {
+			return fmt.Errorf("record %d has no id", line-1)
+		}
+		meta := rec.toMetadata()
+		if _, ok := statusTransitions[meta.Status]; !ok {
+			return fmt.Errorf("record %d (%s): %w %q", line-1, rec.Id, ErrInvalidStatus, rec.Status)
+		}
+		grants := make([]Grant, 0, len(rec.Grants))
+		for _, g := range rec.Grants {
+			grantee, err := ParseGrantee(g.Grantee)
+			if err != nil {
+				return fmt.Errorf("record %d (%s): %w", line-1, rec.Id, err)
+			}
+			role, err := ParseRole(g.Role)
+			if err != nil {
+				return fmt.Errorf("record %d (%s): %w", line-1, rec.Id, err)
+			}
+			grants = append(grants, Grant{Grantee: grantee, Role: role})
+		}
+		if err := fn(meta, grants); err != nil {
+			return err
+		}
+	}
+}
+
+// sameImportedMetadata compares everything the export carries. Times are
+// compared to the second, the coarsest precision of any backend.
+func sameImportedMetadata(a, b VideoMetadata) bool {
+	if !a.UploadedAt.Truncate(time.Second).Equal(b.UploadedAt.Truncate(time.Second)) ||
+		!a.DeletedAt.Truncate(time.Second).Equal(b.DeletedAt.Truncate(time.Second)) {
+		return false
+	}
+	a.UploadedAt, b.UploadedAt = time.Time{}, time.Time{}
+	a.DeletedAt, b.DeletedAt = time.Time{}, time.Time{}
+	a.Version, b.Version = 0, 0
+	return a == b
+}
@@ -0,0 +1,192 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// TrashVideo moves a video to the trash. It disappears from listings and
+// playback but keeps its content until the Purger removes it, so it can be
+// restored in the meantime. It returns ErrNotFound if the video does not
+// exist or is already in the trash.
+func TrashVideo(ctx context.Context, svc VideoMetadataService, videoId string) error {
+	return updateWithRetry(ctx, svc, videoId, func(meta *VideoMetadata) error {
+		if meta.Status == StatusDeleted {
+			return ErrNotFound
+		}
+		meta.RestoreStatus = meta.Status
+		meta.Status = StatusDeleted
+		meta.DeletedAt = time.Now()
+		return nil
+	})
+}
+
+// restorePurging is stored as the RestoreStatus of a trashed video once the
+// Purger has claimed it, so that it can no longer be restored while its
+// content is being deleted.
+const restorePurging VideoStatus = "purging"
+
+// ErrPurging is returned by RestoreVideo for a video the Purger is removing.
+var ErrPurging = errors.New("video is being permanently deleted")
+
+// RestoreVideo takes a video out of the trash and returns its new status. A
+// video trashed while still being processed comes back failed, since its
+// processing was abandoned. It returns ErrInvalidTransition if the video is
+// not in the trash, and ErrPurging if it is being purged.
+func RestoreVideo(ctx context.Context, svc VideoMetadataService, videoId string) (VideoStatus, error) {
+	var restored VideoStatus
+	err := updateWithRetry(ctx, svc, videoId, func(meta *VideoMetadata) error {
+		if meta.Status != StatusDeleted {
+			return fmt.Errorf("%w: video is not in the trash", ErrInvalidTransition)
+		}
+		if meta.RestoreStatus == restorePurging {
+			return ErrPurging
+		}
+		switch meta.RestoreStatus {
+		case StatusReady, "":
+			meta.Status = StatusReady
+		case StatusFailed:
+			meta.Status = StatusFailed
+		default:
+			meta.Status = StatusFailed
+			meta.FailureReason = fmt.Sprintf("deleted while %s", meta.RestoreStatus)
+		}
+		meta.RestoreStatus = ""
+		meta.DeletedAt = time.Time{}
+		restored = meta.Status
+		return nil
+	})
+	return restored, err
+}
+
+// uploadDeleter is implemented by content services that keep the original
+// upload separately from the published content.
+type uploadDeleter interface {
+	DeleteUploads(ctx context.Context, videoId string) error
+}
+
+// Purger permanently removes videos that have been in the trash for longer
+// than the retention window: first their content, then their metadata.
+type Purger struct {
+	metadata  VideoMetadataService
+	content   VideoContentService
+	retention time.Duration
+}
+
+func NewPurger(metadata VideoMetadataService, content VideoContentService, retention time.Duration) *Purger {
+	return &Purger{metadata: metadata, content: content, retention: retention}
+}
+
+// Run purges expired videos every interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := p.PurgeExpired(ctx)
+		if err != nil {
+			slog.Warn("failed to purge trashed videos", "error", err)
+		}
+		if n > 0 {
+			slog.Info("purged trashed videos", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired removes every video trashed before the retention window and
+// returns how many were removed. Each page of the trash is purged as it is
+// read; the cursor resumes after the last video listed, so removing videos
+// does not shift later pages. A video that fails is logged, left in the
+// trash and retried on the next run.
+func (p *Purger) PurgeExpired(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-p.retention)
+
+	purged, failed := 0, 0
+	opts := ListOptions{Status: StatusDeleted, Limit: maxListLimit}
+	for {
+		page, err := p.metadata.Query(ctx, opts)
+		if err != nil {
+			return purged, fmt.Errorf("failed to list trashed videos: %w", err)
+		}
+		for _, v := range page.Videos {
+			if !v.DeletedAt.Before(cutoff) {
+				continue
+			}
+			if err := p.purge(ctx, v.Id, cutoff); err != nil {
+				slog.Warn("failed to purge trashed video", "video_id", v.Id, "error", err)
+				failed++
+				continue
+			}
+			purged++
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	if failed > 0 {
+		return purged, fmt.Errorf("failed to purge %d videos, they stay in the trash until the next run", failed)
+	}
+	return purged, nil
+}
+
+func (p *Purger) purge(ctx context.Context, videoId string, cutoff time.Time) error {
+	// Check again right before deleting in case the video was restored
+	// since it was listed.
+	meta, err := p.metadata.Read(ctx, videoId)
+	if err != nil {
+		return err
+	}
+	if meta == nil || meta.Status != StatusDeleted || !meta.DeletedAt.Before(cutoff) {
+		return nil
+	}
+
+	// Claim the video with a versioned update before deleting anything. A
+	// restore that lands first makes the claim conflict; one that lands
+	// after it sees the marker and is refused. A purge that failed part way
+	// has claimed the video already and carries on.
+	if meta.RestoreStatus != restorePurging {
+		meta.RestoreStatus = restorePurging
+		err := p.metadata.Update(ctx, meta)
+		if errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+			slog.Info("trashed video changed before purging, skipping it", "video_id", videoId)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to claim video for purging: %w", err)
+		}
+	}
+
+	if err := PurgeVideo(ctx, p.metadata, p.content, videoId); err != nil {
+		return err
+	}
+	slog.Info("video purged", "video_id", videoId, "deleted_at", meta.DeletedAt)
+	return nil
+}
+
+// PurgeVideo permanently removes a video, trashed or not: first its content,
+// then its metadata, so a failure part way leaves metadata to retry from.
+func PurgeVideo(ctx context.Context, metadata VideoMetadataService, content VideoContentService, videoId string) error {
+	if err := content.DeleteAll(ctx, videoId); err != nil {
+		return fmt.Errorf("failed to delete content: %w", err)
+	}
+	if uploads, ok := content.(uploadDeleter); ok {
+		if err := uploads.DeleteUploads(ctx, videoId); err != nil {
+			return fmt.Errorf("failed to delete uploads: %w", err)
+		}
+	}
+	if err := metadata.Delete(ctx, videoId); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to delete metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package web
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// User is a registered account. Videos record the Id of the user who
+// uploaded them in VideoMetadata.OwnerId.
+type User struct {
+	Id           string
+	Username     string // normalized with NormalizeUsername
+	PasswordHash string // see HashPassword
+	CreatedAt    time.Time
+}
+
+// UserStore stores accounts alongside video metadata. It is optional;
+// metadata services that keep users implement it, and callers check for it
+// with a type assertion on the service before wrapping it in decorators.
+type UserStore interface {
+	// CreateUser stores a new user, failing with ErrUserExists if the
+	// username is taken.
+	CreateUser(ctx context.Context, user User) error
+	// ReadUser looks a user up by normalized username, returning nil if
+	// there is none.
+	ReadUser(ctx context.Context, username string) (*User, error)
+}
+
+// Errors returned by RegisterUser and AuthenticateUser.
+var (
+	ErrInvalidUsername    = errors.New("usernames are 3 to 32 letters, digits, '.', '-' or '_'")
+	ErrWeakPassword       = errors.New("passwords must be at least 8 characters")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 32
+	minPasswordLength = 8
+	// maxPasswordLength stops huge passwords from making hashing expensive.
+	maxPasswordLength = 1024
+)
+
+// NormalizeUsername lower-cases name so usernames are case-insensitive, and
+// checks that it only uses allowed characters.
+func NormalizeUsername(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < minUsernameLength || len(name) > maxUsernameLength {
+		return "", ErrInvalidUsername
+	}
+	for _, r := range name {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_') {
+			return "", ErrInvalidUsername
+		}
+	}
+	return name, nil
+}
+
+// RegisterUser creates an account with a hashed password.
+func RegisterUser(ctx context.Context, store UserStore, username, password string) (*User, error) {
+	username, err := NormalizeUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, ErrWeakPassword
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := User{
+		Id:           "u_" + strings.ToLower(rand.Text()),
+		Username:     username,
+		PasswordHash: hash,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	if err := store.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AuthenticateUser returns the user if password is theirs, and
+// ErrInvalidCredentials otherwise, without saying which part was wrong.
+func AuthenticateUser(ctx context.Context, store UserStore, username, password string) (*User, error) {
+	username, err := NormalizeUsername(username)
+	if err != nil || len(password) > maxPasswordLength {
+		return nil, ErrInvalidCredentials
+	}
+	user, err := store.ReadUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		// Hash anyway so unknown usernames take as long as wrong passwords.
+		VerifyPassword(dummyPasswordHash(), password)
+		return nil, ErrInvalidCredentials
+	}
+	if !VerifyPassword(user.PasswordHash, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// Password hashes are stored as "pbkdf2-sha256$<iterations>$<salt>$<key>",
+// with salt and key in unpadded base64, so the cost can be raised later
+// without invalidating existing hashes.
+const (
+	passwordHashScheme     = "pbkdf2-sha256"
+	passwordHashIterations = 600_000 // OWASP's recommendation for PBKDF2-HMAC-SHA256
+	passwordSaltLength     = 16
+	passwordKeyLength      = 32
+)
+
+// HashPassword derives a salted PBKDF2 hash of password.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	rand.Read(salt)
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordHashIterations, passwordKeyLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, passwordHashIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches a hash from HashPassword.
+func VerifyPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword(rand.Text())
+	return hash
+})
+
+// SessionStore keeps signed-in sessions in memory, so they end when the
+// server restarts and are not shared between instances.
+type SessionStore struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]session // token -> session
+}
+
+type session struct {
+	user    User
+	expires time.Time
+}
+
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{ttl: ttl, sessions: make(map[string]session)}
+}
+
+// Create starts a session for user and returns its token.
+func (s *SessionStore) Create(user User) string {
+	token := rand.Text()
+	user.PasswordHash = "" // not needed once signed in
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeExpired()
+	s.sessions[token] = session{user: user, expires: time.Now().Add(s.ttl)}
+	return token
+}
+
+// Lookup returns the user signed in with token, or nil if the session does
+// not exist or has expired.
+func (s *SessionStore) Lookup(token string) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[token]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.sessions, token)
+		return nil
+	}
+	return &sess.user
+}
+
+// Delete ends the session, if it exists.
+func (s *SessionStore) Delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+}
+
+func (s *SessionStore) removeExpired() {
+	now := time.Now()
+	for token, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// CanManage reports whether user owns the video and so may change or delete
+// it. Videos uploaded before accounts existed have no owner and may only be
+// managed by admins, whose rights are checked separately.
+func CanManage(user *Principal, meta *VideoMetadata) bool {
+	if user == nil || user.UserId == "" {
+		return false
+	}
+	return meta.OwnerId == user.UserId
+}
@@ -0,0 +1,148 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Visibility says who may find and watch a video.
+type Visibility string
+
+const (
+	// VisibilityPublic videos are listed and anyone may watch them.
+	VisibilityPublic Visibility = "public"
+	// VisibilityUnlisted videos are left out of listings and search, but
+	// anyone with the link may watch them.
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPrivate videos can only be found and watched by those who
+	// may manage them and those they are shared with, and their content is
+	// only served through signed URLs or to those signed-in users.
+	VisibilityPrivate Visibility = "private"
+)
+
+// ErrInvalidVisibility is returned for an unknown visibility.
+var ErrInvalidVisibility = errors.New("visibility must be public, unlisted or private")
+
+// ParseVisibility checks s. An empty s is public, which is also what videos
+// stored before visibility existed have.
+func ParseVisibility(s string) (Visibility, error) {
+	switch v := Visibility(s); v {
+	case "":
+		return VisibilityPublic, nil
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return v, nil
+	default:
+		return "", ErrInvalidVisibility
+	}
+}
+
+// EffectiveVisibility returns the video's visibility, treating unset as
+// public.
+func (m *VideoMetadata) EffectiveVisibility() Visibility {
+	return m.Visibility.orPublic()
+}
+
+// orPublic returns v, or VisibilityPublic if it is unset.
+func (v Visibility) orPublic() Visibility {
+	if v == "" {
+		return VisibilityPublic
+	}
+	return v
+}
+
+// SetVisibility changes the visibility of a video.
+func SetVisibility(ctx context.Context, svc VideoMetadataService, videoId string, visibility Visibility) error {
+	return updateWithRetry(ctx, svc, videoId, func(meta *VideoMetadata) error {
+		if meta.EffectiveVisibility() == visibility {
+			return errSkipUpdate
+		}
+		meta.Visibility = visibility
+		return nil
+	})
+}
+
+// DefaultSignedURLTTL is how long a signed content URL stays valid. It
+// needs to outlast watching the video, since every segment is fetched with
+// the same token.
+const DefaultSignedURLTTL = 4 * time.Hour
+
+// ContentSigner issues and checks the tokens in signed content URLs of the
+// form /content/s/<token>/<id>/<file>. A token is bound to one video, not
+// one file, so the relative segment URLs in a manifest served under it are
+// covered too.
+type ContentSigner struct {
+	key []byte
+	ttl time.Duration
+}
+
+// NewContentSigner signs with key, which must be at least 32 bytes and the
+// same on every server instance. A nil key generates a random one, so URLs
+// only work on this instance until it restarts.
+func NewContentSigner(key []byte, ttl time.Duration) (*ContentSigner, error) {
+	if key == nil {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	if len(key) < 32 {
+		return nil, fmt.Errorf("content signing key must be at least 32 bytes")
+	}
+	if ttl <= 0 {
+		ttl = DefaultSignedURLTTL
+	}
+	return &ContentSigner{key: key, ttl: ttl}, nil
+}
+
+// Token returns a token for videoId that expires after the signer's TTL.
+func (c *ContentSigner) Token(videoId string, now time.Time) string {
+	expires := strconv.FormatInt(now.Add(c.ttl).Unix(), 36)
+	return expires + "." + base64.RawURLEncoding.EncodeToString(c.mac(videoId, expires))
+}
+
+// Verify reports whether token was issued for videoId and has not expired.
+func (c *ContentSigner) Verify(token, videoId string, now time.Time) bool {
+	expires, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expires, 36, 64)
+	if err != nil || now.Unix() > unix {
+		return false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	return err == nil && hmac.Equal(got, c.mac(videoId, expires))
+}
+
+func (c *ContentSigner) mac(videoId, expires string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte("content\x00" + videoId + "\x00" + expires))
+	return mac.Sum(nil)
+}
+
+// ContentURLPresigner is implemented by content services whose files can be
+// fetched straight from storage through presigned URLs, so the server can
+// redirect to them instead of proxying the data. It is optional; callers
+// check for it with a type assertion on the service before wrapping it in
+// decorators.
+type ContentURLPresigner interface {
+	PresignRead(ctx context.Context, videoId, filename string, ttl time.Duration) (string, error)
+}
+
+// contentURLs returns the manifest and thumbnail URLs of a video, signed
+// with signer if it is private.
+func contentURLs(meta *VideoMetadata, signer *ContentSigner, now time.Time) (manifest, thumbnail string) {
+	id := url.PathEscape(meta.Id)
+	if meta.EffectiveVisibility() != VisibilityPrivate || signer == nil {
+		return "/content/" + id + "/manifest.mpd", "/thumbnail/" + id
+	}
+	token := signer.Token(meta.Id, now)
+	return "/content/s/" + token + "/" + id + "/manifest.mpd", "/thumbnail/s/" + token + "/" + id
+}
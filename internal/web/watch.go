@@ -0,0 +1,131 @@
+package web
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ChangeType says what happened to a video.
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	// ChangeDeleted means the metadata is gone for good. Moving a video to
+	// the trash is an update to StatusDeleted.
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// VideoChange is one change reported by a VideoMetadataWatcher.
+type VideoChange struct {
+	Type    ChangeType
+	VideoId string
+	Video   *VideoMetadata // state after the change; nil for ChangeDeleted
+}
+
+// VideoMetadataWatcher is implemented by metadata services that can report
+// changes as they happen, including changes made by other processes sharing
+// the same store. It is optional; callers check for it with a type assertion
+// on the service before wrapping it in decorators.
+type VideoMetadataWatcher interface {
+	// Watch reports every change made after it returns on the returned
+	// channel, in order for any one video. The channel is closed when ctx
+	// is done or watching fails; callers that want to keep watching call
+	// Watch again. Changes made in between are not replayed.
+	Watch(ctx context.Context) (<-chan VideoChange, error)
+}
+
+// watchBuffer is how many changes a subscriber may fall behind by before it
+// is dropped.
+const watchBuffer = 256
+
+// changeFeed broadcasts changes to subscribers. Publishing never blocks: a
+// subscriber whose buffer is full has its channel closed instead, and is
+// expected to subscribe again and resynchronise.
+type changeFeed struct {
+	mu   sync.Mutex
+	subs map[chan VideoChange]struct{}
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{subs: make(map[chan VideoChange]struct{})}
+}
+
+// subscribe returns a channel receiving every change published until ctx is
+// done, at which point it is closed.
+func (f *changeFeed) subscribe(ctx context.Context) <-chan VideoChange {
+	ch := make(chan VideoChange, watchBuffer)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.unsubscribe(ch)
+	}()
+	return ch
+}
+
+func (f *changeFeed) unsubscribe(ch chan VideoChange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+func (f *changeFeed) publish(change VideoChange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- change:
+		default:
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// ChangeHub keeps a single Watch running against a metadata service and fans
+// its changes out to any number of subscribers, such as server-sent event
+// streams and caches. It re-watches after failures.
+type ChangeHub struct {
+	watcher VideoMetadataWatcher
+	feed    *changeFeed
+}
+
+func NewChangeHub(watcher VideoMetadataWatcher) *ChangeHub {
+	return &ChangeHub{watcher: watcher, feed: newChangeFeed()}
+}
+
+// Run watches for changes until ctx is cancelled.
+func (h *ChangeHub) Run(ctx context.Context) {
+	const retryDelay = time.Second
+
+	for ctx.Err() == nil {
+		changes, err := h.watcher.Watch(ctx)
+		if err != nil {
+			slog.Warn("failed to watch metadata changes", "error", err)
+		} else {
+			for change := range changes {
+				h.feed.publish(change)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every change seen from now on. It is
+// closed when ctx is done, or early if the subscriber falls more than
+// watchBuffer changes behind, in which case it may have missed changes.
+func (h *ChangeHub) Subscribe(ctx context.Context) <-chan VideoChange {
+	return h.feed.subscribe(ctx)
+}
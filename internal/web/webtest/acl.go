@@ -0,0 +1,201 @@
+package webtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"tritontube/internal/web"
+)
+
+var aclChecks = []check[web.ACLStore]{
+	{"unshared video has no grants", checkReadEmptyACL},
+	{"put then read grants", checkPutReadGrants},
+	{"put replaces the grantee's role", checkReplaceGrant},
+	{"revoke removes a grant, missing fails with ErrNotFound", checkRevokeGrant},
+	{"shared with lists videos of every grantee once", checkSharedWith},
+	{"deleting a video removes its grants", checkDeleteRemovesGrants},
+	{"cancelled context is honoured", checkACLCancelled},
+}
+
+var (
+	alice   = web.UserGrantee("u_alice")
+	bob     = web.UserGrantee("u_bob")
+	editors = web.GroupGrantee("editors")
+)
+
+// sortedGrants returns the grants of a video sorted by grantee, so they can
+// be compared.
+func sortedGrants(ctx context.Context, store web.ACLStore, videoId string) ([]web.Grant, error) {
+	grants, err := store.ReadACL(ctx, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("read ACL: %w", err)
+	}
+	slices.SortFunc(grants, func(a, b web.Grant) int {
+		switch {
+		case a.Grantee < b.Grantee:
+			return -1
+		case a.Grantee > b.Grantee:
+			return 1
+		}
+		return 0
+	})
+	return grants, nil
+}
+
+func checkReadEmptyACL(ctx context.Context, store web.ACLStore) error {
+	grants, err := store.ReadACL(ctx, "a")
+	if err != nil {
+		return fmt.Errorf("read ACL: %w", err)
+	}
+	if len(grants) != 0 {
+		return fmt.Errorf("read ACL: got %v, want none", grants)
+	}
+	return nil
+}
+
+func checkPutReadGrants(ctx context.Context, store web.ACLStore) error {
+	want := []web.Grant{{Grantee: editors, Role: web.RoleEditor}, {Grantee: alice, Role: web.RoleViewer}}
+	for _, grant := range want {
+		if err := store.PutGrant(ctx, "a", grant); err != nil {
+			return fmt.Errorf("put grant: %w", err)
+		}
+	}
+	if err := store.PutGrant(ctx, "b", web.Grant{Grantee: bob, Role: web.RoleViewer}); err != nil {
+		return fmt.Errorf("put grant: %w", err)
+	}
+	got, err := sortedGrants(ctx, store, "a")
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(got, want) {
+		return fmt.Errorf("read ACL: got %v, want %v", got, want)
+	}
+	return nil
+}
+
+func checkReplaceGrant(ctx context.Context, store web.ACLStore) error {
+	if err := store.PutGrant(ctx, "a", web.Grant{Grantee: alice, Role: web.RoleViewer}); err != nil {
+		return fmt.Errorf("put grant: %w", err)
+	}
+	if err := store.PutGrant(ctx, "a", web.Grant{Grantee: alice, Role: web.RoleEditor}); err != nil {
+		return fmt.Errorf("second put grant: %w", err)
+	}
+	got, err := sortedGrants(ctx, store, "a")
+	if err != nil {
+		return err
+	}
+	if want := []web.Grant{{Grantee: alice, Role: web.RoleEditor}}; !slices.Equal(got, want) {
+		return fmt.Errorf("read ACL: got %v, want %v", got, want)
+	}
+	return nil
+}
+
+func checkRevokeGrant(ctx context.Context, store web.ACLStore) error {
+	for _, grantee := range []web.Grantee{alice, bob} {
+		if err := store.PutGrant(ctx, "a", web.Grant{Grantee: grantee, Role: web.RoleViewer}); err != nil {
+			return fmt.Errorf("put grant: %w", err)
+		}
+	}
+	if err := store.RevokeGrant(ctx, "a", alice); err != nil {
+		return fmt.Errorf("revoke: %w", err)
+	}
+	if err := expectError("second revoke", store.RevokeGrant(ctx, "a", alice), web.ErrNotFound); err != nil {
+		return err
+	}
+	if err := expectError("revoke on unshared video", store.RevokeGrant(ctx, "b", bob), web.ErrNotFound); err != nil {
+		return err
+	}
+	got, err := sortedGrants(ctx, store, "a")
+	if err != nil {
+		return err
+	}
+	if want := []web.Grant{{Grantee: bob, Role: web.RoleViewer}}; !slices.Equal(got, want) {
+		return fmt.Errorf("read ACL after revoke: got %v, want %v", got, want)
+	}
+	shared, err := store.SharedWith(ctx, []web.Grantee{alice})
+	if err != nil {
+		return fmt.Errorf("shared with: %w", err)
+	}
+	if len(shared) != 0 {
+		return fmt.Errorf("shared with after revoke: got %v, want none", shared)
+	}
+	return nil
+}
+
+func checkSharedWith(ctx context.Context, store web.ACLStore) error {
+	for _, put := range []struct {
+		videoId string
+		grantee web.Grantee
+	}{
+		{"a", alice},
+		{"b", editors},
+		{"c", alice},
+		{"c", editors},
+		{"d", bob},
+	} {
+		if err := store.PutGrant(ctx, put.videoId, web.Grant{Grantee: put.grantee, Role: web.RoleViewer}); err != nil {
+			return fmt.Errorf("put grant: %w", err)
+		}
+	}
+	got, err := store.SharedWith(ctx, []web.Grantee{alice, editors})
+	if err != nil {
+		return fmt.Errorf("shared with: %w", err)
+	}
+	slices.Sort(got)
+	if want := []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		return fmt.Errorf("shared with: got %v, want %v", got, want)
+	}
+	if got, err = store.SharedWith(ctx, nil); err != nil || len(got) != 0 {
+		return fmt.Errorf("shared with nobody: got %v, %v; want none", got, err)
+	}
+	return nil
+}
+
+func checkDeleteRemovesGrants(ctx context.Context, store web.ACLStore) error {
+	svc, ok := store.(web.VideoMetadataService)
+	if !ok {
+		return fmt.Errorf("%T is not a metadata service", store)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := svc.Create(ctx, id, baseTime, "", ""); err != nil {
+			return fmt.Errorf("create: %w", err)
+		}
+		if err := store.PutGrant(ctx, id, web.Grant{Grantee: alice, Role: web.RoleViewer}); err != nil {
+			return fmt.Errorf("put grant: %w", err)
+		}
+	}
+	if err := svc.Delete(ctx, "a"); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	grants, err := store.ReadACL(ctx, "a")
+	if err != nil {
+		return fmt.Errorf("read ACL: %w", err)
+	}
+	if len(grants) != 0 {
+		return fmt.Errorf("read ACL of deleted video: got %v, want none", grants)
+	}
+	shared, err := store.SharedWith(ctx, []web.Grantee{alice})
+	if err != nil {
+		return fmt.Errorf("shared with: %w", err)
+	}
+	if want := []string{"b"}; !slices.Equal(shared, want) {
+		return fmt.Errorf("shared with after delete: got %v, want %v", shared, want)
+	}
+	return nil
+}
+
+func checkACLCancelled(ctx context.Context, store web.ACLStore) error {
+	cancelled := cancelledContext(ctx)
+	if err := store.PutGrant(cancelled, "a", web.Grant{Grantee: alice, Role: web.RoleViewer}); err == nil {
+		return errors.New("put grant with a cancelled context succeeded")
+	}
+	if _, err := store.ReadACL(cancelled, "a"); err == nil {
+		return errors.New("read ACL with a cancelled context succeeded")
+	}
+	if _, err := store.SharedWith(cancelled, []web.Grantee{alice}); err == nil {
+		return errors.New("shared with with a cancelled context succeeded")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package webtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"tritontube/internal/web"
+)
+
+var contentChecks = []check[web.VideoContentService]{
+	{"read missing file fails with ErrContentNotFound", checkReadMissingFile},
+	{"write then read", checkWriteRead},
+	{"write overwrites", checkOverwrite},
+	{"delete all removes only that video", checkDeleteAll},
+	{"delete all of missing video succeeds", checkDeleteAllMissing},
+	{"cancelled context is honoured", checkContentCancelled},
+}
+
+func checkReadMissingFile(ctx context.Context, svc web.VideoContentService) error {
+	videoId := uniqueVideoId()
+	_, err := svc.Read(ctx, videoId, "manifest.mpd")
+	if err := expectError("read from missing video", err, web.ErrContentNotFound); err != nil {
+		return err
+	}
+
+	if err := svc.Write(ctx, videoId, "manifest.mpd", []byte("<MPD/>")); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	defer svc.DeleteAll(ctx, videoId)
+	_, err = svc.Read(ctx, videoId, "thumbnail.jpg")
+	return expectError("read missing file", err, web.ErrContentNotFound)
+}
+
+func checkWriteRead(ctx context.Context, svc web.VideoContentService) error {
+	videoId := uniqueVideoId()
+	defer svc.DeleteAll(ctx, videoId)
+
+	files := map[string][]byte{
+		"manifest.mpd":          []byte("<MPD/>"),
+		"init-0.m4s":            randomBytes(4096),
+		"chunk-0-00001.m4s":     randomBytes(256 << 10),
+		"thumbnail.jpg":         {0xff, 0xd8, 0x00, 0xff, 0xd9},
+		"name with spaces.m4s":  []byte("spaces"),
+		"chunk-1-00001.m4s.tmp": []byte("dots"),
+	}
+	for name, data := range files {
+		if err := svc.Write(ctx, videoId, name, data); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+	for name, want := range files {
+		got, err := svc.Read(ctx, videoId, name)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("read %s: got %d bytes that differ from the %d written", name, len(got), len(want))
+		}
+	}
+	return nil
+}
+
+func checkOverwrite(ctx context.Context, svc web.VideoContentService) error {
+	videoId := uniqueVideoId()
+	defer svc.DeleteAll(ctx, videoId)
+
+	if err := svc.Write(ctx, videoId, "manifest.mpd", []byte("first version, longer")); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := svc.Write(ctx, videoId, "manifest.mpd", []byte("second")); err != nil {
+		return fmt.Errorf("second write: %w", err)
+	}
+	got, err := svc.Read(ctx, videoId, "manifest.mpd")
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if string(got) != "second" {
+		return fmt.Errorf("read: got %q, want %q", got, "second")
+	}
+	return nil
+}
+
+func checkDeleteAll(ctx context.Context, svc web.VideoContentService) error {
+	videoId, otherId := uniqueVideoId(), uniqueVideoId()
+	defer svc.DeleteAll(ctx, otherId)
+
+	names := []string{"manifest.mpd", "init-0.m4s", "chunk-0-00001.m4s"}
+	for _, id := range []string{videoId, otherId} {
+		for _, name := range names {
+			if err := svc.Write(ctx, id, name, []byte(id+"/"+name)); err != nil {
+				return fmt.Errorf("write %s/%s: %w", id, name, err)
+			}
+		}
+	}
+
+	if err := svc.DeleteAll(ctx, videoId); err != nil {
+		return fmt.Errorf("delete all: %w", err)
+	}
+	for _, name := range names {
+		_, err := svc.Read(ctx, videoId, name)
+		if err := expectError("read "+name+" after delete all", err, web.ErrContentNotFound); err != nil {
+			return err
+		}
+		if _, err := svc.Read(ctx, otherId, name); err != nil {
+			return fmt.Errorf("delete all removed %s of another video: %w", name, err)
+		}
+	}
+
+	// Deleting twice is not an error.
+	if err := svc.DeleteAll(ctx, videoId); err != nil {
+		return fmt.Errorf("second delete all: %w", err)
+	}
+	return nil
+}
+
+func checkDeleteAllMissing(ctx context.Context, svc web.VideoContentService) error {
+	if err := svc.DeleteAll(ctx, uniqueVideoId()); err != nil {
+		return fmt.Errorf("delete all: %w", err)
+	}
+	return nil
+}
+
+func checkContentCancelled(ctx context.Context, svc web.VideoContentService) error {
+	videoId := uniqueVideoId()
+	defer svc.DeleteAll(ctx, videoId)
+
+	cancelled := cancelledContext(ctx)
+	if err := svc.Write(cancelled, videoId, "manifest.mpd", []byte("<MPD/>")); err == nil {
+		return errors.New("write with a cancelled context succeeded")
+	}
+	if _, err := svc.Read(cancelled, videoId, "manifest.mpd"); err == nil {
+		return errors.New("read with a cancelled context succeeded")
+	}
+	return nil
+}
+
+// uniqueVideoId returns a fresh video ID so that checks against a shared
+// bucket or cluster do not interfere.
+func uniqueVideoId() string {
+	return "conformance-" + rand.Text()[:12]
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
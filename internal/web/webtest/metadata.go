@@ -0,0 +1,530 @@
+package webtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"tritontube/internal/web"
+)
+
+// baseTime is the upload time of the first video a check creates. Times are
+// whole seconds because DynamoDB stores them as Unix timestamps.
+var baseTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+var metadataChecks = []check[web.VideoMetadataService]{
+	{"read missing video returns nil", checkReadMissing},
+	{"create then read", checkCreateRead},
+	{"create duplicate fails with ErrAlreadyExists", checkCreateDuplicate},
+	{"create with status, owner and visibility", checkCreateWithStatus},
+	{"updates of missing video fail with ErrNotFound", checkUpdateMissing},
+	{"field updates bump version", checkFieldUpdates},
+	{"update is compare-and-set on version", checkUpdateConflict},
+	{"update round-trips every field", checkUpdateFields},
+	{"delete", checkDelete},
+	{"list is newest first and skips trash", checkList},
+	{"query pages cover every video once", checkQueryPages},
+	{"title pages fold only ASCII case", checkQueryTitlePages},
+	{"query filters by status", checkQueryStatus},
+	{"query can include the trash", checkQueryIncludeTrash},
+	{"query filters by owner", checkQueryOwner},
+	{"listed query hides others' unlisted and private videos unless shared", checkQueryListed},
+	{"cancelled context is honoured", checkMetadataCancelled},
+}
+
+func checkReadMissing(ctx context.Context, svc web.VideoMetadataService) error {
+	meta, err := svc.Read(ctx, "missing")
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if meta != nil {
+		return fmt.Errorf("read: got %+v, want nil", meta)
+	}
+	return nil
+}
+
+func checkCreateRead(ctx context.Context, svc web.VideoMetadataService) error {
+	if err := svc.Create(ctx, "a", baseTime, "", ""); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	meta, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+	if meta.Id != "a" || !meta.UploadedAt.Equal(baseTime) || meta.Status != web.StatusReady {
+		return fmt.Errorf("read: got id %q, uploaded %v, status %q; want %q, %v, %q",
+			meta.Id, meta.UploadedAt, meta.Status, "a", baseTime, web.StatusReady)
+	}
+	if meta.Version < 1 {
+		return fmt.Errorf("read: got version %d, want at least 1", meta.Version)
+	}
+	return nil
+}
+
+func checkCreateDuplicate(ctx context.Context, svc web.VideoMetadataService) error {
+	if err := svc.Create(ctx, "a", baseTime, "", ""); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	if err := expectError("second create", svc.Create(ctx, "a", baseTime.Add(time.Hour), "", ""), web.ErrAlreadyExists); err != nil {
+		return err
+	}
+	err := svc.CreateWithStatus(ctx, "a", baseTime.Add(time.Hour), web.StatusUploaded, "", "")
+	if err := expectError("create with status", err, web.ErrAlreadyExists); err != nil {
+		return err
+	}
+	meta, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+	if !meta.UploadedAt.Equal(baseTime) || meta.Status != web.StatusReady {
+		return fmt.Errorf("failed create changed the video: %+v", meta)
+	}
+	return nil
+}
+
+func checkCreateWithStatus(ctx context.Context, svc web.VideoMetadataService) error {
+	if err := svc.CreateWithStatus(ctx, "a", baseTime, web.StatusUploaded, "owner", web.VisibilityPrivate); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	meta, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+	if meta.Status != web.StatusUploaded {
+		return fmt.Errorf("read: got status %q, want %q", meta.Status, web.StatusUploaded)
+	}
+	if meta.OwnerId != "owner" || meta.Visibility != web.VisibilityPrivate || meta.Version != 1 {
+		return fmt.Errorf("read: got owner %q, visibility %q at version %d; want those written by the create", meta.OwnerId, meta.Visibility, meta.Version)
+	}
+	return nil
+}
+
+func checkUpdateMissing(ctx context.Context, svc web.VideoMetadataService) error {
+	updates := []struct {
+		op  string
+		err error
+	}{
+		{"update status", svc.UpdateStatus(ctx, "missing", web.StatusFailed)},
+		{"update details", svc.UpdateDetails(ctx, "missing", "title", "description")},
+		{"update media info", svc.UpdateMediaInfo(ctx, "missing", web.MediaInfo{Width: 640})},
+		{"update", svc.Update(ctx, &web.VideoMetadata{Id: "missing", Status: web.StatusReady, Version: 1})},
+	}
+	for _, u := range updates {
+		if err := expectError(u.op, u.err, web.ErrNotFound); err != nil {
+			return err
+		}
+	}
+	if meta, err := svc.Read(ctx, "missing"); err != nil || meta != nil {
+		return fmt.Errorf("update of a missing video created it: %+v, %v", meta, err)
+	}
+	return nil
+}
+
+func checkFieldUpdates(ctx context.Context, svc web.VideoMetadataService) error {
+	if err := svc.Create(ctx, "a", baseTime, "", ""); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	before, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+
+	info := web.MediaInfo{Duration: 12.5, FileSize: 1 << 20, Width: 1280, Height: 720, Bitrate: 800000, VideoCodec: "h264", AudioCodec: "aac"}
+	if err := svc.UpdateStatus(ctx, "a", web.StatusTranscoding); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+	if err := svc.UpdateDetails(ctx, "a", "Title", "Description"); err != nil {
+		return fmt.Errorf("update details: %w", err)
+	}
+	if err := svc.UpdateMediaInfo(ctx, "a", info); err != nil {
+		return fmt.Errorf("update media info: %w", err)
+	}
+
+	after, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+	if after.Status != web.StatusTranscoding || after.Title != "Title" || after.Description != "Description" || after.MediaInfo != info {
+		return fmt.Errorf("read after updates: got %+v", after)
+	}
+	if after.Version != before.Version+3 {
+		return fmt.Errorf("version went from %d to %d after three updates", before.Version, after.Version)
+	}
+	return nil
+}
+
+func checkUpdateConflict(ctx context.Context, svc web.VideoMetadataService) error {
+	if err := svc.Create(ctx, "a", baseTime, "", ""); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	first, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+	stale := *first
+
+	read := first.Version
+	first.Title = "first"
+	if err := svc.Update(ctx, first); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	if first.Version != read+1 {
+		return fmt.Errorf("update: meta.Version is %d, want %d", first.Version, read+1)
+	}
+
+	stale.Title = "stale"
+	if err := expectError("stale update", svc.Update(ctx, &stale), web.ErrConflict); err != nil {
+		return err
+	}
+	if stale.Version != read {
+		return fmt.Errorf("failed update changed meta.Version to %d", stale.Version)
+	}
+
+	stored, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+	if stored.Title != "first" || stored.Version != first.Version {
+		return fmt.Errorf("read: got title %q version %d, want %q version %d", stored.Title, stored.Version, "first", first.Version)
+	}
+	return nil
+}
+
+func checkUpdateFields(ctx context.Context, svc web.VideoMetadataService) error {
+	if err := svc.Create(ctx, "a", baseTime, "", ""); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	meta, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+
+	meta.Status = web.StatusDeleted
+	meta.Title = "Title"
+	meta.Description = "Description"
+	meta.MediaInfo = web.MediaInfo{Duration: 3, Width: 320, Height: 240, VideoCodec: "vp9"}
+	meta.FailureReason = "reason"
+	meta.Progress = 40
+	meta.DeletedAt = baseTime.Add(time.Hour)
+	meta.RestoreStatus = web.StatusTranscoding
+	meta.OwnerId = "u_owner"
+	meta.Visibility = web.VisibilityPrivate
+	want := *meta
+	if err := svc.Update(ctx, meta); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	want.Version = meta.Version
+
+	got, err := readExisting(ctx, svc, "a")
+	if err != nil {
+		return err
+	}
+	if !sameMetadata(*got, want) {
+		return fmt.Errorf("read after update: got %+v, want %+v", *got, want)
+	}
+	return nil
+}
+
+func checkDelete(ctx context.Context, svc web.VideoMetadataService) error {
+	for i, id := range []string{"a", "b"} {
+		if err := svc.Create(ctx, id, baseTime.Add(time.Duration(i)*time.Minute), "", ""); err != nil {
+			return fmt.Errorf("create %s: %w", id, err)
+		}
+	}
+	if err := svc.Delete(ctx, "a"); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if meta, err := svc.Read(ctx, "a"); err != nil || meta != nil {
+		return fmt.Errorf("read after delete: got %+v, %v; want nil", meta, err)
+	}
+	if _, err := readExisting(ctx, svc, "b"); err != nil {
+		return fmt.Errorf("delete removed another video: %w", err)
+	}
+	if err := expectError("second delete", svc.Delete(ctx, "a"), web.ErrNotFound); err != nil {
+		return err
+	}
+	if err := expectError("delete missing", svc.Delete(ctx, "missing"), web.ErrNotFound); err != nil {
+		return err
+	}
+	// The ID is free again once deleted.
+	if err := svc.Create(ctx, "a", baseTime, "", ""); err != nil {
+		return fmt.Errorf("create after delete: %w", err)
+	}
+	return nil
+}
+
+func checkList(ctx context.Context, svc web.VideoMetadataService) error {
+	ids, err := createVideos(ctx, svc, 4)
+	if err != nil {
+		return err
+	}
+	meta, err := readExisting(ctx, svc, ids[1])
+	if err != nil {
+		return err
+	}
+	meta.Status = web.StatusDeleted
+	meta.DeletedAt = baseTime
+	if err := svc.Update(ctx, meta); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	videos, err := svc.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	want := []string{ids[3], ids[2], ids[0]}
+	if got := videoIds(videos); !slices.Equal(got, want) {
+		return fmt.Errorf("list: got %v, want %v", got, want)
+	}
+	return nil
+}
+
+func checkQueryPages(ctx context.Context, svc web.VideoMetadataService) error {
+	ids, err := createVideos(ctx, svc, 5)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(ids)
+
+	var got []string
+	opts := web.ListOptions{Limit: 2}
+	for page := 1; ; page++ {
+		if page > len(ids) {
+			return fmt.Errorf("query: still paging after %d pages", page-1)
+		}
+		result, err := svc.Query(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("query page %d: %w", page, err)
+		}
+		if wrongTotal(result.Total, len(ids)) {
+			return fmt.Errorf("query page %d: got total %d, want %d", page, result.Total, len(ids))
+		}
+		if len(result.Videos) > opts.Limit {
+			return fmt.Errorf("query page %d: got %d videos, limit is %d", page, len(result.Videos), opts.Limit)
+		}
+		got = append(got, videoIds(result.Videos)...)
+		if result.NextCursor == "" {
+			break
+		}
+		opts.Cursor = result.NextCursor
+	}
+	if !slices.Equal(got, ids) {
+		return fmt.Errorf("query: pages returned %v, want %v", got, ids)
+	}
+	return nil
+}
+
+func checkQueryTitlePages(ctx context.Context, svc web.VideoMetadataService) error {
+	ids, err := createVideos(ctx, svc, 5)
+	if err != nil {
+		return err
+	}
+	titles := []string{"éclair", "zebra", "Émile", "Banana", "apple"}
+	for i, id := range ids {
+		if err := svc.UpdateDetails(ctx, id, titles[i], ""); err != nil {
+			return fmt.Errorf("update details: %w", err)
+		}
+	}
+	// Only ASCII letters are folded, so non-ASCII titles sort by their
+	// bytes after every ASCII one, and "Émile" before "éclair".
+	want := []string{ids[4], ids[3], ids[1], ids[2], ids[0]}
+
+	var got []string
+	opts := web.ListOptions{Limit: 2, SortBy: web.SortByTitle, SortOrder: web.SortAsc}
+	for page := 1; ; page++ {
+		if page > len(ids) {
+			return fmt.Errorf("query: still paging after %d pages", page-1)
+		}
+		result, err := svc.Query(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("query page %d: %w", page, err)
+		}
+		got = append(got, videoIds(result.Videos)...)
+		if result.NextCursor == "" {
+			break
+		}
+		opts.Cursor = result.NextCursor
+	}
+	if !slices.Equal(got, want) {
+		return fmt.Errorf("query by title: pages returned %v, want %v", got, want)
+	}
+	return nil
+}
+
+func checkQueryStatus(ctx context.Context, svc web.VideoMetadataService) error {
+	ids, err := createVideos(ctx, svc, 3)
+	if err != nil {
+		return err
+	}
+	if err := svc.UpdateStatus(ctx, ids[0], web.StatusFailed); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+	if err := svc.UpdateStatus(ctx, ids[2], web.StatusFailed); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+
+	result, err := svc.Query(ctx, web.ListOptions{Status: web.StatusFailed})
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	want := []string{ids[2], ids[0]}
+	if got := videoIds(result.Videos); !slices.Equal(got, want) || wrongTotal(result.Total, len(want)) {
+		return fmt.Errorf("query failed videos: got %v (total %d), want %v", got, result.Total, want)
+	}
+	return nil
+}
+
+func checkQueryIncludeTrash(ctx context.Context, svc web.VideoMetadataService) error {
+	ids, err := createVideos(ctx, svc, 3)
+	if err != nil {
+		return err
+	}
+	if err := svc.UpdateStatus(ctx, ids[1], web.StatusDeleted); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+
+	result, err := svc.Query(ctx, web.ListOptions{IncludeTrash: true})
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	want := []string{ids[2], ids[1], ids[0]}
+	if got := videoIds(result.Videos); !slices.Equal(got, want) || wrongTotal(result.Total, len(want)) {
+		return fmt.Errorf("query including trash: got %v (total %d), want %v", got, result.Total, want)
+	}
+	return nil
+}
+
+func checkQueryOwner(ctx context.Context, svc web.VideoMetadataService) error {
+	ids, err := createVideos(ctx, svc, 3)
+	if err != nil {
+		return err
+	}
+	for _, id := range []string{ids[0], ids[1]} {
+		meta, err := readExisting(ctx, svc, id)
+		if err != nil {
+			return err
+		}
+		meta.OwnerId = "u_owner"
+		if err := svc.Update(ctx, meta); err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+	}
+
+	result, err := svc.Query(ctx, web.ListOptions{Owner: "u_owner"})
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	want := []string{ids[1], ids[0]}
+	if got := videoIds(result.Videos); !slices.Equal(got, want) || wrongTotal(result.Total, len(want)) {
+		return fmt.Errorf("query owned videos: got %v (total %d), want %v", got, result.Total, want)
+	}
+	return nil
+}
+
+func checkQueryListed(ctx context.Context, svc web.VideoMetadataService) error {
+	ids, err := createVideos(ctx, svc, 4)
+	if err != nil {
+		return err
+	}
+	for i, visibility := range []web.Visibility{web.VisibilityPublic, web.VisibilityUnlisted, web.VisibilityPrivate, web.VisibilityPrivate} {
+		meta, err := readExisting(ctx, svc, ids[i])
+		if err != nil {
+			return err
+		}
+		meta.Visibility = visibility
+		if i == 2 {
+			meta.OwnerId = "u_owner"
+		}
+		if err := svc.Update(ctx, meta); err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		viewer string
+		shared []string
+		want   []string
+	}{
+		{"", nil, []string{ids[0]}},
+		{"u_owner", nil, []string{ids[2], ids[0]}},
+		{"u_other", []string{ids[3], ids[1]}, []string{ids[3], ids[1], ids[0]}},
+	} {
+		result, err := svc.Query(ctx, web.ListOptions{Listed: true, Viewer: tc.viewer, Shared: tc.shared})
+		if err != nil {
+			return fmt.Errorf("query: %w", err)
+		}
+		if got := videoIds(result.Videos); !slices.Equal(got, tc.want) || wrongTotal(result.Total, len(tc.want)) {
+			return fmt.Errorf("listed query for %q: got %v (total %d), want %v", tc.viewer, got, result.Total, tc.want)
+		}
+	}
+	return nil
+}
+
+func checkMetadataCancelled(ctx context.Context, svc web.VideoMetadataService) error {
+	if err := svc.Create(ctx, "a", baseTime, "", ""); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	cancelled := cancelledContext(ctx)
+	if _, err := svc.Read(cancelled, "a"); err == nil {
+		return errors.New("read with a cancelled context succeeded")
+	}
+	if err := svc.Create(cancelled, "b", baseTime, "", ""); err == nil {
+		return errors.New("create with a cancelled context succeeded")
+	}
+	if _, err := svc.Query(cancelled, web.ListOptions{}); err == nil {
+		return errors.New("query with a cancelled context succeeded")
+	}
+	return nil
+}
+
+// readExisting reads a video that the check expects to exist.
+func readExisting(ctx context.Context, svc web.VideoMetadataService, videoId string) (*web.VideoMetadata, error) {
+	meta, err := svc.Read(ctx, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", videoId, err)
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("read %s: video not found", videoId)
+	}
+	return meta, nil
+}
+
+// createVideos creates n videos uploaded a minute apart, oldest first, and
+// returns their IDs in that order.
+func createVideos(ctx context.Context, svc web.VideoMetadataService, n int) ([]string, error) {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("video-%02d", i)
+		if err := svc.Create(ctx, ids[i], baseTime.Add(time.Duration(i)*time.Minute), "", ""); err != nil {
+			return nil, fmt.Errorf("create %s: %w", ids[i], err)
+		}
+	}
+	return ids, nil
+}
+
+// wrongTotal reports whether a query total is neither want nor unknown.
+func wrongTotal(total, want int) bool {
+	return total != want && total != web.TotalUnknown
+}
+
+func videoIds(videos []web.VideoMetadata) []string {
+	ids := make([]string, len(videos))
+	for i, v := range videos {
+		ids[i] = v.Id
+	}
+	return ids
+}
+
+// sameMetadata compares a and b, treating times as equal if they are the
+// same instant in any location.
+func sameMetadata(a, b web.VideoMetadata) bool {
+	if !a.UploadedAt.Equal(b.UploadedAt) || !a.DeletedAt.Equal(b.DeletedAt) {
+		return false
+	}
+	a.UploadedAt, b.UploadedAt = time.Time{}, time.Time{}
+	a.DeletedAt, b.DeletedAt = time.Time{}, time.Time{}
+	a.Visibility, b.Visibility = a.EffectiveVisibility(), b.EffectiveVisibility()
+	return a == b
+}
@@ -0,0 +1,102 @@
+package webtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"tritontube/internal/web"
+)
+
+var userChecks = []check[web.UserStore]{
+	{"read missing user returns nil", checkReadMissingUser},
+	{"create then read user", checkCreateReadUser},
+	{"duplicate username fails with ErrUserExists", checkDuplicateUser},
+	{"register and authenticate", checkAuthenticate},
+	{"cancelled context is honoured", checkUsersCancelled},
+}
+
+func newUser(username string) web.User {
+	return web.User{Id: "u_" + username, Username: username, PasswordHash: "hash-" + username, CreatedAt: baseTime}
+}
+
+func checkReadMissingUser(ctx context.Context, store web.UserStore) error {
+	user, err := store.ReadUser(ctx, "missing")
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if user != nil {
+		return fmt.Errorf("read: got %+v, want nil", user)
+	}
+	return nil
+}
+
+func checkCreateReadUser(ctx context.Context, store web.UserStore) error {
+	want := newUser("alice")
+	if err := store.CreateUser(ctx, want); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	got, err := store.ReadUser(ctx, "alice")
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if got == nil {
+		return errors.New("read: user not found")
+	}
+	if got.Id != want.Id || got.Username != want.Username || got.PasswordHash != want.PasswordHash || !got.CreatedAt.Equal(want.CreatedAt) {
+		return fmt.Errorf("read: got %+v, want %+v", *got, want)
+	}
+	return nil
+}
+
+func checkDuplicateUser(ctx context.Context, store web.UserStore) error {
+	if err := store.CreateUser(ctx, newUser("alice")); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	duplicate := newUser("alice")
+	duplicate.Id = "u_other"
+	if err := expectError("second create", store.CreateUser(ctx, duplicate), web.ErrUserExists); err != nil {
+		return err
+	}
+	got, err := store.ReadUser(ctx, "alice")
+	if err != nil || got == nil || got.Id != "u_alice" {
+		return fmt.Errorf("read after duplicate: got %+v, %v; want the first user", got, err)
+	}
+	return nil
+}
+
+func checkAuthenticate(ctx context.Context, store web.UserStore) error {
+	user, err := web.RegisterUser(ctx, store, "Bob", "correct horse")
+	if err != nil {
+		return fmt.Errorf("register: %w", err)
+	}
+	got, err := web.AuthenticateUser(ctx, store, "BOB", "correct horse")
+	if err != nil {
+		return fmt.Errorf("authenticate: %w", err)
+	}
+	if got.Id != user.Id {
+		return fmt.Errorf("authenticate: got user %s, want %s", got.Id, user.Id)
+	}
+	if err := expectError("wrong password", authError(web.AuthenticateUser(ctx, store, "bob", "wrong horse")), web.ErrInvalidCredentials); err != nil {
+		return err
+	}
+	if err := expectError("unknown user", authError(web.AuthenticateUser(ctx, store, "carol", "correct horse")), web.ErrInvalidCredentials); err != nil {
+		return err
+	}
+	return nil
+}
+
+func authError(_ *web.User, err error) error {
+	return err
+}
+
+func checkUsersCancelled(ctx context.Context, store web.UserStore) error {
+	cancelled := cancelledContext(ctx)
+	if err := store.CreateUser(cancelled, newUser("alice")); err == nil {
+		return errors.New("create with a cancelled context succeeded")
+	}
+	if _, err := store.ReadUser(cancelled, "alice"); err == nil {
+		return errors.New("read with a cancelled context succeeded")
+	}
+	return nil
+}
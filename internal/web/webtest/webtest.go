@@ -0,0 +1,117 @@
+// Package webtest checks that VideoMetadataService and VideoContentService
+// implementations behave the way the web server relies on: the same errors
+// for missing and duplicate entries, the same ordering and the same delete
+// semantics. It has no dependency on the testing package so that the checks
+// can run against live stand-ins from cmd/conformance as well as from tests.
+package webtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"tritontube/internal/web"
+)
+
+// Result is the outcome of one conformance check.
+type Result struct {
+	Name string
+	Err  error // nil if the check passed
+}
+
+// MetadataFactory returns a new, empty metadata service. It is called once
+// per check so that checks cannot see each other's videos.
+type MetadataFactory func(ctx context.Context) (web.VideoMetadataService, error)
+
+// UserStoreFactory returns a new, empty user store. It is called once per
+// check.
+type UserStoreFactory func(ctx context.Context) (web.UserStore, error)
+
+// ACLStoreFactory returns a new, empty ACL store. It is called once per
+// check. Grants are kept beside video metadata, so the store must also be a
+// VideoMetadataService.
+type ACLStoreFactory func(ctx context.Context) (web.ACLStore, error)
+
+// ContentFactory returns a content service for one check. Checks use video
+// IDs of their own, so the service need not be empty.
+type ContentFactory func(ctx context.Context) (web.VideoContentService, error)
+
+type check[S any] struct {
+	name string
+	run  func(ctx context.Context, svc S) error
+}
+
+// CheckMetadataService runs every metadata check against services made by
+// newService and returns one Result per check, in a fixed order.
+func CheckMetadataService(ctx context.Context, newService MetadataFactory) []Result {
+	return runChecks(ctx, metadataChecks, newService)
+}
+
+// CheckUserStore runs every user store check against stores made by
+// newStore and returns one Result per check, in a fixed order.
+func CheckUserStore(ctx context.Context, newStore UserStoreFactory) []Result {
+	return runChecks(ctx, userChecks, newStore)
+}
+
+// CheckACLStore runs every ACL store check against stores made by newStore
+// and returns one Result per check, in a fixed order.
+func CheckACLStore(ctx context.Context, newStore ACLStoreFactory) []Result {
+	return runChecks(ctx, aclChecks, newStore)
+}
+
+// CheckContentService runs every content check against services made by
+// newService and returns one Result per check, in a fixed order.
+func CheckContentService(ctx context.Context, newService ContentFactory) []Result {
+	return runChecks(ctx, contentChecks, newService)
+}
+
+// Failed returns the results that did not pass.
+func Failed(results []Result) []Result {
+	var failed []Result
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+func runChecks[S any](ctx context.Context, checks []check[S], newService func(context.Context) (S, error)) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		results = append(results, Result{Name: c.name, Err: runCheck(ctx, c, newService)})
+	}
+	return results
+}
+
+func runCheck[S any](ctx context.Context, c check[S], newService func(context.Context) (S, error)) (err error) {
+	svc, err := newService(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	if closer, ok := any(svc).(io.Closer); ok {
+		defer closer.Close()
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return c.run(ctx, svc)
+}
+
+// expectError reports an error unless err matches target.
+func expectError(op string, err, target error) error {
+	if !errors.Is(err, target) {
+		return fmt.Errorf("%s: got error %v, want %v", op, err, target)
+	}
+	return nil
+}
+
+// cancelledContext returns a context that is already cancelled.
+func cancelledContext(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	return ctx
+}
@@ -8,6 +8,20 @@ class ApiError extends Error {
   }
 }
 
+// Raised by waitForProcessing when events cannot be used and polling is needed
+export class EventStreamUnavailableError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = 'EventStreamUnavailableError';
+  }
+}
+
+// Signed URLs of private videos (/content/s/... and /thumbnail/s/...) are only
+// served by the backend, which checks the token, never by the CDN.
+function isSignedMediaPath(url: string): boolean {
+  return url.startsWith('/content/s/') || url.startsWith('/thumbnail/s/');
+}
+
 // Helper function to handle API responses
 async function handleResponse<T>(response: Response): Promise<T> {
   if (!response.ok) {
@@ -52,6 +66,7 @@ export const api = {
     
     const response = await fetch(url, {
       method: 'GET',
+      credentials: 'include',
       headers: {
         'Accept': 'application/json',
       },
@@ -63,7 +78,9 @@ export const api = {
     data.data = data.data.map((v) => {
       // Backend returns relative paths like /content/{id}/manifest.mpd and /thumbnail/{id}
       // Our S3 keys are stored as {id}/manifest.mpd and {id}/thumbnail.jpg
-      if (v.manifestUrl && v.manifestUrl.startsWith('/content/')) {
+      if (v.manifestUrl && isSignedMediaPath(v.manifestUrl)) {
+        v.manifestUrl = `${API_BASE_URL}${v.manifestUrl}`;
+      } else if (v.manifestUrl && v.manifestUrl.startsWith('/content/')) {
         const parts = v.manifestUrl.split('/').filter(Boolean); // ['content', '{id}', 'manifest.mpd']
         if (parts.length >= 2) {
           const id = parts[1];
@@ -73,7 +90,9 @@ export const api = {
         }
       }
 
-      if (v.thumbnailUrl && v.thumbnailUrl.startsWith('/thumbnail/')) {
+      if (v.thumbnailUrl && isSignedMediaPath(v.thumbnailUrl)) {
+        v.thumbnailUrl = `${API_BASE_URL}${v.thumbnailUrl}`;
+      } else if (v.thumbnailUrl && v.thumbnailUrl.startsWith('/thumbnail/')) {
         const parts = v.thumbnailUrl.split('/').filter(Boolean); // ['thumbnail', '{id}']
         if (parts.length >= 2) {
           const id = parts[1];
@@ -95,6 +114,7 @@ export const api = {
   async getVideo(videoId: string): Promise<Video> {
     const response = await fetch(`${API_BASE_URL}/api/videos/${encodeURIComponent(videoId)}`, {
       method: 'GET',
+      credentials: 'include',
       headers: {
         'Accept': 'application/json',
       },
@@ -102,7 +122,9 @@ export const api = {
 
     const v = await handleResponse<Video>(response);
 
-    if (v.manifestUrl && v.manifestUrl.startsWith('/content/')) {
+    if (v.manifestUrl && isSignedMediaPath(v.manifestUrl)) {
+      v.manifestUrl = `${API_BASE_URL}${v.manifestUrl}`;
+    } else if (v.manifestUrl && v.manifestUrl.startsWith('/content/')) {
       const parts = v.manifestUrl.split('/').filter(Boolean);
       if (parts.length >= 2) {
         const id = parts[1];
@@ -112,7 +134,9 @@ export const api = {
       }
     }
 
-    if (v.thumbnailUrl && v.thumbnailUrl.startsWith('/thumbnail/')) {
+    if (v.thumbnailUrl && isSignedMediaPath(v.thumbnailUrl)) {
+      v.thumbnailUrl = `${API_BASE_URL}${v.thumbnailUrl}`;
+    } else if (v.thumbnailUrl && v.thumbnailUrl.startsWith('/thumbnail/')) {
       const parts = v.thumbnailUrl.split('/').filter(Boolean);
       if (parts.length >= 2) {
         const id = parts[1];
@@ -135,6 +159,7 @@ export const api = {
     // 1) Request presigned URL
     const presignResp = await fetch(`${API_BASE_URL}/api/presign-upload`, {
       method: 'POST',
+      credentials: 'include', // the session cookie identifies the uploader
       headers: {
         'Content-Type': 'application/json',
         'Accept': 'application/json',
@@ -177,6 +202,7 @@ export const api = {
     // 3) Notify backend to start processing the uploaded s3 object
     const notifyResp = await fetch(`${API_BASE_URL}/api/process`, {
       method: 'POST',
+      credentials: 'include',
       headers: {
         'Content-Type': 'application/json',
         'Accept': 'application/json',
@@ -194,12 +220,50 @@ export const api = {
     return data as Video;
   },
 
+  /**
+   * Wait for a video to finish processing by following its server-sent
+   * events. Resolves with the video's state once it is ready or has failed.
+   * Rejects if the video is deleted or the server does not offer events, in
+   * which case callers can fall back to polling getVideo.
+   */
+  waitForProcessing(videoId: string): Promise<Video> {
+    return new Promise((resolve, reject) => {
+      if (typeof EventSource === 'undefined') {
+        reject(new EventStreamUnavailableError('Server-sent events are not supported'));
+        return;
+      }
+
+      const source = new EventSource(`${API_BASE_URL}/api/events?id=${encodeURIComponent(videoId)}`);
+      const onVideo = (event: MessageEvent) => {
+        const video: Video = JSON.parse(event.data);
+        if (video.status === 'ready' || video.status === 'failed') {
+          source.close();
+          resolve(video);
+        }
+      };
+      source.addEventListener('snapshot', onVideo);
+      source.addEventListener('updated', onVideo);
+      source.addEventListener('deleted', () => {
+        source.close();
+        reject(new ApiError(404, 'Video was deleted'));
+      });
+      source.onerror = () => {
+        // EventSource reconnects by itself after a dropped stream; it only
+        // gives up when the server refuses it, e.g. with 404 or 501.
+        if (source.readyState === EventSource.CLOSED) {
+          reject(new EventStreamUnavailableError('Event stream unavailable'));
+        }
+      };
+    });
+  },
+
   /**
    * Delete a video by ID
    */
   async deleteVideo(videoId: string): Promise<void> {
     const response = await fetch(`${API_BASE_URL}/api/delete/${encodeURIComponent(videoId)}`, {
       method: 'DELETE',
+      credentials: 'include',
       headers: {
         'Accept': 'application/json',
       },
@@ -1,6 +1,6 @@
 import { createSlice, createAsyncThunk, PayloadAction } from '@reduxjs/toolkit';
 import { Video, VideoUpload, VideoFilters, VideoState } from '../types';
-import api from '../services/api';
+import api, { EventStreamUnavailableError } from '../services/api';
 
 // Async thunks for API calls
 export const fetchVideos = createAsyncThunk(
@@ -43,6 +43,22 @@ export const uploadVideo = createAsyncThunk(
         throw new Error('No video id returned');
       }
 
+      // Follow processing through server-sent events, falling back to polling
+      // if the server does not offer them.
+      try {
+        const done = await api.waitForProcessing(videoId);
+        if (done.status === 'failed') {
+          throw new Error(done.failureReason || 'Processing failed');
+        }
+        const video = await api.getVideo(videoId);
+        dispatch(updateUploadStatus({ id: uploadId, status: 'completed' }));
+        return video;
+      } catch (err) {
+        if (!(err instanceof EventStreamUnavailableError)) {
+          throw err;
+        }
+      }
+
       // Poll for processing completion (GET /api/videos/{id}) with timeout
       const pollIntervalMs = 5000; // 5 seconds
       const maxAttempts = 240; // ~20 minutes
@@ -1,3 +1,14 @@
+export type VideoStatus =
+  | 'uploaded'
+  | 'queued'
+  | 'transcoding'
+  | 'publishing'
+  | 'ready'
+  | 'failed'
+  | 'deleted';
+
+export type VideoVisibility = 'public' | 'unlisted' | 'private';
+
 export interface Video {
   id: string;
   escapedId: string;
@@ -7,6 +18,18 @@ export interface Video {
   description?: string;
   duration?: number;
   fileSize?: number;
+  width?: number;
+  height?: number;
+  bitrate?: number;
+  videoCodec?: string;
+  audioCodec?: string;
+  status?: VideoStatus;
+  failureReason?: string;
+  progress?: number;
+  deletedAt?: string;
+  ownerId?: string;
+  visibility?: VideoVisibility;
+  version?: number;
   thumbnailUrl?: string;
   manifestUrl?: string;
 }
@@ -27,10 +50,12 @@ export interface ApiError {
 
 export interface PaginatedResponse<T> {
   data: T[];
-  total: number;
+  // Left out when the backend cannot count the matches cheaply.
+  total?: number;
   page: number;
   limit: number;
   hasMore: boolean;
+  nextCursor?: string;
 }
 
 export interface VideoFilters {
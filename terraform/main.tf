@@ -109,4 +109,6 @@ module "ecs" {
   worker_max_count           = var.worker_max_count
   enable_autoscaling         = var.enable_autoscaling
   cdn_domain                 = module.cloudfront.video_cdn_domain
+  cors_allowed_origins       = "https://${module.cloudfront.frontend_cdn_domain}"
+  content_signing_key        = var.content_signing_key
 }
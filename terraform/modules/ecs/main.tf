@@ -188,16 +188,99 @@ resource "aws_dynamodb_table" "video_metadata" {
   billing_mode   = "PAY_PER_REQUEST" # On-demand pricing
   hash_key       = "id"
 
+  # Read by the web servers to push status changes to clients
+  stream_enabled   = true
+  stream_view_type = "NEW_IMAGE"
+
   attribute {
     name = "id"
     type = "S"
   }
 
+  attribute {
+    name = "listKey"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  attribute {
+    name = "uploadedAt"
+    type = "N"
+  }
+
+  # Time-ordered listing of all videos (listKey is the same on every item)
+  global_secondary_index {
+    name            = "listKey-uploadedAt-index"
+    hash_key        = "listKey"
+    range_key       = "uploadedAt"
+    projection_type = "ALL"
+  }
+
+  # Time-ordered listing filtered by status
+  global_secondary_index {
+    name            = "status-uploadedAt-index"
+    hash_key        = "status"
+    range_key       = "uploadedAt"
+    projection_type = "ALL"
+  }
+
   tags = {
     Name = "${var.project_name}-video-metadata"
   }
 }
 
+# User accounts. The web server finds this table by appending "-users" to the
+# metadata table name.
+resource "aws_dynamodb_table" "users" {
+  name         = "${aws_dynamodb_table.video_metadata.name}-users"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "username"
+
+  attribute {
+    name = "username"
+    type = "S"
+  }
+
+  tags = {
+    Name = "${var.project_name}-users"
+  }
+}
+
+# Who private videos are shared with. The web server finds this table by
+# appending "-acl" to the metadata table name, and looks up the videos shared
+# with a user or group through grantee-index.
+resource "aws_dynamodb_table" "acl" {
+  name         = "${aws_dynamodb_table.video_metadata.name}-acl"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "videoId"
+  range_key    = "grantee"
+
+  attribute {
+    name = "videoId"
+    type = "S"
+  }
+
+  attribute {
+    name = "grantee"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "grantee-index"
+    hash_key        = "grantee"
+    range_key       = "videoId"
+    projection_type = "KEYS_ONLY"
+  }
+
+  tags = {
+    Name = "${var.project_name}-acl"
+  }
+}
+
 /*
   Worker ECS task & service: lightweight task that runs the `worker` image (same ECR repo) and polls SQS.
   This is created as a separate task definition & service but reuses the cluster and log group.
@@ -323,6 +406,20 @@ resource "aws_ecs_task_definition" "main" {
         {
           name  = "CDN_DOMAIN"
           value = var.cdn_domain
+        },
+        {
+          name  = "CORS_ALLOWED_ORIGINS"
+          value = var.cors_allowed_origins
+        },
+        {
+          # Requests arrive through the ALB, which adds X-Forwarded-For.
+          name  = "TRUST_FORWARDED_FOR"
+          value = "true"
+        },
+        {
+          # Shared by every task so signed links work whichever one serves them.
+          name  = "CONTENT_SIGNING_KEY"
+          value = var.content_signing_key
         }
       ]
 
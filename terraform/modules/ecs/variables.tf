@@ -112,3 +112,14 @@ variable "cdn_domain" {
   description = "CloudFront CDN domain"
   type        = string
 }
+
+variable "cors_allowed_origins" {
+  description = "Comma-separated origins allowed to call the API from a browser"
+  type        = string
+}
+
+variable "content_signing_key" {
+  description = "Key for signing private videos' content URLs, at least 32 bytes"
+  type        = string
+  sensitive   = true
+}
@@ -84,7 +84,28 @@ resource "aws_iam_role_policy" "ecs_task_dynamodb" {
           "dynamodb:Query",
           "dynamodb:UpdateItem"
         ]
-        Resource = var.dynamodb_table_arn
+        Resource = [
+          var.dynamodb_table_arn,
+          "${var.dynamodb_table_arn}/index/*",
+          "${var.dynamodb_table_arn}-users",
+          "${var.dynamodb_table_arn}-acl",
+          "${var.dynamodb_table_arn}-acl/index/*"
+        ]
+      },
+      {
+        # Watching for metadata changes through the table's stream
+        Effect = "Allow"
+        Action = [
+          "dynamodb:DescribeTable",
+          "dynamodb:DescribeStream",
+          "dynamodb:GetShardIterator",
+          "dynamodb:GetRecords",
+          "dynamodb:ListStreams"
+        ]
+        Resource = [
+          var.dynamodb_table_arn,
+          "${var.dynamodb_table_arn}/stream/*"
+        ]
       }
     ]
   })
@@ -106,3 +106,9 @@ variable "max_capacity" {
   type        = number
   default     = 10
 }
+
+variable "content_signing_key" {
+  description = "Key for signing private videos' content URLs, at least 32 bytes (e.g. openssl rand -base64 48)"
+  type        = string
+  sensitive   = true
+}